@@ -1,7 +1,10 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"go.uber.org/zap"
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
@@ -9,10 +12,14 @@ import (
 	"mygame/config"
 	"mygame/dependers/database"
 	"mygame/dependers/logger"
+	"mygame/dependers/mailer"
 	"mygame/dependers/monitoring"
 	"mygame/internal/endpoint"
 	"mygame/internal/singleton"
+	"mygame/migration"
+	"mygame/tools/clock"
 	"mygame/tools/helpers"
+	"mygame/tools/jwt"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -21,14 +28,17 @@ import (
 
 const defaultPacksPath = "./packs"
 const defaultPacksTemporaryPath = "./packs_temporary"
+const defaultAvatarsPath = "./avatars"
 
 var packsPath string
 var packsTemporaryPath string
+var avatarsPath string
 
 func init() {
 	flag.StringVar(&packsPath, "packs-path", defaultPacksPath, "packs path")
 	flag.StringVar(&packsTemporaryPath, "packs-temp-path", defaultPacksTemporaryPath, "packs temporary path")
 	flag.StringVar(&packsPath, "p", defaultPacksPath, "packs path")
+	flag.StringVar(&avatarsPath, "avatars-path", defaultAvatarsPath, "avatars path")
 }
 
 func main() {
@@ -43,7 +53,21 @@ func main() {
 
 	config.Pack.Path = packsPath
 	config.PackTemporary.Path = packsTemporaryPath
-	config.JWT.SecretKey = secretKey
+	config.Avatar.Path = avatarsPath
+	if smtpPassword := os.Getenv("SMTP_PASSWORD"); smtpPassword != "" && config.Mail != nil {
+		config.Mail.Password = smtpPassword
+	}
+
+	if secretKey != "" {
+		config.JWT.SecretKey = secretKey
+	}
+
+	jwtKeys := jwt.WithSecretKey(config.JWT.ActiveKey, config.JWT.Keys, config.JWT.SecretKey, config.JWT.SecretKeyVerifyUntil)
+
+	config.JWT.KeySet, err = jwt.NewKeySet(config.JWT.ActiveKey, jwtKeys, clock.New())
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	connectionAddr := &database.Connection{
 		Host:     config.DB.Host,
@@ -61,6 +85,29 @@ func main() {
 		log.Fatal(err)
 	}
 
+	migrator, err := database.NewMigrator(db, migration.Files)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if flag.Arg(0) == "migrate" {
+		err = migrate(migrator, flag.Args()[1:])
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
+	if config.DB.AutoMigrate {
+		applied, err := migrator.Up(context.Background())
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Println("applied migrations:", applied)
+	}
+
 	logger, err := logger.ConfigureLogger(config.App.LogLevel)
 	if err != nil {
 		log.Fatal(err)
@@ -70,15 +117,25 @@ func main() {
 
 	singleton.InitSingleton()
 
-	singleton.InitPacks(defaultPacksPath + "/" + "siq_archives")
-
-	log.Println(singleton.GetPacks())
-
 	monitoring := monitoring.NewPrometheusMonitoring(config.Monitoring)
 
-	endpoint := endpoint.NewEndpoint(db, config, logger, monitoring)
+	mailer, err := mailer.NewMailer(config.Mail)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	endpoint := endpoint.NewEndpoint(db, config, logger, monitoring, mailer)
 	endpoint.InitRoutes()
 
+	backfilled, err := endpoint.BackfillPacks(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Println("packs added to the catalog:", backfilled)
+
+	go endpoint.CleanupGuests(context.Background())
+
 	logger.Info(
 		"My game server started",
 		zap.Int("port", config.App.Port),
@@ -107,3 +164,60 @@ func parseCfg(path string) (*config.Config, error) {
 
 	return &config, nil
 }
+
+// migrate runs the migrate subcommand: up, down [steps], version or force {version}.
+func migrate(migrator *database.Migrator, args []string) error {
+	ctx := context.Background()
+
+	if len(args) == 0 {
+		args = []string{"up"}
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+
+		log.Println("applied migrations:", applied)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			var err error
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps <= 0 {
+				return fmt.Errorf("incorrect steps %s", args[1])
+			}
+		}
+
+		reverted, err := migrator.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+
+		log.Println("reverted migrations:", reverted)
+	case "version":
+		version, err := migrator.Version(ctx)
+		if err != nil {
+			return err
+		}
+
+		log.Println("database version:", version)
+	case "force":
+		if len(args) < 2 {
+			return errors.New("force needs a version")
+		}
+
+		version, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("incorrect version %s", args[1])
+		}
+
+		return migrator.Force(ctx, version)
+	default:
+		return fmt.Errorf("unknown migrate command %s, expected up, down, version or force", args[0])
+	}
+
+	return nil
+}
@@ -1,17 +1,23 @@
 package config
 
 import (
+	"mygame/dependers/mailer"
 	"mygame/dependers/monitoring"
+	"mygame/tools/jwt"
 	"time"
 )
 
 type Config struct {
-	App           App `yaml:"app"`
-	DB            DB  `yaml:"db"`
-	JWT           JWT `yaml:"jwt"`
+	App           App     `yaml:"app"`
+	DB            DB      `yaml:"db"`
+	JWT           JWT     `yaml:"jwt"`
+	Hub           Hub     `yaml:"hub"`
+	Account       Account `yaml:"account"`
 	Pack          Pack
 	PackTemporary PackTemporary
+	Avatar        Avatar
 	Monitoring    *monitoring.Config `yaml:"monitoring"`
+	Mail          *mailer.Config     `yaml:"mail"`
 }
 
 type App struct {
@@ -26,11 +32,44 @@ type DB struct {
 	Password string `yaml:"password"`
 	DBName   string `yaml:"db_name"`
 	SSLMode  string `yaml:"ssl_mode"`
+
+	// Apply the pending migrations at startup.
+	AutoMigrate bool `yaml:"auto_migrate"`
 }
 
 type JWT struct {
 	SecretKey      string        `yaml:"secret_key"`
 	ExpirationTime time.Duration `yaml:"expiration_time"`
+
+	// Once other keys are configured, tokens signed with the secret key are accepted until this time.
+	SecretKeyVerifyUntil time.Time `yaml:"secret_key_verify_until"`
+
+	RefreshExpirationTime time.Duration `yaml:"refresh_expiration_time"`
+
+	// ID of the key new tokens are signed with, the secret key is used when no keys are configured.
+	ActiveKey string          `yaml:"active_key"`
+	Keys      []jwt.KeyConfig `yaml:"keys"`
+
+	// Loaded from the keys at startup.
+	KeySet *jwt.KeySet `yaml:"-"`
+}
+
+type Hub struct {
+	// Upper limit of spectators a hub can be created with.
+	MaxSpectators int `yaml:"max_spectators"`
+
+	// Base of invite links, the invite is passed in the "invite" query parameter.
+	InviteURL string        `yaml:"invite_url"`
+	InviteTTL time.Duration `yaml:"invite_ttl"`
+}
+
+type Account struct {
+	// Pages the mailed tokens are passed to in the "token" query parameter.
+	VerifyEmailURL   string `yaml:"verify_email_url"`
+	ResetPasswordURL string `yaml:"reset_password_url"`
+
+	VerifyEmailTTL   time.Duration `yaml:"verify_email_ttl"`
+	ResetPasswordTTL time.Duration `yaml:"reset_password_ttl"`
 }
 
 type Pack struct {
@@ -40,3 +79,7 @@ type Pack struct {
 type PackTemporary struct {
 	Path string
 }
+
+type Avatar struct {
+	Path string
+}
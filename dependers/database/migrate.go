@@ -0,0 +1,297 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Key of the advisory lock held while migrating, so that instances started together do not race.
+const migrationLockID = 7_391_466_201
+
+var (
+	ErrMigrationNotFound = errors.New("migration not found")
+	ErrUnknownVersion    = errors.New("database version is newer than the known migrations")
+)
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version uint64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Migrator struct {
+	db         *sqlx.DB
+	migrations []*Migration
+}
+
+// NewMigrator reads the migrations named {version}_{name}.up.sql and {version}_{name}.down.sql from the files.
+func NewMigrator(db *sqlx.DB, files fs.FS) (*Migrator, error) {
+	names, err := fs.Glob(files, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[uint64]*Migration)
+
+	for _, name := range names {
+		match := migrationFileName.FindStringSubmatch(name)
+		if match == nil {
+			return nil, fmt.Errorf("incorrect migration file name %s", name)
+		}
+
+		version, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil || version == 0 {
+			return nil, fmt.Errorf("incorrect migration version %s", name)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", migration.Name, match[2])
+		}
+
+		data, err := fs.ReadFile(files, name)
+		if err != nil {
+			return nil, err
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(data)
+		} else {
+			migration.Down = string(data)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", migration.Version, migration.Name)
+		}
+
+		migrations = append(migrations, migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return &Migrator{
+		db:         db,
+		migrations: migrations,
+	}, nil
+}
+
+// Up applies every migration that has not been applied yet and returns their versions.
+func (m *Migrator) Up(ctx context.Context) ([]uint64, error) {
+	var applied []uint64
+
+	err := m.locked(ctx, func(conn *sqlx.Conn) error {
+		current, err := m.version(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if migration.Version <= current {
+				continue
+			}
+
+			err = m.apply(ctx, conn, migration.Up, func(tx *sqlx.Tx) error {
+				_, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1,$2,$3)",
+					migration.Version, migration.Name, time.Now().UTC())
+
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			applied = append(applied, migration.Version)
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// Down reverts the last steps migrations and returns their versions.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]uint64, error) {
+	var reverted []uint64
+
+	err := m.locked(ctx, func(conn *sqlx.Conn) error {
+		for ; steps > 0; steps-- {
+			current, err := m.version(ctx, conn)
+			if err != nil {
+				return err
+			}
+
+			if current == 0 {
+				return nil
+			}
+
+			migration := m.find(current)
+			if migration == nil {
+				return ErrUnknownVersion
+			}
+
+			if migration.Down == "" {
+				return fmt.Errorf("migration %d_%s cannot be reverted", migration.Version, migration.Name)
+			}
+
+			err = m.apply(ctx, conn, migration.Down, func(tx *sqlx.Tx) error {
+				_, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = $1", migration.Version)
+
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			reverted = append(reverted, migration.Version)
+		}
+
+		return nil
+	})
+
+	return reverted, err
+}
+
+// Version returns the last applied migration, 0 if none.
+func (m *Migrator) Version(ctx context.Context) (uint64, error) {
+	var current uint64
+
+	err := m.locked(ctx, func(conn *sqlx.Conn) error {
+		var err error
+		current, err = m.version(ctx, conn)
+
+		return err
+	})
+
+	return current, err
+}
+
+// Force marks the migrations up to the version as applied without running them,
+// for databases that were migrated by hand.
+func (m *Migrator) Force(ctx context.Context, version uint64) error {
+	if version != 0 && m.find(version) == nil {
+		return ErrMigrationNotFound
+	}
+
+	return m.locked(ctx, func(conn *sqlx.Conn) error {
+		return m.apply(ctx, conn, "", func(tx *sqlx.Tx) error {
+			_, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations")
+			if err != nil {
+				return err
+			}
+
+			for _, migration := range m.migrations {
+				if migration.Version > version {
+					break
+				}
+
+				_, err = tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1,$2,$3)",
+					migration.Version, migration.Name, time.Now().UTC())
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+	})
+}
+
+func (m *Migrator) find(version uint64) *Migration {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return migration
+		}
+	}
+
+	return nil
+}
+
+// locked runs the function on a single connection holding the advisory lock.
+func (m *Migrator) locked(ctx context.Context, f func(conn *sqlx.Conn) error) error {
+	conn, err := m.db.Connx(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID)
+	if err != nil {
+		return err
+	}
+
+	// the lock belongs to the session, so it is released even if the context is cancelled
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID)
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations
+		(
+			version bigint not null
+				constraint schema_migrations_pk
+					primary key,
+			name text not null,
+			applied_at timestamp not null
+		)`)
+	if err != nil {
+		return err
+	}
+
+	return f(conn)
+}
+
+func (m *Migrator) version(ctx context.Context, conn *sqlx.Conn) (uint64, error) {
+	var current sql.NullInt64
+
+	err := conn.GetContext(ctx, &current, "SELECT max(version) FROM schema_migrations")
+	if err != nil {
+		return 0, err
+	}
+
+	if current.Valid && m.find(uint64(current.Int64)) == nil {
+		return 0, ErrUnknownVersion
+	}
+
+	return uint64(current.Int64), nil
+}
+
+// apply runs the statements and records them in one transaction.
+func (m *Migrator) apply(ctx context.Context, conn *sqlx.Conn, statements string, record func(tx *sqlx.Tx) error) error {
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if statements != "" {
+		_, err = tx.ExecContext(ctx, statements)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = record(tx)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,51 @@
+package mailer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileMailer writes every message to its own .eml file in the directory, for local development.
+type FileMailer struct {
+	dir  string
+	from string
+
+	mutex sync.Mutex
+	count int
+}
+
+func NewFileMailer(dir string, from string) (*FileMailer, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileMailer{
+		dir:  dir,
+		from: from,
+	}, nil
+}
+
+func (m *FileMailer) Send(message *Message) error {
+	m.mutex.Lock()
+	m.count++
+	name := strconv.FormatInt(time.Now().UnixNano(), 10) + "-" + strconv.Itoa(m.count) + "-" + sanitize(message.To) + ".eml"
+	m.mutex.Unlock()
+
+	return ioutil.WriteFile(filepath.Join(m.dir, name), format(m.from, message), 0600)
+}
+
+func sanitize(address string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == os.PathSeparator {
+			return '_'
+		}
+
+		return r
+	}, address)
+}
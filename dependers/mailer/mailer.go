@@ -0,0 +1,55 @@
+package mailer
+
+import (
+	"errors"
+)
+
+const (
+	DriverSMTP   = "smtp"
+	DriverFile   = "file"
+	DriverMemory = "memory"
+)
+
+type (
+	IMailer interface {
+		Send(message *Message) error
+	}
+
+	Message struct {
+		To      string
+		Subject string
+		Body    string
+	}
+
+	Config struct {
+		// Driver is "smtp", "file" or "memory".
+		Driver string `yaml:"driver"`
+		From   string `yaml:"from"`
+
+		Host     string `yaml:"host"`
+		Port     int    `yaml:"port"`
+		Username string `yaml:"username"`
+		Password string `yaml:"password"`
+
+		// Directory the file driver writes messages to.
+		Dir string `yaml:"dir"`
+	}
+)
+
+// NewMailer creates the mailer of the configured driver, mail is kept in memory when nothing is configured.
+func NewMailer(config *Config) (IMailer, error) {
+	if config == nil {
+		return NewMemoryMailer(), nil
+	}
+
+	switch config.Driver {
+	case DriverSMTP:
+		return NewSMTPMailer(config), nil
+	case DriverFile:
+		return NewFileMailer(config.Dir, config.From)
+	case DriverMemory, "":
+		return NewMemoryMailer(), nil
+	default:
+		return nil, errors.New("unknown mail driver " + config.Driver)
+	}
+}
@@ -0,0 +1,35 @@
+package mailer
+
+import (
+	"sync"
+)
+
+// MemoryMailer keeps the messages instead of sending them, for tests and local development.
+type MemoryMailer struct {
+	mutex    sync.Mutex
+	messages []*Message
+}
+
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+func (m *MemoryMailer) Send(message *Message) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.messages = append(m.messages, message)
+
+	return nil
+}
+
+// Messages returns the messages sent so far, the oldest first.
+func (m *MemoryMailer) Messages() []*Message {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	messages := make([]*Message, len(m.messages))
+	copy(messages, m.messages)
+
+	return messages
+}
@@ -0,0 +1,57 @@
+package mailer
+
+import (
+	"bytes"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+type SMTPMailer struct {
+	addr string
+	from string
+	// Bare address of the sender for the envelope.
+	sender string
+	auth   smtp.Auth
+}
+
+func NewSMTPMailer(config *Config) *SMTPMailer {
+	mailer := &SMTPMailer{
+		addr:   net.JoinHostPort(config.Host, strconv.Itoa(config.Port)),
+		from:   config.From,
+		sender: config.From,
+	}
+
+	if address, err := mail.ParseAddress(config.From); err == nil {
+		mailer.sender = address.Address
+	}
+
+	if config.Username != "" {
+		mailer.auth = smtp.PlainAuth("", config.Username, config.Password, config.Host)
+	}
+
+	return mailer
+}
+
+func (m *SMTPMailer) Send(message *Message) error {
+	return smtp.SendMail(m.addr, m.auth, m.sender, []string{message.To}, format(m.from, message))
+}
+
+// format renders the message with the headers a mail server expects.
+func format(from string, message *Message) []byte {
+	var buf bytes.Buffer
+
+	buf.WriteString("From: " + from + "\r\n")
+	buf.WriteString("To: " + message.To + "\r\n")
+	buf.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", message.Subject) + "\r\n")
+	buf.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(message.Body)
+
+	return buf.Bytes()
+}
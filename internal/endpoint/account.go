@@ -0,0 +1,388 @@
+package endpoint
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"mygame/dependers/mailer"
+	"mygame/internal/models"
+	"mygame/internal/repository"
+	"mygame/tools/helpers"
+	"mygame/tools/jwt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// Random bytes in a mailed token.
+	userTokenLength = 32
+
+	// Time given to look up the address and mail the reset link after the request is answered.
+	passwordResetTimeout = 30 * time.Second
+)
+
+// issueUserToken stores a single-use token for the user and returns it.
+func (e *Endpoint) issueUserToken(ctx context.Context, userID uint64, purpose string, email string) (string, error) {
+	token, err := helpers.GenerateToken(userTokenLength)
+	if err != nil {
+		return "", errors.New("token creation error")
+	}
+
+	ttl := e.configuration.Account.VerifyEmailTTL
+	if purpose == models.TokenPurposeResetPassword {
+		ttl = e.configuration.Account.ResetPasswordTTL
+	}
+
+	now := e.clock.Now()
+
+	userToken := &models.UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		Email:     email,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+
+	err = e.repository.TokenRepository.CreateUserToken(ctx, userToken, hashToken(token))
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// sendVerification mails the user a link to verify the email, failures are only logged
+// as the user can always ask for another one.
+func (e *Endpoint) sendVerification(ctx context.Context, userID uint64, email string) {
+	logger := ctx.Value(LoggerContext).(*zap.Logger)
+
+	token, err := e.issueUserToken(ctx, userID, models.TokenPurposeVerifyEmail, email)
+	if err != nil {
+		logger.Error(
+			"create verification token error",
+			zap.Error(err),
+		)
+
+		return
+	}
+
+	err = e.mailer.Send(&mailer.Message{
+		To:      email,
+		Subject: "Confirm your email",
+		Body: "To confirm your email open the link:\n\n" +
+			e.configuration.Account.VerifyEmailURL + "?token=" + url.QueryEscape(token) + "\n",
+	})
+	if err != nil {
+		logger.Error(
+			"send verification error",
+			zap.Error(err),
+		)
+	}
+}
+
+// sendEmailVerification sets the email of the user, if given, and mails a new verification link.
+func (e *Endpoint) sendEmailVerification(w http.ResponseWriter, r *http.Request) {
+	ctx := e.CreateContext(w, r)
+
+	if r.Method != http.MethodPost {
+		e.responseWriterError(errors.New("method not allowed"), w, http.StatusMethodNotAllowed, ctx, "")
+
+		return
+	}
+
+	token, err := jwt.ParseJWT(e.configuration.JWT.KeySet, r.Header.Get("Authorization"))
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusUnauthorized, ctx, "parse jwt error")
+
+		return
+	}
+
+	revoked, err := e.isRevoked(ctx, token)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "check token error")
+
+		return
+	}
+
+	if revoked || token.ID == 0 {
+		e.responseWriterError(errTokenRevoked, w, http.StatusUnauthorized, ctx, "")
+
+		return
+	}
+
+	type request struct {
+		Email string `json:"email"`
+	}
+
+	var req *request
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusBadRequest, ctx, "read body error")
+
+		return
+	}
+
+	if len(body) != 0 {
+		err = json.Unmarshal(body, &req)
+		if err != nil {
+			e.responseWriterError(err, w, http.StatusBadRequest, ctx, "unmarshal body to struct error")
+
+			return
+		}
+	}
+
+	if req != nil && req.Email != "" {
+		err = models.ValidateEmail(req.Email)
+		if err != nil {
+			e.responseWriterError(err, w, http.StatusBadRequest, ctx, "")
+
+			return
+		}
+
+		err = e.repository.UserRepository.SetUserEmail(ctx, token.ID, req.Email)
+		if err == repository.ErrEmailTaken {
+			e.responseWriterError(err, w, http.StatusBadRequest, ctx, "")
+
+			return
+		} else if err != nil {
+			e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "update email error")
+
+			return
+		}
+	}
+
+	email, verified, err := e.repository.UserRepository.GetUserEmail(ctx, token.ID)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusNotFound, ctx, "")
+
+		return
+	}
+
+	if email == "" {
+		e.responseWriterError(errors.New("email is not set"), w, http.StatusBadRequest, ctx, "")
+
+		return
+	}
+
+	if verified {
+		e.responseWriterError(errors.New("email is already verified"), w, http.StatusBadRequest, ctx, "")
+
+		return
+	}
+
+	e.sendVerification(ctx, token.ID, email)
+
+	e.responseWriter(http.StatusOK, map[string]interface{}{}, w, ctx)
+}
+
+func (e *Endpoint) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	ctx := e.CreateContext(w, r)
+
+	if r.Method != http.MethodPost {
+		e.responseWriterError(errors.New("method not allowed"), w, http.StatusMethodNotAllowed, ctx, "")
+
+		return
+	}
+
+	type request struct {
+		Token string `json:"token"`
+	}
+
+	var req *request
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusBadRequest, ctx, "read body error")
+
+		return
+	}
+
+	err = json.Unmarshal(body, &req)
+	if err != nil || req == nil || req.Token == "" {
+		e.responseWriterError(errors.New("token is empty"), w, http.StatusBadRequest, ctx, "unmarshal body to struct error")
+
+		return
+	}
+
+	userToken, err := e.repository.TokenRepository.UseUserToken(ctx, hashToken(req.Token), models.TokenPurposeVerifyEmail, e.clock.Now())
+	if err == repository.ErrUserTokenInvalid {
+		e.responseWriterError(err, w, http.StatusBadRequest, ctx, "")
+
+		return
+	} else if err != nil {
+		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "use token error")
+
+		return
+	}
+
+	err = e.repository.UserRepository.VerifyUserEmail(ctx, userToken.UserID, userToken.Email)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusBadRequest, ctx, "")
+
+		return
+	}
+
+	e.responseWriter(http.StatusOK, map[string]interface{}{}, w, ctx)
+}
+
+// forgotPassword mails a reset link to the verified email. The answer is the same whether the email is known or not,
+// so that it cannot be used to find out who has an account.
+func (e *Endpoint) forgotPassword(w http.ResponseWriter, r *http.Request) {
+	ctx := e.CreateContext(w, r)
+
+	if r.Method != http.MethodPost {
+		e.responseWriterError(errors.New("method not allowed"), w, http.StatusMethodNotAllowed, ctx, "")
+
+		return
+	}
+
+	type request struct {
+		Email string `json:"email"`
+	}
+
+	var req *request
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusBadRequest, ctx, "read body error")
+
+		return
+	}
+
+	err = json.Unmarshal(body, &req)
+	if err != nil || req == nil || models.ValidateEmail(req.Email) != nil {
+		e.responseWriterError(errors.New("incorrect email"), w, http.StatusBadRequest, ctx, "unmarshal body to struct error")
+
+		return
+	}
+
+	address := remoteHost(r)
+
+	if !e.resetAttempts.allowed(address) {
+		e.responseWriterError(errTooManyAttempts, w, http.StatusTooManyRequests, ctx, "")
+
+		return
+	}
+
+	e.resetAttempts.fail(address)
+
+	// the answer must take as long for an unknown address as for a known one, so the lookup and the mail
+	// are left to the background, which outlives the request
+	go e.sendPasswordReset(context.WithValue(context.Background(), LoggerContext, ctx.Value(LoggerContext)), req.Email)
+
+	e.responseWriter(http.StatusOK, map[string]interface{}{}, w, ctx)
+}
+
+// sendPasswordReset mails a reset link when the address is verified for a user, unknown addresses are ignored.
+func (e *Endpoint) sendPasswordReset(ctx context.Context, email string) {
+	logger := ctx.Value(LoggerContext).(*zap.Logger)
+
+	ctx, cancel := context.WithTimeout(ctx, passwordResetTimeout)
+	defer cancel()
+
+	userID, err := e.repository.UserRepository.GetUserIDByVerifiedEmail(ctx, email)
+	if err != nil {
+		return
+	}
+
+	token, err := e.issueUserToken(ctx, userID, models.TokenPurposeResetPassword, "")
+	if err != nil {
+		logger.Error(
+			"create reset token error",
+			zap.Error(err),
+		)
+
+		return
+	}
+
+	err = e.mailer.Send(&mailer.Message{
+		To:      email,
+		Subject: "Reset your password",
+		Body: "To set a new password open the link:\n\n" +
+			e.configuration.Account.ResetPasswordURL + "?token=" + url.QueryEscape(token) + "\n\n" +
+			"If you did not ask for it, ignore this message.\n",
+	})
+	if err != nil {
+		logger.Error(
+			"send password reset error",
+			zap.Error(err),
+		)
+	}
+}
+
+// resetPassword sets the new password and ends every session of the user.
+func (e *Endpoint) resetPassword(w http.ResponseWriter, r *http.Request) {
+	ctx := e.CreateContext(w, r)
+
+	if r.Method != http.MethodPost {
+		e.responseWriterError(errors.New("method not allowed"), w, http.StatusMethodNotAllowed, ctx, "")
+
+		return
+	}
+
+	type request struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	var req *request
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusBadRequest, ctx, "read body error")
+
+		return
+	}
+
+	err = json.Unmarshal(body, &req)
+	if err != nil || req == nil || req.Token == "" {
+		e.responseWriterError(errors.New("token is empty"), w, http.StatusBadRequest, ctx, "unmarshal body to struct error")
+
+		return
+	}
+
+	err = models.ValidatePassword(req.Password)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusBadRequest, ctx, "")
+
+		return
+	}
+
+	userToken, err := e.repository.TokenRepository.UseUserToken(ctx, hashToken(req.Token), models.TokenPurposeResetPassword, e.clock.Now())
+	if err == repository.ErrUserTokenInvalid {
+		e.responseWriterError(err, w, http.StatusBadRequest, ctx, "")
+
+		return
+	} else if err != nil {
+		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "use token error")
+
+		return
+	}
+
+	hashPassword, err := helpers.HashPassword(req.Password)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "hash password error")
+
+		return
+	}
+
+	err = e.repository.UserRepository.UpdateUserPassword(ctx, userToken.UserID, hashPassword)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "update password error")
+
+		return
+	}
+
+	err = e.repository.TokenRepository.RevokeUserTokenFamilies(ctx, userToken.UserID, e.clock.Now())
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "revoke token error")
+
+		return
+	}
+
+	e.responseWriter(http.StatusOK, map[string]interface{}{}, w, ctx)
+}
@@ -0,0 +1,241 @@
+package endpoint
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"mygame/internal/models"
+	"mygame/internal/repository"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// getUsers lists the users to admins, filtered by a part of the login and by the ban.
+func (e *Endpoint) getUsers(w http.ResponseWriter, r *http.Request) {
+	ctx := e.CreateContext(w, r)
+
+	if r.Method != http.MethodGet {
+		e.responseWriterError(errors.New("method not allowed"), w, http.StatusMethodNotAllowed, ctx, "")
+
+		return
+	}
+
+	_, status, err := e.authorize(ctx, r, models.RoleAdmin)
+	if err != nil {
+		e.responseWriterError(err, w, status, ctx, "")
+
+		return
+	}
+
+	query := r.URL.Query()
+
+	filter := &models.UserFilter{
+		Login: query.Get("login"),
+		Limit: 20,
+	}
+
+	if value := query.Get("banned"); value != "" {
+		banned, err := strconv.ParseBool(value)
+		if err != nil {
+			e.responseWriterError(errors.New("incorrect banned filter"), w, http.StatusBadRequest, ctx, "")
+
+			return
+		}
+
+		filter.Banned = &banned
+	}
+
+	if value := query.Get("limit"); value != "" {
+		filter.Limit, err = strconv.Atoi(value)
+		if err != nil || filter.Limit <= 0 || filter.Limit > 100 {
+			e.responseWriterError(errors.New("incorrect limit"), w, http.StatusBadRequest, ctx, "")
+
+			return
+		}
+	}
+
+	if value := query.Get("offset"); value != "" {
+		filter.Offset, err = strconv.Atoi(value)
+		if err != nil || filter.Offset < 0 {
+			e.responseWriterError(errors.New("incorrect offset"), w, http.StatusBadRequest, ctx, "")
+
+			return
+		}
+	}
+
+	users, err := e.repository.UserRepository.GetUsers(ctx, filter)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "get users error")
+
+		return
+	}
+
+	e.responseWriter(http.StatusOK, map[string]interface{}{
+		"users": users,
+	}, w, ctx)
+}
+
+// manageUser handles POST /admin/users/{id}/ban and POST /admin/users/{id}/unban.
+// A banned user loses every session and is kicked from every hub.
+func (e *Endpoint) manageUser(w http.ResponseWriter, r *http.Request) {
+	ctx := e.CreateContext(w, r)
+
+	if r.Method != http.MethodPost {
+		e.responseWriterError(errors.New("method not allowed"), w, http.StatusMethodNotAllowed, ctx, "")
+
+		return
+	}
+
+	token, status, err := e.authorize(ctx, r, models.RoleAdmin)
+	if err != nil {
+		e.responseWriterError(err, w, status, ctx, "")
+
+		return
+	}
+
+	path := strings.Split(strings.TrimPrefix(r.URL.Path, AdminUserEndpoint.ToString()), "/")
+	if len(path) != 2 {
+		e.responseWriterError(errors.New("not found"), w, http.StatusNotFound, ctx, "")
+
+		return
+	}
+
+	userID, err := strconv.ParseUint(path[0], 10, 64)
+	if err != nil || userID == 0 {
+		e.responseWriterError(errors.New("incorrect user id"), w, http.StatusBadRequest, ctx, "")
+
+		return
+	}
+
+	switch path[1] {
+	case "ban":
+		if userID == token.ID {
+			e.responseWriterError(errors.New("cannot ban yourself"), w, http.StatusBadRequest, ctx, "")
+
+			return
+		}
+
+		type request struct {
+			Reason string `json:"reason"`
+		}
+
+		var req *request
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			e.responseWriterError(err, w, http.StatusBadRequest, ctx, "read body error")
+
+			return
+		}
+
+		if len(body) != 0 {
+			err = json.Unmarshal(body, &req)
+			if err != nil {
+				e.responseWriterError(err, w, http.StatusBadRequest, ctx, "unmarshal body to struct error")
+
+				return
+			}
+		}
+
+		var reason string
+		if req != nil {
+			reason = req.Reason
+		}
+
+		err = e.repository.UserRepository.BanUser(ctx, userID, reason, e.clock.Now())
+		if err == repository.ErrUserNotFound {
+			e.responseWriterError(err, w, http.StatusNotFound, ctx, "")
+
+			return
+		} else if err != nil {
+			e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "ban user error")
+
+			return
+		}
+
+		err = e.repository.TokenRepository.RevokeUserTokenFamilies(ctx, userID, e.clock.Now())
+		if err != nil {
+			e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "revoke token error")
+
+			return
+		}
+
+		kickEverywhere(ctx, r.Header.Get("Authorization"), userID)
+	case "unban":
+		err = e.repository.UserRepository.UnbanUser(ctx, userID)
+		if err == repository.ErrUserNotFound {
+			e.responseWriterError(err, w, http.StatusNotFound, ctx, "")
+
+			return
+		} else if err != nil {
+			e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "unban user error")
+
+			return
+		}
+	default:
+		e.responseWriterError(errors.New("not found"), w, http.StatusNotFound, ctx, "")
+
+		return
+	}
+
+	e.responseWriter(http.StatusOK, map[string]interface{}{}, w, ctx)
+}
+
+// deletePack removes the pack with the hex hash from the catalog and its archive from the disk.
+func (e *Endpoint) deletePack(w http.ResponseWriter, r *http.Request) {
+	ctx := e.CreateContext(w, r)
+
+	if r.Method != http.MethodDelete {
+		e.responseWriterError(errors.New("method not allowed"), w, http.StatusMethodNotAllowed, ctx, "")
+
+		return
+	}
+
+	_, status, err := e.authorize(ctx, r, models.RoleAdmin)
+	if err != nil {
+		e.responseWriterError(err, w, status, ctx, "")
+
+		return
+	}
+
+	var hash models.PackHash
+
+	decoded, err := hex.DecodeString(strings.TrimPrefix(r.URL.Path, AdminPackEndpoint.ToString()))
+	if err != nil || len(decoded) != len(hash) {
+		e.responseWriterError(errors.New("incorrect pack hash"), w, http.StatusBadRequest, ctx, "")
+
+		return
+	}
+
+	copy(hash[:], decoded)
+
+	pack, err := e.repository.PackRepository.GetPack(ctx, hash)
+	if err == repository.ErrPackNotFound {
+		e.responseWriterError(err, w, http.StatusNotFound, ctx, "")
+
+		return
+	} else if err != nil {
+		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "get pack error")
+
+		return
+	}
+
+	err = e.repository.PackRepository.DeletePack(ctx, hash)
+	if err != nil && err != repository.ErrPackNotFound {
+		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "delete pack error")
+
+		return
+	}
+
+	err = os.Remove(e.configuration.Pack.Path + SiGameArchivesPath + "/" + pack.FileName)
+	if err != nil && !os.IsNotExist(err) {
+		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "remove pack error")
+
+		return
+	}
+
+	e.responseWriter(http.StatusOK, map[string]interface{}{}, w, ctx)
+}
@@ -0,0 +1,260 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"time"
+)
+
+const (
+	// Time given to a player to make a stake or pass.
+	stakeDuration = 15 * time.Second
+
+	// Minimal raise over the current stake.
+	stakeStep = 100
+)
+
+type StakeClientEvent struct {
+	Stake int
+	AllIn bool
+}
+
+type AuctionServerEvent struct {
+	ThemeID    int
+	QuestionID int
+	QueueID    int
+	MinStake   int
+	Stake      int
+	AllIn      bool
+}
+
+type StakeServerEvent struct {
+	QueueID int
+	Stake   int
+	AllIn   bool
+	Passed  bool
+}
+
+type AuctionResultServerEvent struct {
+	QueueID int
+	Stake   int
+	AllIn   bool
+}
+
+// auction keeps the bidding state of the current auction question.
+type auction struct {
+	minStake int
+	stake    int
+	allIn    bool
+
+	// Queue ID of the player holding the highest stake.
+	winnerID int
+	// Queue ID of the player whose turn is to stake.
+	bidderID int
+
+	passed map[int]bool
+}
+
+// startAuction opens the bidding phase for the current question, the chooser stakes first.
+func (game *Game) startAuction(quest *Question) Step {
+	game.auction = &auction{
+		minStake: quest.Price,
+		bidderID: game.currentPlayerID,
+		passed:   make(map[int]bool),
+	}
+
+	return Bidding
+}
+
+// guardBidder allows the event only from the player whose turn is to stake.
+func guardBidder(game *Game, event *ClientEvent) error {
+	if game.playersQueueIDByToken[event.Token] != game.auction.bidderID {
+		return errNotYourTurn
+	}
+
+	return nil
+}
+
+// enterBidding announces whose turn is to stake.
+func enterBidding(game *Game) {
+	a := game.auction
+
+	auctionServer := AuctionServerEvent{
+		ThemeID:    game.currentTheme,
+		QuestionID: game.currentQuestion,
+		QueueID:    a.bidderID,
+		MinStake:   a.nextMinStake(),
+		Stake:      a.stake,
+		AllIn:      a.allIn,
+	}
+
+	game.broadcastServerEvent(AuctionServer, auctionServer, game.exp())
+}
+
+func exitBidding(game *Game) {
+	game.auction = nil
+}
+
+// expireBidding stakes the nominal price for the chooser or passes for other players.
+func expireBidding(game *Game) Step {
+	var step Step
+	var err error
+
+	if game.auction.stake == 0 {
+		step, err = game.makeStake(game.auction.bidderID, game.auction.minStake, false)
+	} else {
+		step, err = game.passStake(game.auction.bidderID)
+	}
+
+	if err != nil {
+		game.logger.Error(
+			"expire bidding error",
+			zap.Error(err),
+		)
+
+		return stay
+	}
+
+	return step
+}
+
+func handleMakeStake(game *Game, event *ClientEvent) (Step, error) {
+	var clientEvent StakeClientEvent
+
+	err := json.Unmarshal(event.Data, &clientEvent)
+	if err != nil {
+		return stay, err
+	}
+
+	return game.makeStake(game.playersQueueIDByToken[event.Token], clientEvent.Stake, clientEvent.AllIn)
+}
+
+func handlePassStake(game *Game, event *ClientEvent) (Step, error) {
+	return game.passStake(game.playersQueueIDByToken[event.Token])
+}
+
+func (a *auction) nextMinStake() int {
+	if a.stake == 0 {
+		return a.minStake
+	}
+
+	return a.stake + stakeStep
+}
+
+func (game *Game) makeStake(queueID int, stake int, allIn bool) (Step, error) {
+	a := game.auction
+
+	var score int
+	if player, ok := game.playerByQueueID(queueID); ok {
+		score = player.score
+	}
+
+	if allIn {
+		if score <= a.stake || score < a.minStake {
+			return stay, errors.New("not enough score to go all-in")
+		}
+
+		stake = score
+	} else {
+		if a.allIn {
+			return stay, errors.New("only all-in or pass is allowed")
+		}
+
+		minStake := a.nextMinStake()
+		if stake < minStake {
+			return stay, fmt.Errorf("stake must be at least %d", minStake)
+		}
+
+		// a player without enough score may still stake the nominal price first
+		if stake > score && (a.stake != 0 || stake != a.minStake) {
+			return stay, errors.New("stake exceeds score")
+		}
+
+		allIn = stake == score
+	}
+
+	a.stake = stake
+	a.allIn = allIn
+	a.winnerID = queueID
+
+	stakeServer := StakeServerEvent{
+		QueueID: queueID,
+		Stake:   stake,
+		AllIn:   allIn,
+	}
+
+	game.broadcastServerEvent(StakeServer, stakeServer, 0)
+
+	return game.advanceAuction(), nil
+}
+
+func (game *Game) passStake(queueID int) (Step, error) {
+	a := game.auction
+
+	if a.stake == 0 {
+		return stay, errors.New("first stake cannot be passed")
+	}
+
+	a.passed[queueID] = true
+
+	stakeServer := StakeServerEvent{
+		QueueID: queueID,
+		Stake:   a.stake,
+		Passed:  true,
+	}
+
+	game.broadcastServerEvent(StakeServer, stakeServer, 0)
+
+	return game.advanceAuction(), nil
+}
+
+// advanceAuction passes the turn to the next player able to outbid the current stake
+// and finishes the auction when nobody is left.
+func (game *Game) advanceAuction() Step {
+	a := game.auction
+
+	count := len(game.playersTokenByQueueID)
+	for i := 1; i <= count; i++ {
+		queueID := (a.bidderID+i-1)%count + 1
+		if queueID == a.winnerID {
+			break
+		}
+
+		if a.passed[queueID] {
+			continue
+		}
+
+		player, ok := game.playerByQueueID(queueID)
+		if !ok || player.score <= a.stake {
+			a.passed[queueID] = true
+
+			continue
+		}
+
+		a.bidderID = queueID
+
+		return Bidding
+	}
+
+	return game.finishAuction()
+}
+
+// finishAuction gives the question to the auction winner, who answers for the stake.
+func (game *Game) finishAuction() Step {
+	a := game.auction
+
+	game.currentPlayerID = a.winnerID
+	game.currentPrice = a.stake
+
+	auctionResult := AuctionResultServerEvent{
+		QueueID: a.winnerID,
+		Stake:   a.stake,
+		AllIn:   a.allIn,
+	}
+
+	game.broadcastServerEvent(AuctionResultServer, auctionResult, 0)
+
+	return Answering
+}
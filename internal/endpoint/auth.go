@@ -0,0 +1,260 @@
+package endpoint
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"mygame/internal/models"
+	"mygame/internal/repository"
+	"mygame/tools/helpers"
+	"mygame/tools/jwt"
+	"net/http"
+)
+
+const (
+	// Random bytes in a session ID and in a refresh token.
+	sessionIDLength    = 16
+	refreshTokenLength = 32
+)
+
+var (
+	errTokenRevoked = errors.New("token revoked")
+	errUserBanned   = errors.New("user is banned")
+)
+
+// userRole returns the account role carried in the access tokens of the user, banned users get none.
+func (e *Endpoint) userRole(ctx context.Context, userID uint64) (string, error) {
+	if userID == 0 {
+		return models.RoleUser, nil
+	}
+
+	role, banned, err := e.repository.UserRepository.GetUserAccess(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	if banned {
+		return "", errUserBanned
+	}
+
+	return role, nil
+}
+
+// issueTokens starts a new session and returns its access and refresh tokens.
+func (e *Endpoint) issueTokens(ctx context.Context, userID uint64, login string) (string, string, error) {
+	role, err := e.userRole(ctx, userID)
+	if err != nil {
+		return "", "", err
+	}
+
+	sessionID, err := helpers.GenerateToken(sessionIDLength)
+	if err != nil {
+		return "", "", errors.New("session creation error")
+	}
+
+	refreshToken, err := helpers.GenerateToken(refreshTokenLength)
+	if err != nil {
+		return "", "", errors.New("refresh token creation error")
+	}
+
+	now := e.clock.Now()
+
+	family := &models.TokenFamily{
+		ID:        sessionID,
+		UserID:    userID,
+		Login:     login,
+		CreatedAt: now,
+	}
+
+	err = e.repository.TokenRepository.CreateTokenFamily(ctx, family, hashToken(refreshToken), now.Add(e.configuration.JWT.RefreshExpirationTime))
+	if err != nil {
+		return "", "", err
+	}
+
+	accessToken, err := jwt.GenerateTokens(ctx, userID, login, role, sessionID, e.configuration.JWT.KeySet, e.configuration.JWT.ExpirationTime)
+	if err != nil {
+		return "", "", err
+	}
+
+	return accessToken, refreshToken, nil
+}
+
+// hashToken returns the form refresh tokens are stored in, a leaked table does not give usable tokens.
+func hashToken(token string) []byte {
+	hash := sha256.Sum256([]byte(token))
+
+	return hash[:]
+}
+
+// isRevoked reports whether the session of the access token has been ended by logout or reuse detection.
+func (e *Endpoint) isRevoked(ctx context.Context, token *jwt.Claims) (bool, error) {
+	if token.SessionID == "" {
+		return false, nil
+	}
+
+	return e.repository.TokenRepository.IsTokenFamilyRevoked(ctx, token.SessionID)
+}
+
+func (e *Endpoint) authRefresh(w http.ResponseWriter, r *http.Request) {
+	ctx := e.CreateContext(w, r)
+
+	if r.Method != http.MethodPost {
+		e.responseWriterError(errors.New("method not allowed"), w, http.StatusMethodNotAllowed, ctx, "")
+
+		return
+	}
+
+	type request struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	var req *request
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusBadRequest, ctx, "read body error")
+
+		return
+	}
+
+	err = json.Unmarshal(body, &req)
+	if err != nil || req == nil || req.RefreshToken == "" {
+		e.responseWriterError(errors.New("refresh token is empty"), w, http.StatusBadRequest, ctx, "unmarshal body to struct error")
+
+		return
+	}
+
+	refreshToken, err := helpers.GenerateToken(refreshTokenLength)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "refresh token creation error")
+
+		return
+	}
+
+	now := e.clock.Now()
+
+	family, err := e.repository.TokenRepository.RotateRefreshToken(ctx, hashToken(req.RefreshToken), hashToken(refreshToken),
+		now.Add(e.configuration.JWT.RefreshExpirationTime), now)
+	switch err {
+	case nil:
+	case repository.ErrRefreshTokenNotFound, repository.ErrRefreshTokenExpired, repository.ErrRefreshTokenRevoked, repository.ErrRefreshTokenReused:
+		e.responseWriterError(err, w, http.StatusUnauthorized, ctx, "")
+
+		return
+	default:
+		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "rotate refresh token error")
+
+		return
+	}
+
+	role, err := e.userRole(ctx, family.UserID)
+	if err == errUserBanned {
+		e.responseWriterError(err, w, http.StatusForbidden, ctx, "")
+
+		return
+	} else if err != nil {
+		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "get user role error")
+
+		return
+	}
+
+	accessToken, err := jwt.GenerateTokens(ctx, family.UserID, family.Login, role, family.ID, e.configuration.JWT.KeySet,
+		e.configuration.JWT.ExpirationTime)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "generate token error")
+
+		return
+	}
+
+	e.responseWriter(http.StatusOK, map[string]interface{}{
+		"access_token":  accessToken,
+		"refresh_token": refreshToken,
+	}, w, ctx)
+}
+
+// authLogout ends the session of the refresh token, or of the access token when no refresh token is given.
+func (e *Endpoint) authLogout(w http.ResponseWriter, r *http.Request) {
+	ctx := e.CreateContext(w, r)
+
+	if r.Method != http.MethodPost {
+		e.responseWriterError(errors.New("method not allowed"), w, http.StatusMethodNotAllowed, ctx, "")
+
+		return
+	}
+
+	type request struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	var req *request
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusBadRequest, ctx, "read body error")
+
+		return
+	}
+
+	if len(body) != 0 {
+		err = json.Unmarshal(body, &req)
+		if err != nil {
+			e.responseWriterError(err, w, http.StatusBadRequest, ctx, "unmarshal body to struct error")
+
+			return
+		}
+	}
+
+	var sessionID string
+	if req != nil && req.RefreshToken != "" {
+		sessionID, err = e.repository.TokenRepository.GetFamilyIDByRefreshToken(ctx, hashToken(req.RefreshToken))
+		if err != nil {
+			e.responseWriterError(err, w, http.StatusUnauthorized, ctx, "")
+
+			return
+		}
+	} else {
+		token, err := jwt.ParseJWT(e.configuration.JWT.KeySet, r.Header.Get("Authorization"))
+		if err != nil {
+			e.responseWriterError(err, w, http.StatusUnauthorized, ctx, "parse jwt error")
+
+			return
+		}
+
+		sessionID = token.SessionID
+	}
+
+	if sessionID == "" {
+		e.responseWriterError(errors.New("token cannot be revoked"), w, http.StatusBadRequest, ctx, "")
+
+		return
+	}
+
+	err = e.repository.TokenRepository.RevokeTokenFamily(ctx, sessionID, e.clock.Now())
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "revoke token error")
+
+		return
+	}
+
+	e.responseWriter(http.StatusOK, map[string]interface{}{}, w, ctx)
+}
+
+// getJWKS publishes the public keys access tokens can be verified with by other services.
+func (e *Endpoint) getJWKS(w http.ResponseWriter, r *http.Request) {
+	ctx := e.CreateContext(w, r)
+
+	if r.Method != http.MethodGet {
+		e.responseWriterError(errors.New("method not allowed"), w, http.StatusMethodNotAllowed, ctx, "")
+
+		return
+	}
+
+	// short enough for a newly added key to be picked up before it starts signing
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	e.responseWriter(http.StatusOK, map[string]interface{}{
+		"keys": e.configuration.JWT.KeySet.PublicKeys(),
+	}, w, ctx)
+}
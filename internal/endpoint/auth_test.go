@@ -0,0 +1,131 @@
+package endpoint
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"mygame/internal/models"
+	"mygame/internal/repository"
+	"mygame/tools/jwt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// fakeTokenRepository rotates refresh tokens with rotate, the other methods are not used by the tests.
+type fakeTokenRepository struct {
+	repository.TokenRepository
+
+	rotate func(tokenHash []byte, newTokenHash []byte, expiresAt time.Time, now time.Time) (*models.TokenFamily, error)
+}
+
+func (f *fakeTokenRepository) RotateRefreshToken(_ context.Context, tokenHash []byte, newTokenHash []byte, expiresAt time.Time, now time.Time) (*models.TokenFamily, error) {
+	return f.rotate(tokenHash, newTokenHash, expiresAt, now)
+}
+
+// fakeUserRepository tells the access of the users, the other methods are not used by the tests.
+type fakeUserRepository struct {
+	repository.UserRepository
+
+	banned map[uint64]bool
+}
+
+func (f *fakeUserRepository) GetUserAccess(_ context.Context, userID uint64) (string, bool, error) {
+	return models.RoleUser, f.banned[userID], nil
+}
+
+func TestAuthRefreshRotatesToken(t *testing.T) {
+	tokens := &fakeTokenRepository{}
+	e, fake := newTestEndpoint(t, &repository.Repository{
+		TokenRepository: tokens,
+		UserRepository:  &fakeUserRepository{},
+	})
+
+	var newTokenHash []byte
+
+	tokens.rotate = func(tokenHash []byte, newHash []byte, expiresAt time.Time, now time.Time) (*models.TokenFamily, error) {
+		if !bytes.Equal(tokenHash, hashToken("old")) {
+			t.Error("refresh token is not looked up by its hash")
+		}
+
+		if !now.Equal(fake.Now()) || !expiresAt.Equal(fake.Now().Add(e.configuration.JWT.RefreshExpirationTime)) {
+			t.Errorf("rotated at %v until %v", now, expiresAt)
+		}
+
+		newTokenHash = newHash
+
+		return &models.TokenFamily{ID: "session", UserID: 7, Login: "cat"}, nil
+	}
+
+	w := e.serve(t, e.authRefresh, http.MethodPost, "/auth/refresh", `{"refresh_token": "old"}`, 0)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status is %d: %s", w.Code, w.Body)
+	}
+
+	var resp struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.RefreshToken == "" || resp.RefreshToken == "old" || !bytes.Equal(newTokenHash, hashToken(resp.RefreshToken)) {
+		t.Fatal("new refresh token is not the one stored")
+	}
+
+	claims, err := jwt.ParseJWT(e.configuration.JWT.KeySet, resp.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims.ID != 7 || claims.Login != "cat" || claims.SessionID != "session" || claims.Role != models.RoleUser {
+		t.Fatalf("claims are %+v", claims)
+	}
+}
+
+func TestAuthRefreshRejectsTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		banned bool
+		status int
+	}{
+		{name: "unknown", err: repository.ErrRefreshTokenNotFound, status: http.StatusUnauthorized},
+		{name: "expired", err: repository.ErrRefreshTokenExpired, status: http.StatusUnauthorized},
+		{name: "revoked", err: repository.ErrRefreshTokenRevoked, status: http.StatusUnauthorized},
+		{name: "reused", err: repository.ErrRefreshTokenReused, status: http.StatusUnauthorized},
+		{name: "database", err: errors.New("connection refused"), status: http.StatusInternalServerError},
+		{name: "banned", banned: true, status: http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			e, _ := newTestEndpoint(t, &repository.Repository{
+				TokenRepository: &fakeTokenRepository{
+					rotate: func([]byte, []byte, time.Time, time.Time) (*models.TokenFamily, error) {
+						if test.err != nil {
+							return nil, test.err
+						}
+
+						return &models.TokenFamily{ID: "session", UserID: 7, Login: "cat"}, nil
+					},
+				},
+				UserRepository: &fakeUserRepository{banned: map[uint64]bool{7: test.banned}},
+			})
+
+			w := e.serve(t, e.authRefresh, http.MethodPost, "/auth/refresh", `{"refresh_token": "old"}`, 0)
+			if w.Code != test.status {
+				t.Fatalf("status is %d, want %d: %s", w.Code, test.status, w.Body)
+			}
+
+			if bytes.Contains(w.Body.Bytes(), []byte("access_token")) {
+				t.Fatal("access token is issued")
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package endpoint
+
+import (
+	"errors"
+	"mygame/tools/avatar"
+	"mygame/tools/jwt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// putAvatar replaces the avatar of the user with the image in the body.
+func (e *Endpoint) putAvatar(w http.ResponseWriter, r *http.Request) {
+	ctx := e.CreateContext(w, r)
+
+	if r.Method != http.MethodPut {
+		e.responseWriterError(errors.New("method not allowed"), w, http.StatusMethodNotAllowed, ctx, "")
+
+		return
+	}
+
+	token, err := jwt.ParseJWT(e.configuration.JWT.KeySet, r.Header.Get("Authorization"))
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusUnauthorized, ctx, "parse jwt error")
+
+		return
+	}
+
+	revoked, err := e.isRevoked(ctx, token)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "check token error")
+
+		return
+	}
+
+	if revoked || token.ID == 0 {
+		e.responseWriterError(errTokenRevoked, w, http.StatusUnauthorized, ctx, "")
+
+		return
+	}
+
+	if r.ContentLength > avatar.MaxSize {
+		e.responseWriterError(avatar.ErrTooLarge, w, http.StatusRequestEntityTooLarge, ctx, "")
+
+		return
+	}
+
+	data, err := avatar.Read(r.Body)
+	if err == avatar.ErrTooLarge {
+		e.responseWriterError(err, w, http.StatusRequestEntityTooLarge, ctx, "")
+
+		return
+	} else if err != nil {
+		e.responseWriterError(err, w, http.StatusBadRequest, ctx, "read body error")
+
+		return
+	}
+
+	thumbnails, err := avatar.Thumbnails(data)
+	if err == avatar.ErrUnsupportedFormat {
+		e.responseWriterError(err, w, http.StatusUnsupportedMediaType, ctx, "")
+
+		return
+	} else if err != nil {
+		e.responseWriterError(err, w, http.StatusBadRequest, ctx, "")
+
+		return
+	}
+
+	uid, err := avatar.NewStore(e.configuration.Avatar.Path).Save(thumbnails)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "save avatar error")
+
+		return
+	}
+
+	err = e.repository.UserRepository.UpdateUserPhoto(ctx, token.ID, uid)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "update photo error")
+
+		return
+	}
+
+	e.responseWriter(http.StatusOK, map[string]interface{}{
+		"image_uid": uid,
+	}, w, ctx)
+}
+
+// getAvatar serves the thumbnail, the size is chosen with the "size" query parameter.
+// Stored avatars never change, so they are cached for as long as possible.
+func (e *Endpoint) getAvatar(w http.ResponseWriter, r *http.Request) {
+	ctx := e.CreateContext(w, r)
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		e.responseWriterError(errors.New("method not allowed"), w, http.StatusMethodNotAllowed, ctx, "")
+
+		return
+	}
+
+	uid := strings.TrimPrefix(r.URL.Path, AvatarEndpoint.ToString())
+
+	size := avatar.Sizes[0]
+	if value := r.URL.Query().Get("size"); value != "" {
+		size, _ = strconv.Atoi(value)
+	}
+
+	var known bool
+	for _, s := range avatar.Sizes {
+		known = known || s == size
+	}
+
+	if !known {
+		e.responseWriterError(errors.New("incorrect size"), w, http.StatusBadRequest, ctx, "")
+
+		return
+	}
+
+	file, err := avatar.NewStore(e.configuration.Avatar.Path).Open(uid, size)
+	if err == avatar.ErrNotFound {
+		e.responseWriterError(err, w, http.StatusNotFound, ctx, "")
+
+		return
+	} else if err != nil {
+		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "open avatar error")
+
+		return
+	}
+
+	defer file.Close()
+
+	e.setCors(w)
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("ETag", `"`+uid+"-"+strconv.Itoa(size)+`"`)
+
+	// answers If-None-Match with 304 by the ETag
+	http.ServeContent(w, r, "", time.Time{}, file)
+}
@@ -0,0 +1,138 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+)
+
+const (
+	// Time given to the chooser to hand the question to another player.
+	transferDuration = 15 * time.Second
+
+	catThemeParam = "theme"
+	catCostParam  = "cost"
+	catSelfParam  = "self"
+
+	// Values of the "self" param of bagcat questions.
+	catSelfAllowed = "true"
+	catSelfOnly    = "only"
+)
+
+type TransferQuestClientEvent struct {
+	QueueID int
+}
+
+type CatInBagServerEvent struct {
+	ThemeID    int
+	QuestionID int
+	QueueID    int
+	AllowSelf  bool
+}
+
+type TransferredQuestServerEvent struct {
+	FromQueueID int
+	QueueID     int
+	Theme       string
+	Price       int
+}
+
+// catInBag keeps the revealed theme and the fixed cost of the current "cat in a bag" question.
+type catInBag struct {
+	theme     string
+	cost      int
+	allowSelf bool
+}
+
+// startCatInBag makes the chooser hand the current question to another player.
+func (game *Game) startCatInBag(quest *Question) Step {
+	cost, err := strconv.Atoi(quest.Params[catCostParam])
+	if err != nil || cost <= 0 {
+		cost = quest.Price
+	}
+
+	theme := quest.Params[catThemeParam]
+	if theme == "" {
+		theme = game.Rounds[game.currentRound-1].Themes[game.currentTheme-1].Name
+	}
+
+	self := quest.Params[catSelfParam]
+
+	game.catInBag = &catInBag{
+		theme:     theme,
+		cost:      cost,
+		allowSelf: quest.Type == BagCat && (self == catSelfAllowed || self == catSelfOnly),
+	}
+
+	if quest.Type == BagCat && self == catSelfOnly {
+		return game.giveCatInBag(game.currentPlayerID)
+	}
+
+	return Transferring
+}
+
+func enterTransferring(game *Game) {
+	catInBagServer := CatInBagServerEvent{
+		ThemeID:    game.currentTheme,
+		QuestionID: game.currentQuestion,
+		QueueID:    game.currentPlayerID,
+		AllowSelf:  game.catInBag.allowSelf,
+	}
+
+	game.broadcastServerEvent(CatInBagServer, catInBagServer, game.exp())
+}
+
+func exitTransferring(game *Game) {
+	game.catInBag = nil
+}
+
+// expireTransferring gives the question to the player next to the chooser when the chooser has not decided in time.
+func expireTransferring(game *Game) Step {
+	count := len(game.playersTokenByQueueID)
+	for i := 1; i < count; i++ {
+		queueID := (game.currentPlayerID+i-1)%count + 1
+
+		if _, ok := game.playerByQueueID(queueID); ok {
+			return game.giveCatInBag(queueID)
+		}
+	}
+
+	return game.giveCatInBag(game.currentPlayerID)
+}
+
+func handleTransferQuest(game *Game, event *ClientEvent) (Step, error) {
+	var clientEvent TransferQuestClientEvent
+
+	err := json.Unmarshal(event.Data, &clientEvent)
+	if err != nil {
+		return stay, err
+	}
+
+	if _, ok := game.playerByQueueID(clientEvent.QueueID); !ok {
+		return stay, errors.New("incorrect player")
+	}
+
+	if clientEvent.QueueID == game.currentPlayerID && !game.catInBag.allowSelf {
+		return stay, errors.New("question must be transferred to another player")
+	}
+
+	return game.giveCatInBag(clientEvent.QueueID), nil
+}
+
+// giveCatInBag lets the receiver answer the question for the fixed cost without a buzzer race.
+func (game *Game) giveCatInBag(queueID int) Step {
+	transferred := TransferredQuestServerEvent{
+		FromQueueID: game.currentPlayerID,
+		QueueID:     queueID,
+		Theme:       game.catInBag.theme,
+		Price:       game.catInBag.cost,
+	}
+
+	game.currentPlayerID = queueID
+	game.currentPrice = game.catInBag.cost
+
+	game.broadcastServerEvent(TransferredQuestServer, transferred, 0)
+
+	return Answering
+}
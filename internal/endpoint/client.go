@@ -2,6 +2,7 @@ package endpoint
 
 import (
 	"context"
+	"encoding/hex"
 	"encoding/json"
 	"go.uber.org/zap"
 	"log"
@@ -10,6 +11,8 @@ import (
 	"mygame/tools/helpers"
 	"mygame/tools/jwt"
 	"net/http"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -27,6 +30,9 @@ const (
 
 	// Maximum message size allowed from peer.
 	maxMessageSize = 512
+
+	// Time allowed to save the history of a finished game.
+	saveGameTimeout = 10 * time.Second
 )
 
 var (
@@ -44,18 +50,30 @@ type Role int
 const (
 	User Role = iota
 	Leader
+	// Spectator watches the game and cannot send game events.
+	Spectator
 )
 
 // Client is a middleman between the websocket connection and the hub.
 type Client struct {
 	hub *Hub
 
-	id uint64
+	id    uint64
+	login string
 
 	token string
 
 	role Role
 
+	// Avatar of the user, empty if there is none.
+	imageUID string
+
+	// Set by the hub when the same user has connected again.
+	replaced bool
+
+	// Set when the send channel is closed, guarded by the mutex of the hub.
+	closed bool
+
 	// The websocket connection.
 	conn *websocket.Conn
 
@@ -65,7 +83,11 @@ type Client struct {
 
 func (c *Client) readPump() {
 	defer func() {
-		c.hub.unregister <- c
+		select {
+		case c.hub.unregister <- c:
+		case <-c.hub.close:
+		}
+
 		c.conn.Close()
 	}()
 	c.conn.SetReadLimit(maxMessageSize)
@@ -108,7 +130,11 @@ func (c *Client) readPump() {
 			continue
 		}
 
-		c.hub.game.eventChannel <- event
+		select {
+		case c.hub.game.eventChannel <- event:
+		case <-c.hub.close:
+			return
+		}
 	}
 }
 
@@ -161,7 +187,6 @@ func (e *Endpoint) serveWs(w http.ResponseWriter, r *http.Request) {
 	//requestToken := ctx.Value(RequestTokenContext).(string)
 
 	ctx = context.WithValue(ctx, "JWT_KEY", e.configuration.JWT.SecretKey)
-	ctx = context.WithValue(ctx, "PACKS_PATH", e.configuration.Pack.Path)
 
 	///example how to use logger
 	logger := ctx.Value(LoggerContext).(*zap.Logger)
@@ -185,7 +210,7 @@ func (e *Endpoint) serveWs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := jwt.ParseJWT([]byte(e.configuration.JWT.SecretKey), accessToken)
+	token, err := jwt.ParseJWT(e.configuration.JWT.KeySet, accessToken)
 	if err != nil {
 		conn.WriteMessage(1, []byte("token parse error "+err.Error()))
 		conn.Close()
@@ -200,6 +225,21 @@ func (e *Endpoint) serveWs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	revoked, err := e.isRevoked(r.Context(), token)
+	if err != nil || revoked {
+		conn.WriteMessage(1, []byte(errTokenRevoked.Error()))
+		conn.Close()
+
+		return
+	}
+
+	if _, err = e.userRole(r.Context(), token.ID); err != nil {
+		conn.WriteMessage(1, []byte(err.Error()))
+		conn.Close()
+
+		return
+	}
+
 	var createGame models.CreateGame
 	var joinGame models.JoinGame
 
@@ -222,6 +262,7 @@ func (e *Endpoint) serveWs(w http.ResponseWriter, r *http.Request) {
 
 	var hub *Hub
 	var role Role
+	var returning bool
 	if connectType.Type == "create" {
 		err = json.Unmarshal(connectType.Data, &createGame)
 		if err != nil {
@@ -236,47 +277,131 @@ func (e *Endpoint) serveWs(w http.ResponseWriter, r *http.Request) {
 			conn.Close()
 
 			return
-		} else if createGame.Password == "" {
-			conn.WriteMessage(1, []byte("invalid password"))
+		} else if createGame.MaxPlayers < 1 || createGame.MaxPlayers > 8 {
+			conn.WriteMessage(1, []byte("incorrect players count"))
 			conn.Close()
 
 			return
-		} else if createGame.MaxPlayers < 1 || createGame.MaxPlayers > 8 {
-			conn.WriteMessage(1, []byte("incorrect players count"))
+		} else if createGame.MaxSpectators < 0 || createGame.MaxSpectators > e.configuration.Hub.MaxSpectators {
+			conn.WriteMessage(1, []byte("incorrect spectators count"))
 			conn.Close()
 
 			return
 		}
 
-		parser := NewParser(ctx.Value("PACKS_PATH").(string))
+		pack, err := e.repository.PackRepository.GetPack(r.Context(), createGame.PackUID)
+		if err != nil {
+			conn.WriteMessage(1, []byte("pack not found"))
+			conn.Close()
 
-		err = parser.ParsingSiGamePack(string(createGame.PackUID[:]) + ".zip")
+			return
+		}
+
+		// hubs playing the same pack share the unpacked copy
+		packDir := hex.EncodeToString(pack.Hash[:])
+		packPath := e.configuration.PackTemporary.Path + "/" + packDir
+
+		err = singleton.AcquireTemporaryPack(pack.Hash, func() error {
+			err := helpers.Unzip(e.configuration.Pack.Path+SiGameArchivesPath+"/"+pack.FileName, packPath)
+			if err != nil {
+				os.RemoveAll(packPath)
+			}
+
+			return err
+		})
 		if err != nil {
+			conn.WriteMessage(1, []byte("internal error: cannot unzip pack archive"))
+			conn.Close()
+
+			return
+		}
+
+		releasePack := func() {
+			err := singleton.ReleaseTemporaryPack(pack.Hash, func() error {
+				forgetPackMedia(packPath)
+
+				return os.RemoveAll(packPath)
+			})
+			if err != nil {
+				logger.Error(
+					"remove temporary pack error",
+					zap.Error(err),
+				)
+			}
+		}
+
+		parser := NewParser(e.configuration.PackTemporary.Path)
+
+		err = parser.ParsingSiGamePack(packDir)
+		if err != nil {
+			releasePack()
 			conn.WriteMessage(1, []byte("invalid parsing si game pack"))
 			conn.Close()
+
+			return
 		}
 
 		err = parser.InitMyGame()
 		if err != nil {
+			releasePack()
 			conn.WriteMessage(1, []byte("invalid init si game pack"))
 			conn.Close()
+
+			return
 		}
 
 		game := parser.GetMyGame()
 
-		err := helpers.Unzip(e.configuration.Pack.Path+"/"+string(createGame.PackUID[:])+".zip", e.configuration.PackTemporary.Path+"/"+string(createGame.PackUID[:]))
+		err = buildRoundManifests(game, packPath)
 		if err != nil {
-			conn.WriteMessage(1, []byte("internal error: cannot unzip pack archive"))
+			releasePack()
+			conn.WriteMessage(1, []byte("internal error: cannot read pack media"))
 			conn.Close()
+
+			return
 		}
 
-		singleton.IncTemporaryPack(createGame.PackUID)
+		game.UID = createGame.PackUID
+		game.onClose = func(result *models.GameResult) {
+			releasePack()
+
+			if result == nil {
+				return
+			}
+
+			// the request context is gone by the time the game is over
+			saveCtx, cancel := context.WithTimeout(context.Background(), saveGameTimeout)
+			defer cancel()
+
+			_, err := e.repository.GameRepository.SaveGame(saveCtx, result)
+			if err != nil {
+				logger.Error(
+					"save game error",
+					zap.Error(err),
+				)
+
+				return
+			}
+
+			err = e.rateGame(saveCtx, result)
+			if err != nil {
+				logger.Error(
+					"rate game error",
+					zap.Error(err),
+				)
+			}
+		}
 
-		hub = registerHub(ctx, game, e.configuration)
+		hub = newHub(game, e.configuration, e.clock)
 
 		hub.opts.Name = createGame.Name
 		hub.opts.Password = createGame.Password
 		hub.opts.MaxPlayers = createGame.MaxPlayers
+		hub.opts.MaxSpectators = createGame.MaxSpectators
+		hub.leaderID = token.ID
+		hub.leaderLogin = token.Login
+
+		registerHub(ctx, hub)
 		// todo: parsing pack
 		role = Leader
 	} else if connectType.Type == "join" {
@@ -288,7 +413,26 @@ func (e *Endpoint) serveWs(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		foundHub, ok := hubs[joinGame.HubID]
+		var foundHub *Hub
+		var ok, invited bool
+		if joinGame.InviteCode != "" {
+			foundHub, ok = findHubByInviteCode(strings.ToUpper(joinGame.InviteCode))
+			invited = true
+		} else if joinGame.Invite != "" {
+			invite, err := jwt.ParseInviteJWT(e.configuration.JWT.KeySet, joinGame.Invite)
+			if err != nil {
+				conn.WriteMessage(1, []byte("invalid invite"))
+				conn.Close()
+
+				return
+			}
+
+			foundHub, ok = findHub(invite.HubID)
+			invited = true
+		} else {
+			foundHub, ok = findHub(joinGame.HubID)
+		}
+
 		if !ok {
 			conn.WriteMessage(1, []byte("incorrect hub id"))
 			conn.Close()
@@ -298,6 +442,33 @@ func (e *Endpoint) serveWs(w http.ResponseWriter, r *http.Request) {
 
 		hub = foundHub
 		role = User
+
+		if token.ID != 0 && hub.isKicked(token.ID) {
+			conn.WriteMessage(1, []byte("you are kicked from the hub"))
+			conn.Close()
+
+			return
+		}
+
+		// the leader connects again to the hub the same way players do
+		if token.ID != 0 && token.ID == hub.leaderID {
+			role = Leader
+		} else if joinGame.Spectate {
+			role = Spectator
+		}
+
+		// a player coming back within the grace period keeps the seat whoever has joined meanwhile
+		returning = role == User && token.ID != 0 && hub.isReturning(token.ID)
+
+		if role != Leader && !invited && !returning {
+			err = hub.checkPassword(remoteHost(r), joinGame.Password)
+			if err != nil {
+				conn.WriteMessage(1, []byte(err.Error()))
+				conn.Close()
+
+				return
+			}
+		}
 	} else {
 		conn.WriteMessage(1, []byte("incorrect connect type"))
 		conn.Close()
@@ -305,15 +476,40 @@ func (e *Endpoint) serveWs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if hub.opts.MaxPlayers == len(hub.clients)-1 {
+	if role == User && !returning && hub.countClients(User) >= hub.opts.MaxPlayers {
 		conn.WriteMessage(1, []byte("players limit reached"))
 		conn.Close()
 
 		return
 	}
 
-	client := &Client{hub: hub, conn: conn, send: make(chan []byte, 256), token: accessToken, role: role, id: token.ID}
-	client.hub.register <- client
+	if role == Spectator && hub.countClients(Spectator) >= hub.opts.MaxSpectators {
+		conn.WriteMessage(1, []byte("spectators limit reached"))
+		conn.Close()
+
+		return
+	}
+
+	client := &Client{hub: hub, conn: conn, send: make(chan []byte, 256), token: accessToken, role: role, id: token.ID, login: token.Login}
+
+	if token.ID != 0 {
+		client.imageUID, err = e.repository.UserRepository.GetUserPhoto(ctx, token.ID)
+		if err != nil {
+			logger.Error(
+				"get user photo error",
+				zap.Error(err),
+			)
+		}
+	}
+
+	select {
+	case client.hub.register <- client:
+	case <-client.hub.close:
+		conn.WriteMessage(1, []byte("game is over"))
+		conn.Close()
+
+		return
+	}
 
 	// Allow collection of memory referenced by the caller by doing all work in
 	// new goroutines.
@@ -1,21 +1,19 @@
 package endpoint
 
 import (
-	"bytes"
 	"context"
-	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/jmoiron/sqlx"
 	"go.uber.org/zap"
-	"io"
 	"io/ioutil"
 	"mygame/config"
+	"mygame/dependers/mailer"
 	"mygame/dependers/monitoring"
 	"mygame/internal/models"
 	"mygame/internal/repository"
-	"mygame/internal/singleton"
+	"mygame/tools/clock"
 	"mygame/tools/helpers"
 	"mygame/tools/jwt"
 	"net/http"
@@ -47,15 +45,38 @@ func (g GameType) ToString() string {
 type EndpointType string
 
 const (
-	HubEndpoint             EndpointType = "/hub"
-	AuthCredentialsEndpoint EndpointType = "/auth/credentials"
-	AuthAccessEndpoint      EndpointType = "/auth/access"
-	AuthGuest               EndpointType = "/auth/guest"
-	GetLoginEndpoint        EndpointType = "/get/login/"
-	RegisterEndpoint        EndpointType = "/register"
-	PackUploadEndpoint      EndpointType = "/pack/upload"
-	GetPacksEndpoint        EndpointType = "/get/packs"
-	GetPackInfoEndpoint     EndpointType = "/get/pack/info"
+	HubEndpoint               EndpointType = "/hub"
+	HubsEndpoint              EndpointType = "/hubs"
+	HubInfoEndpoint           EndpointType = "/hubs/"
+	GamesEndpoint             EndpointType = "/games"
+	GameEndpoint              EndpointType = "/games/"
+	LeaderboardEndpoint       EndpointType = "/leaderboard"
+	RatingEndpoint            EndpointType = "/ratings/"
+	AuthCredentialsEndpoint   EndpointType = "/auth/credentials"
+	AuthAccessEndpoint        EndpointType = "/auth/access"
+	AuthGuest                 EndpointType = "/auth/guest"
+	AuthRefreshEndpoint       EndpointType = "/auth/refresh"
+	AuthLogoutEndpoint        EndpointType = "/auth/logout"
+	JWKSEndpoint              EndpointType = "/.well-known/jwks.json"
+	GetLoginEndpoint          EndpointType = "/get/login/"
+	RegisterEndpoint          EndpointType = "/register"
+	RegisterGuestEndpoint     EndpointType = "/register/guest"
+	EmailVerificationEndpoint EndpointType = "/email/verification"
+	EmailVerifyEndpoint       EndpointType = "/email/verify"
+	PasswordForgotEndpoint    EndpointType = "/password/forgot"
+	PasswordResetEndpoint     EndpointType = "/password/reset"
+	MyAvatarEndpoint          EndpointType = "/me/avatar"
+	AvatarEndpoint            EndpointType = "/avatars/"
+	AdminUsersEndpoint        EndpointType = "/admin/users"
+	AdminUserEndpoint         EndpointType = "/admin/users/"
+	AdminPackEndpoint         EndpointType = "/admin/packs/"
+	ModerationHubEndpoint     EndpointType = "/moderation/hubs/"
+	PackUploadEndpoint        EndpointType = "/pack/upload"
+	PackUploadsEndpoint       EndpointType = "/pack/uploads"
+	PackUploadSessionEndpoint EndpointType = "/pack/uploads/"
+	PackValidateEndpoint      EndpointType = "/pack/validate"
+	GetPacksEndpoint          EndpointType = "/get/packs"
+	GetPackInfoEndpoint       EndpointType = "/get/pack/info"
 )
 
 func (e EndpointType) ToString() string {
@@ -77,14 +98,31 @@ type Endpoint struct {
 	configuration *config.Config
 	logger        *zap.Logger
 	monitoring    monitoring.IMonitoring
+	mailer        mailer.IMailer
+	clock         clock.Clock
+
+	// Password reset requests by address.
+	resetAttempts *attemptLimiter
+	// Guests created by address.
+	guestAttempts *attemptLimiter
+
+	// Resumable pack uploads by id.
+	uploads *packUploads
 }
 
-func NewEndpoint(db *sqlx.DB, config *config.Config, logger *zap.Logger, monitoring monitoring.IMonitoring) *Endpoint {
+func NewEndpoint(db *sqlx.DB, config *config.Config, logger *zap.Logger, monitoring monitoring.IMonitoring, mailer mailer.IMailer) *Endpoint {
+	clock := clock.New()
+
 	return &Endpoint{
 		repository:    repository.NewRepository(db),
 		configuration: config,
 		logger:        logger,
 		monitoring:    monitoring,
+		mailer:        mailer,
+		clock:         clock,
+		resetAttempts: newAttemptLimiter(clock, maxPasswordAttempts, passwordAttemptWindow),
+		guestAttempts: newAttemptLimiter(clock, maxGuestsPerAddress, guestAttemptWindow),
+		uploads:       newPackUploads(clock),
 	}
 }
 
@@ -92,10 +130,33 @@ func (e *Endpoint) InitRoutes() {
 	http.HandleFunc(AuthCredentialsEndpoint.ToString(), e.authCredentials)
 	http.HandleFunc(AuthAccessEndpoint.ToString(), e.authAccessToken)
 	http.HandleFunc(AuthGuest.ToString(), e.authGuest)
+	http.HandleFunc(AuthRefreshEndpoint.ToString(), e.authRefresh)
+	http.HandleFunc(AuthLogoutEndpoint.ToString(), e.authLogout)
+	http.HandleFunc(JWKSEndpoint.ToString(), e.getJWKS)
 	http.HandleFunc(GetLoginEndpoint.ToString(), e.getLoginFromAccessToken)
 	http.HandleFunc(RegisterEndpoint.ToString(), e.createUser)
+	http.HandleFunc(RegisterGuestEndpoint.ToString(), e.registerGuest)
+	http.HandleFunc(EmailVerificationEndpoint.ToString(), e.sendEmailVerification)
+	http.HandleFunc(EmailVerifyEndpoint.ToString(), e.verifyEmail)
+	http.HandleFunc(PasswordForgotEndpoint.ToString(), e.forgotPassword)
+	http.HandleFunc(PasswordResetEndpoint.ToString(), e.resetPassword)
+	http.HandleFunc(MyAvatarEndpoint.ToString(), e.putAvatar)
+	http.HandleFunc(AvatarEndpoint.ToString(), e.getAvatar)
+	http.HandleFunc(AdminUsersEndpoint.ToString(), e.getUsers)
+	http.HandleFunc(AdminUserEndpoint.ToString(), e.manageUser)
+	http.HandleFunc(AdminPackEndpoint.ToString(), e.deletePack)
+	http.HandleFunc(ModerationHubEndpoint.ToString(), e.moderateHub)
 	http.HandleFunc(HubEndpoint.ToString(), e.serveWs)
+	http.HandleFunc(HubsEndpoint.ToString(), e.getHubs)
+	http.HandleFunc(HubInfoEndpoint.ToString(), e.getHub)
+	http.HandleFunc(GamesEndpoint.ToString(), e.getGames)
+	http.HandleFunc(GameEndpoint.ToString(), e.getGame)
+	http.HandleFunc(LeaderboardEndpoint.ToString(), e.getLeaderboard)
+	http.HandleFunc(RatingEndpoint.ToString(), e.getRatingHistory)
 	http.HandleFunc(PackUploadEndpoint.ToString(), e.saveSiGamePack)
+	http.HandleFunc(PackUploadsEndpoint.ToString(), e.createPackUpload)
+	http.HandleFunc(PackUploadSessionEndpoint.ToString(), e.packUpload)
+	http.HandleFunc(PackValidateEndpoint.ToString(), e.validateSiGamePack)
 	http.HandleFunc(GetPacksEndpoint.ToString(), e.getPacks)
 	http.HandleFunc(GetPackInfoEndpoint.ToString(), e.getPackInfo)
 }
@@ -103,16 +164,21 @@ func (e *Endpoint) InitRoutes() {
 func (e *Endpoint) CreateContext(w http.ResponseWriter, r *http.Request) context.Context {
 	requestToken := r.Header.Get(RequestTokenHeader)
 
-	endpointName := EndpointType(r.URL.RequestURI()).ToString()
+	// the route pattern keeps ids out of the metric labels and the query, that may carry tokens, out of the logs
+	_, endpointName := http.DefaultServeMux.Handler(r)
+	if endpointName == "" {
+		endpointName = EndpointType(r.URL.Path).ToString()
+	}
 
 	logger := e.logger.With(
 		zap.String("endpoint", endpointName),
+		zap.String("path", r.URL.Path),
 		zap.String("request_token", requestToken),
 	)
 
 	var ctx = context.WithValue(r.Context(), RequestTokenContext, requestToken)
-	ctx = context.WithValue(r.Context(), LoggerContext, logger)
-	ctx = context.WithValue(r.Context(), EndpointContext, endpointName)
+	ctx = context.WithValue(ctx, LoggerContext, logger)
+	ctx = context.WithValue(ctx, EndpointContext, endpointName)
 
 	if r.Method == "OPTIONS" {
 		e.responseWriter(http.StatusOK, map[string]interface{}{}, w, ctx)
@@ -188,40 +254,21 @@ func (e *Endpoint) getPacks(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	packs := singleton.GetPacks()
-
-	type pack struct {
-		Name string   `json:"name"`
-		Hash [32]byte `json:"hash"`
-	}
-
-	packsResponse := make([]*pack, 0, len(packs))
+	if req.Limit < 0 || req.Offset < 0 {
+		e.responseWriterError(errors.New("incorrect limit or offset"), w, http.StatusBadRequest, ctx, "")
 
-	for hash, name := range packs {
-		packsResponse = append(packsResponse, &pack{
-			Name: name,
-			Hash: hash,
-		})
+		return
 	}
 
-	if req.Offset != 0 || req.Limit != 0 {
-		if len(packsResponse) <= req.Offset {
-			e.responseWriter(http.StatusOK, map[string]interface{}{
-				"packs": "",
-			}, w, ctx)
-
-			return
-		}
-
-		if req.Offset+req.Limit-1 > len(packsResponse) {
-			req.Limit = len(packsResponse)
-		}
+	packs, err := e.repository.PackRepository.GetPacks(ctx, req.Limit, req.Offset)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "get packs error")
 
-		packsResponse = packsResponse[req.Offset : req.Offset+req.Limit]
+		return
 	}
 
 	e.responseWriter(http.StatusOK, map[string]interface{}{
-		"packs": packsResponse,
+		"packs": packs,
 	}, w, ctx)
 }
 
@@ -242,7 +289,7 @@ func (e *Endpoint) getPackInfo(w http.ResponseWriter, r *http.Request) {
 	}
 
 	type request struct {
-		Hash [32]byte `json:"hash"`
+		Hash models.PackHash `json:"hash"`
 	}
 
 	var req *request
@@ -254,45 +301,23 @@ func (e *Endpoint) getPackInfo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	packName := singleton.GetPack(req.Hash)
-
-	err = helpers.Unzip(e.configuration.Pack.Path+SiGameArchivesPath+"/"+packName,
-		e.configuration.PackTemporary.Path+"/"+packName)
-	if err != nil {
-		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "Unzip pack error")
-
-		return
-	}
-
-	parser := NewParser(e.configuration.PackTemporary.Path)
-
-	err = parser.ParsingSiGamePack(packName)
-	if err != nil {
-		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "parsing si game pack error")
+	pack, err := e.repository.PackRepository.GetPack(ctx, req.Hash)
+	if err == repository.ErrPackNotFound {
+		e.responseWriterError(err, w, http.StatusNotFound, ctx, "")
 
 		return
-	}
-
-	err = parser.InitMyGame()
-	if err != nil {
-		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "init my game error")
+	} else if err != nil {
+		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "get pack error")
 
 		return
 	}
 
-	pack := parser.GetMyGame()
-
-	for _, round := range pack.Rounds {
-		for _, theme := range round.Themes {
-			theme.Quests = []*Question{}
-		}
-	}
-
 	e.responseWriter(http.StatusOK, map[string]interface{}{
 		"pack_info": pack,
 	}, w, ctx)
 }
 
+// saveSiGamePack streams the pack from the multipart form to a temporary file, hashing it on the way.
 func (e *Endpoint) saveSiGamePack(w http.ResponseWriter, r *http.Request) {
 	ctx := e.CreateContext(w, r)
 
@@ -302,56 +327,31 @@ func (e *Endpoint) saveSiGamePack(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	multipartFile, fileHeader, err := r.FormFile(SiGame.ToString())
+	token, status, err := e.authorize(ctx, r)
 	if err != nil {
-		e.responseWriterError(err, w, http.StatusBadRequest, ctx, "get data from form file error")
+		e.responseWriterError(err, w, status, ctx, "")
 
 		return
 	}
 
-	_, err = jwt.ParseJWT([]byte(e.configuration.JWT.SecretKey), r.Header.Get("Authorization"))
+	part, err := packFormPart(r)
 	if err != nil {
-		e.responseWriterError(err, w, http.StatusUnauthorized, ctx, "parse jwt error")
+		e.responseWriterError(err, w, http.StatusBadRequest, ctx, "get data from form file error")
 
 		return
 	}
 
-	if fileHeader.Size > MaxPackSize {
-		e.responseWriterError(err, w, http.StatusBadRequest, ctx, "file size > 150 MB")
-
-		return
+	path, pack, status, err := e.receiveArchive(part, part.FileName(), token.ID)
+	if path != "" {
+		defer os.Remove(path)
 	}
-
-	buf := bytes.NewBuffer(nil)
-	if _, err = io.Copy(buf, multipartFile); err != nil {
-		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "io copy error")
+	if err != nil {
+		e.responseWriterError(err, w, status, ctx, "receive pack error")
 
 		return
 	}
 
-	hash := sha256.Sum256(buf.Bytes())
-
-	ok := singleton.IsExistPack(hash)
-	if !ok {
-		singleton.AddPack(hash, fileHeader.Filename)
-
-		file, err := os.Create(e.configuration.Pack.Path + SiGameArchivesPath + "/" + fileHeader.Filename + ToArchiveType)
-		if err != nil {
-			e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "save file error")
-
-			return
-		}
-
-		if _, err = io.Copy(file, buf); err != nil {
-			e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "io copy error")
-
-			return
-		}
-	}
-
-	e.responseWriter(http.StatusOK, map[string]interface{}{}, w, ctx)
-
-	return
+	e.writeStoredPack(ctx, w, path, pack)
 }
 
 func (e *Endpoint) authCredentials(w http.ResponseWriter, r *http.Request) {
@@ -392,32 +392,45 @@ func (e *Endpoint) authCredentials(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	hashPassword, err := helpers.NewMD5Hash(credentials.Password)
+	id, hashPassword, err := e.repository.UserRepository.GetUserPasswordByLogin(ctx, credentials.Login)
 	if err != nil {
-		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "hash password error")
+		e.responseWriterError(err, w, http.StatusUnauthorized, ctx, "user does not exist")
 
 		return
 	}
 
-	credentials.Password = hashPassword
-
-	id, err := e.repository.UserRepository.GetUserByCredentials(ctx, credentials)
+	ok, needsUpgrade, err := helpers.VerifyPassword(hashPassword, credentials.Password)
 	if err != nil {
-		e.responseWriterError(err, w, http.StatusUnauthorized, ctx, "hash password error")
+		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "verify password error")
 
 		return
 	}
 
-	token, err := jwt.GenerateTokens(ctx, id, credentials.Login, e.configuration.JWT.SecretKey,
-		e.configuration.JWT.ExpirationTime)
-	if err != nil {
+	if !ok {
+		e.responseWriterError(errors.New("login or password incorrect"), w, http.StatusUnauthorized, ctx, "")
+
+		return
+	}
+
+	// legacy and outdated hashes are replaced while the plain password is at hand
+	if needsUpgrade {
+		e.upgradePassword(ctx, id, credentials.Password)
+	}
+
+	token, refreshToken, err := e.issueTokens(ctx, id, credentials.Login)
+	if err == errUserBanned {
+		e.responseWriterError(err, w, http.StatusForbidden, ctx, "")
+
+		return
+	} else if err != nil {
 		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "generate token error")
 
 		return
 	}
 
 	e.responseWriter(http.StatusOK, map[string]interface{}{
-		"access_token": token,
+		"access_token":  token,
+		"refresh_token": refreshToken,
 	}, w, ctx)
 
 	return
@@ -452,7 +465,7 @@ func (e *Endpoint) authAccessToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := jwt.ParseJWT([]byte(e.configuration.JWT.SecretKey), req.AccessToken)
+	token, err := jwt.ParseJWT(e.configuration.JWT.KeySet, req.AccessToken)
 	if err != nil {
 		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "parse jwt error")
 
@@ -465,6 +478,19 @@ func (e *Endpoint) authAccessToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	revoked, err := e.isRevoked(ctx, token)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "check token error")
+
+		return
+	}
+
+	if revoked {
+		e.responseWriterError(errTokenRevoked, w, http.StatusUnauthorized, ctx, "")
+
+		return
+	}
+
 	e.responseWriter(http.StatusOK, map[string]interface{}{}, w, ctx)
 
 	return
@@ -499,7 +525,24 @@ func (e *Endpoint) authGuest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := jwt.GenerateTokens(ctx, 0, req.Login, e.configuration.JWT.SecretKey, e.configuration.JWT.ExpirationTime)
+	address := remoteHost(r)
+
+	if !e.guestAttempts.allowed(address) {
+		e.responseWriterError(errTooManyAttempts, w, http.StatusTooManyRequests, ctx, "")
+
+		return
+	}
+
+	e.guestAttempts.fail(address)
+
+	id, login, err := e.createGuest(ctx, req.Login)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "create guest error")
+
+		return
+	}
+
+	token, refreshToken, err := e.issueTokens(ctx, id, login)
 	if err != nil {
 		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "generate token error")
 
@@ -507,7 +550,9 @@ func (e *Endpoint) authGuest(w http.ResponseWriter, r *http.Request) {
 	}
 
 	e.responseWriter(http.StatusOK, map[string]interface{}{
-		"access_token": token,
+		"access_token":  token,
+		"refresh_token": refreshToken,
+		"login":         login,
 	}, w, ctx)
 
 	return
@@ -542,7 +587,7 @@ func (e *Endpoint) getLoginFromAccessToken(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	token, err := jwt.ParseJWT([]byte(e.configuration.JWT.SecretKey), req.AccessToken)
+	token, err := jwt.ParseJWT(e.configuration.JWT.KeySet, req.AccessToken)
 	if err != nil {
 		e.responseWriterError(err, w, http.StatusUnauthorized, ctx, "parse jwt error")
 
@@ -555,6 +600,19 @@ func (e *Endpoint) getLoginFromAccessToken(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	revoked, err := e.isRevoked(ctx, token)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "check token error")
+
+		return
+	}
+
+	if revoked {
+		e.responseWriterError(errTokenRevoked, w, http.StatusUnauthorized, ctx, "")
+
+		return
+	}
+
 	e.responseWriter(http.StatusOK, map[string]interface{}{
 		"login": token.Login,
 	}, w, ctx)
@@ -581,19 +639,26 @@ func (e *Endpoint) createUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	err = json.Unmarshal(body, &user)
+	if err != nil || user == nil {
+		e.responseWriterError(errors.New("incorrect user"), w, http.StatusBadRequest, ctx, "unmarshal body to struct error")
+
+		return
+	}
+
+	err = user.Validate()
 	if err != nil {
-		e.responseWriterError(err, w, http.StatusBadRequest, ctx, "unmarshal body to struct error")
+		e.responseWriterError(err, w, http.StatusBadRequest, ctx, "")
 
 		return
 	}
 
 	if e.repository.UserRepository.IsExistByLogin(ctx, user.Login) {
-		e.responseWriterError(err, w, http.StatusBadRequest, ctx, "user does not exist")
+		e.responseWriterError(repository.ErrLoginTaken, w, http.StatusBadRequest, ctx, "user does not exist")
 
 		return
 	}
 
-	hashPassword, err := helpers.NewMD5Hash(user.Password)
+	hashPassword, err := helpers.HashPassword(user.Password)
 	if err != nil {
 		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "hash password error")
 
@@ -603,13 +668,21 @@ func (e *Endpoint) createUser(w http.ResponseWriter, r *http.Request) {
 	user.Password = hashPassword
 
 	id, err := e.repository.UserRepository.CreateUser(ctx, user)
-	if err != nil {
+	if err == repository.ErrLoginTaken || err == repository.ErrEmailTaken {
+		e.responseWriterError(err, w, http.StatusBadRequest, ctx, "")
+
+		return
+	} else if err != nil {
 		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "create user error")
 
 		return
 	}
 
-	token, err := jwt.GenerateTokens(ctx, id, user.Login, e.configuration.JWT.SecretKey, e.configuration.JWT.ExpirationTime)
+	if user.Email != "" {
+		e.sendVerification(ctx, id, user.Email)
+	}
+
+	token, refreshToken, err := e.issueTokens(ctx, id, user.Login)
 	if err != nil {
 		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "parse jwt error")
 
@@ -617,8 +690,31 @@ func (e *Endpoint) createUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	e.responseWriter(http.StatusOK, map[string]interface{}{
-		"access_token": token,
+		"access_token":  token,
+		"refresh_token": refreshToken,
 	}, w, ctx)
 
 	return
 }
+
+func (e *Endpoint) upgradePassword(ctx context.Context, userID uint64, password string) {
+	logger := ctx.Value(LoggerContext).(*zap.Logger)
+
+	hashPassword, err := helpers.HashPassword(password)
+	if err != nil {
+		logger.Error(
+			"hash password error",
+			zap.Error(err),
+		)
+
+		return
+	}
+
+	err = e.repository.UserRepository.UpdateUserPassword(ctx, userID, hashPassword)
+	if err != nil {
+		logger.Error(
+			"upgrade password error",
+			zap.Error(err),
+		)
+	}
+}
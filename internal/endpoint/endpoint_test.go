@@ -0,0 +1,88 @@
+package endpoint
+
+import (
+	"go.uber.org/zap"
+	"mygame/config"
+	"mygame/dependers/monitoring"
+	"mygame/internal/repository"
+	"mygame/tools/clock"
+	"mygame/tools/jwt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type nopMonitoring struct{}
+
+func (nopMonitoring) Counter(*monitoring.Metric, float64) error { return nil }
+
+func (nopMonitoring) Inc(*monitoring.Metric) error { return nil }
+
+func (nopMonitoring) ExecutionTime(_ *monitoring.Metric, f func() error) (float64, error) {
+	return 0, f()
+}
+
+func (nopMonitoring) ObserveExecutionTime(*monitoring.Metric, time.Duration) error { return nil }
+
+func (nopMonitoring) Gauge(*monitoring.Metric, float64) error { return nil }
+
+func (nopMonitoring) IncGauge(*monitoring.Metric) error { return nil }
+
+func (nopMonitoring) DecGauge(*monitoring.Metric) error { return nil }
+
+// newTestEndpoint is an endpoint on the fake clock with the packs in a temporary directory,
+// the repositories the test does not set are nil.
+func newTestEndpoint(t *testing.T, repository *repository.Repository) (*Endpoint, *clock.Fake) {
+	t.Helper()
+
+	fake := clock.NewFake(simulationStart)
+
+	keys, err := jwt.NewKeySet("", jwt.WithSecretKey("", nil, "endpoint", time.Time{}), fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := &Endpoint{
+		repository: repository,
+		configuration: &config.Config{
+			JWT: config.JWT{
+				KeySet:                keys,
+				ExpirationTime:        15 * time.Minute,
+				RefreshExpirationTime: 720 * time.Hour,
+			},
+			Pack: config.Pack{Path: t.TempDir()},
+		},
+		logger:        zap.NewNop(),
+		monitoring:    nopMonitoring{},
+		clock:         fake,
+		resetAttempts: newAttemptLimiter(fake, maxPasswordAttempts, passwordAttemptWindow),
+		guestAttempts: newAttemptLimiter(fake, maxGuestsPerAddress, guestAttemptWindow),
+		uploads:       newPackUploads(fake),
+	}
+
+	return e, fake
+}
+
+// serve calls the handler with the body and the access token of the user when id is not zero.
+func (e *Endpoint) serve(t *testing.T, handler http.HandlerFunc, method string, target string, body string, id uint64) *httptest.ResponseRecorder {
+	t.Helper()
+
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+
+	if id != 0 {
+		token, err := jwt.CreateJWT(e.configuration.JWT.KeySet, &jwt.Claims{ID: id, Login: "user" + strconv.FormatUint(id, 10)})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.Header.Set("Authorization", token)
+	}
+
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	return w
+}
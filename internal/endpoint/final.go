@@ -0,0 +1,427 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// Time given to a player to remove a theme.
+	finalThemeDuration = 20 * time.Second
+
+	// Time given to all players to place their bets.
+	finalBetDuration = 30 * time.Second
+
+	// Time given to all players to write their answers.
+	finalAnswerDuration = 60 * time.Second
+
+	// Time given to the leader to judge a single answer.
+	finalJudgeDuration = 30 * time.Second
+)
+
+type RemoveThemeClientEvent struct {
+	ThemeID int
+}
+
+type MakeBetClientEvent struct {
+	Bet int
+}
+
+type GiveAnswerClientEvent struct {
+	Answer string
+}
+
+type FinalThemesServerEvent struct {
+	ThemeNames      []string
+	RemovedThemeIDs []int
+	QueueIDs        []int
+	QueueID         int
+}
+
+type ThemeRemovedServerEvent struct {
+	ThemeID int
+	QueueID int
+}
+
+type FinalBettingServerEvent struct {
+	ThemeID  int
+	Theme    string
+	QueueIDs []int
+}
+
+type BetMadeServerEvent struct {
+	QueueID int
+}
+
+type FinalQuestionServerEvent struct {
+	ThemeID    int
+	QuestionID int
+	// The final round skips the wall, so the question is shown with the event.
+	Scene         []*Object
+	AnswerType    string
+	AnswerOptions []*AnswerOption
+}
+
+type FinalAnswerMadeServerEvent struct {
+	QueueID int
+}
+
+type FinalJudgingServerEvent struct {
+	QueueID int
+	Answer  string
+}
+
+type FinalBetRevealedServerEvent struct {
+	QueueID int
+	Bet     int
+	Correct bool
+}
+
+// finalRound keeps the state of the final round.
+type finalRound struct {
+	// Queue IDs of players with positive score, in queue order.
+	participants []int
+
+	// Index in participants of the player removing a theme.
+	turn int
+
+	removed map[int]bool
+	bets    map[int]int
+	answers map[int]string
+
+	// Number of answers already judged by the leader.
+	judged int
+}
+
+func (f *finalRound) isParticipant(queueID int) bool {
+	for _, participant := range f.participants {
+		if participant == queueID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// startFinal lets players with positive score remove themes in turn until one is left.
+func (game *Game) startFinal() Step {
+	round := game.Rounds[game.currentRound-1]
+
+	var participants []int
+	for queueID := 1; queueID <= len(game.playersTokenByQueueID); queueID++ {
+		if player, ok := game.playerByQueueID(queueID); ok && player.score > 0 {
+			participants = append(participants, queueID)
+		}
+	}
+
+	if len(participants) == 0 {
+		return Final
+	}
+
+	game.final = &finalRound{
+		participants: participants,
+		removed:      make(map[int]bool),
+		bets:         make(map[int]int),
+		answers:      make(map[int]string),
+	}
+
+	// themes without a question cannot be played, they are out from the start
+	for _, theme := range round.Themes {
+		if len(theme.Quests) == 0 {
+			game.final.removed[theme.Id] = true
+		}
+	}
+
+	remaining := game.remainingFinalThemes()
+	if len(remaining) == 0 {
+		game.final = nil
+
+		return Final
+	}
+
+	if len(remaining) == 1 {
+		game.currentTheme = remaining[0]
+		game.currentQuestion = 1
+
+		return FinalBetting
+	}
+
+	return FinalThemes
+}
+
+// remainingFinalThemes returns the IDs of the themes nobody has removed.
+func (game *Game) remainingFinalThemes() []int {
+	var remaining []int
+	for _, theme := range game.Rounds[game.currentRound-1].Themes {
+		if !game.final.removed[theme.Id] {
+			remaining = append(remaining, theme.Id)
+		}
+	}
+
+	return remaining
+}
+
+// guardThemeRemover allows the event only from the player whose turn is to remove a theme.
+func guardThemeRemover(game *Game, event *ClientEvent) error {
+	if game.playersQueueIDByToken[event.Token] != game.final.participants[game.final.turn] {
+		return errNotYourTurn
+	}
+
+	return nil
+}
+
+func guardFinalist(game *Game, event *ClientEvent) error {
+	if !game.final.isParticipant(game.playersQueueIDByToken[event.Token]) {
+		return errors.New("you are not in the final")
+	}
+
+	return nil
+}
+
+// enterFinalThemes announces the remaining themes and whose turn is to remove one.
+func enterFinalThemes(game *Game) {
+	f := game.final
+
+	themes := game.Rounds[game.currentRound-1].Themes
+
+	themeNames := make([]string, 0, len(themes))
+	removedThemeIDs := make([]int, 0, len(f.removed))
+	for _, theme := range themes {
+		themeNames = append(themeNames, theme.Name)
+
+		if f.removed[theme.Id] {
+			removedThemeIDs = append(removedThemeIDs, theme.Id)
+		}
+	}
+
+	finalThemes := FinalThemesServerEvent{
+		ThemeNames:      themeNames,
+		RemovedThemeIDs: removedThemeIDs,
+		QueueIDs:        f.participants,
+		QueueID:         f.participants[f.turn],
+	}
+
+	game.broadcastServerEvent(FinalThemesServer, finalThemes, game.exp())
+}
+
+// expireFinalThemes removes the first remaining theme when the player has not decided in time.
+func expireFinalThemes(game *Game) Step {
+	for _, theme := range game.Rounds[game.currentRound-1].Themes {
+		if !game.final.removed[theme.Id] {
+			return game.removeFinalTheme(theme.Id)
+		}
+	}
+
+	return FinalBetting
+}
+
+func handleRemoveTheme(game *Game, event *ClientEvent) (Step, error) {
+	var clientEvent RemoveThemeClientEvent
+
+	err := json.Unmarshal(event.Data, &clientEvent)
+	if err != nil {
+		return stay, err
+	}
+
+	themeID := clientEvent.ThemeID
+	if themeID < 1 || themeID > len(game.Rounds[game.currentRound-1].Themes) || game.final.removed[themeID] {
+		return stay, errors.New("incorrect theme")
+	}
+
+	return game.removeFinalTheme(themeID), nil
+}
+
+func (game *Game) removeFinalTheme(themeID int) Step {
+	f := game.final
+
+	f.removed[themeID] = true
+
+	themeRemoved := ThemeRemovedServerEvent{
+		ThemeID: themeID,
+		QueueID: f.participants[f.turn],
+	}
+
+	game.broadcastServerEvent(ThemeRemovedServer, themeRemoved, 0)
+
+	remaining := game.remainingFinalThemes()
+	if len(remaining) == 1 {
+		game.currentTheme = remaining[0]
+		game.currentQuestion = 1
+
+		return FinalBetting
+	}
+
+	f.turn = (f.turn + 1) % len(f.participants)
+
+	return FinalThemes
+}
+
+// enterFinalBetting reveals the remaining theme and asks every participant for a hidden bet.
+func enterFinalBetting(game *Game) {
+	finalBetting := FinalBettingServerEvent{
+		ThemeID:  game.currentTheme,
+		Theme:    game.Rounds[game.currentRound-1].Themes[game.currentTheme-1].Name,
+		QueueIDs: game.final.participants,
+	}
+
+	game.broadcastServerEvent(FinalBettingServer, finalBetting, game.exp())
+}
+
+// expireFinalBetting places the minimal bet for everyone who has not bet in time.
+func expireFinalBetting(game *Game) Step {
+	for _, queueID := range game.final.participants {
+		if _, ok := game.final.bets[queueID]; !ok {
+			game.final.bets[queueID] = 1
+		}
+	}
+
+	return FinalAnswering
+}
+
+func handleMakeBet(game *Game, event *ClientEvent) (Step, error) {
+	var clientEvent MakeBetClientEvent
+
+	err := json.Unmarshal(event.Data, &clientEvent)
+	if err != nil {
+		return stay, err
+	}
+
+	f := game.final
+	queueID := game.playersQueueIDByToken[event.Token]
+
+	if _, ok := f.bets[queueID]; ok {
+		return stay, errors.New("bet already made")
+	}
+
+	var score int
+	if player, ok := game.playerByQueueID(queueID); ok {
+		score = player.score
+	}
+
+	if clientEvent.Bet < 1 || clientEvent.Bet > score {
+		return stay, fmt.Errorf("bet must be between 1 and %d", score)
+	}
+
+	f.bets[queueID] = clientEvent.Bet
+
+	game.broadcastServerEvent(BetMadeServer, BetMadeServerEvent{QueueID: queueID}, 0)
+
+	if len(f.bets) == len(f.participants) {
+		return FinalAnswering, nil
+	}
+
+	return stay, nil
+}
+
+func enterFinalAnswering(game *Game) {
+	finalQuestion := FinalQuestionServerEvent{
+		ThemeID:    game.currentTheme,
+		QuestionID: game.currentQuestion,
+	}
+
+	if quest, ok := game.question(game.currentTheme, game.currentQuestion); ok {
+		finalQuestion.Scene = quest.Scene
+		finalQuestion.AnswerType = quest.AnswerType
+		finalQuestion.AnswerOptions = quest.AnswerOptions
+	}
+
+	game.broadcastServerEvent(FinalQuestionServer, finalQuestion, game.exp())
+	game.sendCorrectAnswer()
+}
+
+func handleGiveFinalAnswer(game *Game, event *ClientEvent) (Step, error) {
+	var clientEvent GiveAnswerClientEvent
+
+	err := json.Unmarshal(event.Data, &clientEvent)
+	if err != nil {
+		return stay, err
+	}
+
+	f := game.final
+	queueID := game.playersQueueIDByToken[event.Token]
+
+	if _, ok := f.answers[queueID]; ok {
+		return stay, errors.New("answer already given")
+	}
+
+	f.answers[queueID] = clientEvent.Answer
+
+	game.broadcastServerEvent(FinalAnswerMadeServer, FinalAnswerMadeServerEvent{QueueID: queueID}, 0)
+
+	if len(f.answers) == len(f.participants) {
+		return FinalJudging, nil
+	}
+
+	return stay, nil
+}
+
+// enterFinalJudging shows the answer of the next participant for the leader to judge,
+// missing answers are judged as empty. The correct answer is revealed to everybody before the first one.
+func enterFinalJudging(game *Game) {
+	if game.final.judged == 0 {
+		game.revealCorrectAnswer()
+	}
+
+	queueID := game.final.participants[game.final.judged]
+
+	finalJudging := FinalJudgingServerEvent{
+		QueueID: queueID,
+		Answer:  game.final.answers[queueID],
+	}
+
+	game.broadcastServerEvent(FinalJudgingServer, finalJudging, game.exp())
+}
+
+func exitFinalJudging(game *Game) {
+	game.final = nil
+}
+
+func handleJudgeFinalAnswer(correct bool) func(game *Game, event *ClientEvent) (Step, error) {
+	judge := judgeFinalAnswer(correct)
+
+	return func(game *Game, event *ClientEvent) (Step, error) {
+		return judge(game), nil
+	}
+}
+
+// judgeFinalAnswer reveals the bet of the judged participant and applies it to the score.
+func judgeFinalAnswer(correct bool) func(game *Game) Step {
+	return func(game *Game) Step {
+		f := game.final
+
+		queueID := f.participants[f.judged]
+		bet := f.bets[queueID]
+
+		var score int
+		if player, ok := game.playerByQueueID(queueID); ok {
+			if correct {
+				player.score += bet
+			} else {
+				player.score -= bet
+			}
+
+			score = player.score
+		}
+
+		game.recordOutcome(queueID, bet, correct)
+
+		betRevealed := FinalBetRevealedServerEvent{
+			QueueID: queueID,
+			Bet:     bet,
+			Correct: correct,
+		}
+
+		game.broadcastServerEvent(FinalBetRevealedServer, betRevealed, 0)
+		game.broadcastServerEvent(ScoreChangedServer, ScoreChangedServerEvent{QueueID: queueID, Score: score}, 0)
+
+		f.judged++
+
+		if f.judged == len(f.participants) {
+			return Final
+		}
+
+		return FinalJudging
+	}
+}
@@ -3,11 +3,11 @@ package endpoint
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"go.uber.org/zap"
 	"mygame/config"
-	"mygame/internal/singleton"
+	"mygame/internal/models"
+	"mygame/tools/clock"
 	"mygame/tools/jwt"
-	"os"
 	"time"
 )
 
@@ -22,6 +22,16 @@ const (
 	GiveAnswer    EventType = "give_answer"
 	DeclineAnswer EventType = "decline_answer"
 	AcceptAnswer  EventType = "accept_answer"
+	MakeStake     EventType = "make_stake"
+	PassStake     EventType = "pass_stake"
+	TransferQuest EventType = "transfer_quest"
+	RemoveTheme   EventType = "remove_theme"
+	MakeBet       EventType = "make_bet"
+	CreateInvite  EventType = "create_invite"
+	Kick          EventType = "kick"
+	CloseHub      EventType = "close_hub"
+
+	PreloadProgress EventType = "preload_progress"
 )
 
 var roleByEvent = map[EventType][]Role{
@@ -33,30 +43,64 @@ var roleByEvent = map[EventType][]Role{
 	DeclineAnswer: {Leader},
 	AcceptAnswer:  {Leader},
 	ChooseQuest:   {User},
+	MakeStake:     {User},
+	PassStake:     {User},
+	TransferQuest: {User},
+	RemoveTheme:   {User},
+	MakeBet:       {User},
+	CreateInvite:  {Leader},
+
+	PreloadProgress: {User},
 }
 
 type ServerEventType string
 
 const (
-	GreetingsServer      ServerEventType = "greetings_server"
-	ReadingRoundServer   ServerEventType = "reading_round"
-	ReadingThemesServer  ServerEventType = "reading_themes_server"
-	WallServer           ServerEventType = "wall_server"
-	GetQuestServer       ServerEventType = "get_quest_server"
-	JoinServer           ServerEventType = "join_server"
-	DisconnectServer     ServerEventType = "disconnect_server"
-	ChooseQuestServer    ServerEventType = "choose_quest_server"
-	TakenQuestServer     ServerEventType = "taken_quest_server"
-	ScoreChangedServer   ServerEventType = "score_changed"
-	AnswerAcceptedServer ServerEventType = "answer_accepted_server"
-	AnswerDeclinedServer ServerEventType = "answer_declined_server"
-	FinalServer          ServerEventType = "final_server"
+	GreetingsServer        ServerEventType = "greetings_server"
+	ReadingRoundServer     ServerEventType = "reading_round"
+	ReadingThemesServer    ServerEventType = "reading_themes_server"
+	WallServer             ServerEventType = "wall_server"
+	GetQuestServer         ServerEventType = "get_quest_server"
+	JoinServer             ServerEventType = "join_server"
+	DisconnectServer       ServerEventType = "disconnect_server"
+	ChooseQuestServer      ServerEventType = "choose_quest_server"
+	TakenQuestServer       ServerEventType = "taken_quest_server"
+	ScoreChangedServer     ServerEventType = "score_changed"
+	AnswerAcceptedServer   ServerEventType = "answer_accepted_server"
+	AnswerDeclinedServer   ServerEventType = "answer_declined_server"
+	FinalServer            ServerEventType = "final_server"
+	AuctionServer          ServerEventType = "auction_server"
+	StakeServer            ServerEventType = "stake_server"
+	AuctionResultServer    ServerEventType = "auction_result_server"
+	CatInBagServer         ServerEventType = "cat_in_bag_server"
+	TransferredQuestServer ServerEventType = "transferred_quest_server"
+	FinalThemesServer      ServerEventType = "final_themes_server"
+	ThemeRemovedServer     ServerEventType = "theme_removed_server"
+	FinalBettingServer     ServerEventType = "final_betting_server"
+	BetMadeServer          ServerEventType = "bet_made_server"
+	FinalQuestionServer    ServerEventType = "final_question_server"
+	FinalAnswerMadeServer  ServerEventType = "final_answer_made_server"
+	FinalJudgingServer     ServerEventType = "final_judging_server"
+	FinalBetRevealedServer ServerEventType = "final_bet_revealed_server"
+	LeaveServer            ServerEventType = "leave_server"
+	StateSnapshotServer    ServerEventType = "state_snapshot"
+	CorrectAnswerServer    ServerEventType = "correct_answer_server"
+	InviteServer           ServerEventType = "invite_server"
+	KickedServer           ServerEventType = "kicked_server"
+	HubClosedServer        ServerEventType = "hub_closed_server"
+	RoundManifestServer    ServerEventType = "round_manifest"
+	PreloadProgressServer  ServerEventType = "preload_progress_server"
 )
 
 type ClientEvent struct {
 	Type  EventType
 	Token string
 	Data  json.RawMessage
+
+	claims *jwt.Claims
+
+	// Receives the result of the event sent by the server, nil for events of the clients.
+	reply chan error
 }
 
 type ChooseQuestClientEvent struct {
@@ -76,6 +120,13 @@ const (
 	Answering
 	Pause
 	Final
+	Bidding
+	Transferring
+	FinalThemes
+	FinalBetting
+	FinalAnswering
+	FinalJudging
+	Closed
 )
 
 type ServerEvent struct {
@@ -130,6 +181,13 @@ type ScoreChangedServerEvent struct {
 	Score   int
 }
 
+// CorrectAnswerServerEvent is sent to the leader alone, the answer of the final question is revealed to everybody.
+type CorrectAnswerServerEvent struct {
+	ThemeID    int
+	QuestionID int
+	Answers    []*Object
+}
+
 type FinalServerEvent struct {
 	WinnerID int
 }
@@ -147,27 +205,67 @@ type Game struct {
 	playersQueueIDByToken map[string]int
 	playersTokenByQueueID map[int]string
 
+	// Disconnected players waiting to connect again, by user ID.
+	disconnected map[uint64]*Player
+
+	// Tokens of connected spectators.
+	spectators map[string]bool
+
+	// Every player who has ever joined the game, by queue ID.
+	participants map[int]*Player
+
+	// Tokens of kicked players, whose disconnection is not announced.
+	kicked map[string]bool
+
 	eventChannel chan *ClientEvent
 
 	currentStep     Step
 	currentPlayerID int
 
+	// Time when the current step expires, zero if it never does.
+	deadline time.Time
+
 	currentRound    int
 	currentTheme    int
 	currentQuestion int
+	currentPrice    int
+
+	auction  *auction
+	catInBag *catInBag
+	final    *finalRound
+
+	startedAt time.Time
+	finished  bool
+	outcomes  []*models.QuestionOutcome
 
 	configuration *config.Config
+
+	clock clock.Clock
+
+	// Logger of the request that has created the hub.
+	logger *zap.Logger
+
+	// Called once when the game is closed, with the history of the game if it has started.
+	onClose func(result *models.GameResult)
 }
 
 type Player struct {
-	client *Client
-	score  int
+	client   *Client
+	nickname string
+	score    int
+
+	// End of the grace period of a disconnected player.
+	reconnectDeadline time.Time
 }
 
 type Round struct {
-	Id     int      `json:"id"`
-	Name   string   `json:"name"`
-	Themes []*Theme `json:"themes"`
+	Id     int        `json:"id"`
+	Name   string     `json:"name"`
+	Type   ObjectType `json:"type"`
+	Themes []*Theme   `json:"themes"`
+
+	// Media of the round, sent to the clients to load ahead.
+	Manifest []*MediaFile `json:"-"`
 }
 
 type Theme struct {
@@ -179,14 +277,32 @@ type Theme struct {
 type ObjectType string
 
 const (
+	Simple     ObjectType = "simple"
 	Text       ObjectType = "text"
 	Image      ObjectType = "image"
 	Audio      ObjectType = "voice"
 	Video      ObjectType = "video"
 	Auction    ObjectType = "auction"
+	Cat        ObjectType = "cat"
+	BagCat     ObjectType = "bagcat"
 	Answer     ObjectType = "answer"
 	FinalRound ObjectType = "final"
 	Marker     ObjectType = "marker"
+	HTML       ObjectType = "html"
+)
+
+const (
+	// The answer is said or typed.
+	AnswerTypeText = "text"
+	// The answer is one of the answer options.
+	AnswerTypeSelect = "select"
+)
+
+// Where the content of a question is shown.
+const (
+	PlacementScreen     = "screen"
+	PlacementReplic     = "replic"
+	PlacementBackground = "background"
 )
 
 func (o ObjectType) String() string {
@@ -194,481 +310,272 @@ func (o ObjectType) String() string {
 }
 
 type Question struct {
-	Id     int       `json:"id"`
-	Price  int       `json:"price"`
-	Scene  []*Object `json:"scenes"`
-	Answer []*Object `json:"answers"`
+	Id     int               `json:"id"`
+	Price  int               `json:"price"`
+	Type   ObjectType        `json:"type"`
+	Params map[string]string `json:"-"`
+	Scene  []*Object         `json:"scenes"`
+	// The right answer followed by the content shown with it.
+	Answer []*Object `json:"-"`
+	Wrong  []string  `json:"-"`
+
+	AnswerType    string          `json:"answer_type"`
+	AnswerOptions []*AnswerOption `json:"answer_options,omitempty"`
 }
 
 type Object struct {
 	Id   int        `json:"id"`
 	Type ObjectType `json:"question_type"`
 	Src  string     `json:"src"`
+	// The source names a file of the pack rather than holds the text or a link.
+	IsRef     bool   `json:"is_ref"`
+	Placement string `json:"placement"`
+	// Milliseconds the object is shown for, zero for as long as it takes.
+	Duration      int64 `json:"duration,omitempty"`
+	WaitForFinish bool  `json:"wait_for_finish"`
 }
 
-func (game *Game) runGame(ctx context.Context) {
-	game.currentStep = WaitingStart
-	ticker := time.NewTicker(20 * time.Minute)
-
-	defer ticker.Stop()
-
-	for {
-		select {
-		case event := <-game.eventChannel:
-			token, err := jwt.ParseJWT([]byte(game.configuration.JWT.SecretKey), event.Token)
-			if err != nil {
-				client, ok := game.hub.clients[event.Token]
-				if !ok {
-					client.send <- []byte("token parse error " + err.Error())
-					client.conn.Close()
-
-					game.hub.unregister <- client
-				}
-
-				return
-			}
+// AnswerOption is one of the options of a question with the select answer type, labelled as the right answer names it.
+type AnswerOption struct {
+	Label   string    `json:"label"`
+	Content []*Object `json:"content"`
+}
 
-			if token.ExpiresAt < time.Now().Unix() {
-				client, ok := game.hub.clients[event.Token]
-				if !ok {
-					client.send <- []byte("token expired " + err.Error())
-					client.conn.Close()
+func (game *Game) runGame(ctx context.Context) {
+	if logger, ok := ctx.Value(LoggerContext).(*zap.Logger); ok {
+		game.logger = logger
+	}
 
-					game.hub.unregister <- client
-				}
+	timer := game.clock.NewTimer(time.Minute)
 
-				return
-			}
+	defer timer.Stop()
 
-			accessedRoles := roleByEvent[event.Type]
-			if len(accessedRoles) != 0 {
-				var accessed bool
-				for _, role := range accessedRoles {
-					if role == game.hub.clients[event.Token].role {
-						accessed = true
-					}
-				}
+	game.enterStep(WaitingStart)
 
-				if !accessed {
-					game.hub.clients[event.Token].send <- []byte("permission denied")
+	for game.currentStep != Closed {
+		game.hub.publish(game.currentStep, game.playerSnapshots(), game.returningUsers())
 
-					continue
-				}
+		if !timer.Stop() {
+			select {
+			case <-timer.C():
+			default:
 			}
+		}
 
-			var newDuration time.Duration
-
-			switch event.Type {
-			case StartGame:
-				if len(game.players) == 0 {
-					game.hub.clients[event.Token].send <- []byte("cannot start game: no players")
-
-					continue
-				}
-
-				game.currentStep = Grettings
-
-				newDuration = 10 * time.Second
-
-				greetingsServer := GreetingsServerEvent{
-					Name:   game.Name,
-					Author: game.Author,
-					Date:   game.Date,
-				}
-
-				game.broadcastServerEvent(GreetingsServer, greetingsServer, time.Now().In(time.UTC).Add(newDuration).Unix())
-			case Join:
-				// todo: getting user image
-				joinServer := JoinServerEvent{
-					QueueID:  0,
-					Nickname: token.Login,
-				}
-
-				if game.hub.clients[event.Token].role == Leader {
-					game.broadcastServerEvent(JoinServer, joinServer, 0)
-
-					continue
-				}
+		if wakeUp := game.wakeUp(); !wakeUp.IsZero() {
+			timer.Reset(wakeUp.Sub(game.clock.Now()))
+		}
 
-				game.players[game.hub.clients[event.Token]] = &Player{
-					client: game.hub.clients[event.Token],
-					score:  0,
+		select {
+		case event := <-game.eventChannel:
+			token, err := jwt.ParseJWT(game.configuration.JWT.KeySet, event.Token)
+			if err != nil {
+				if client, ok := game.hub.client(event.Token); ok {
+					game.hub.send(client, []byte("token parse error "+err.Error()))
+					client.conn.Close()
 				}
 
-				queueID := len(game.playersQueueIDByToken) + 1
-
-				game.playersQueueIDByToken[event.Token] = queueID
-				game.playersTokenByQueueID[queueID] = event.Token
+				event.answer(err)
 
-				joinServer.QueueID = queueID
+				continue
+			}
 
-				game.broadcastServerEvent(JoinServer, joinServer, 0)
-			case Disconnect:
-				for client := range game.players {
-					if client.token == event.Token {
-						delete(game.players, client)
-					}
+			if token.ExpiresAt < game.clock.Now().Unix() {
+				if client, ok := game.hub.client(event.Token); ok {
+					game.hub.send(client, []byte("token expired"))
+					client.conn.Close()
 				}
 
-				disconnectServer := DisconnectServerEvent{
-					QueueID: game.playersQueueIDByToken[event.Token],
-				}
+				event.answer(errTokenExpired)
 
-				game.broadcastServerEvent(DisconnectServer, disconnectServer, 0)
-			case ChooseQuest:
-				var clientEvent ChooseQuestClientEvent
+				continue
+			}
 
-				err = json.Unmarshal(event.Data, &clientEvent)
-				if err != nil {
-					log.Println(err)
-					continue
-				}
+			event.claims = token
 
-				game.currentTheme = clientEvent.ThemeID
-				game.currentQuestion = clientEvent.QuestionID
+			err = game.dispatch(event)
+			if err != nil {
+				game.sendMessage(event.Token, err.Error())
+			}
 
-				game.currentStep = Getting
-				newDuration = 10 * time.Second
+			event.answer(err)
+		case <-timer.C():
+			game.tick()
+		}
+	}
+}
 
-				chooseQuest := ChooseQuestServerEvent{
-					ThemeID:    clientEvent.ThemeID,
-					QuestionID: clientEvent.QuestionID,
-				}
+// selectQuestion opens the chosen question and returns the step depending on the question type.
+func (game *Game) selectQuestion(themeID int, questionID int) Step {
+	quest, _ := game.question(themeID, questionID)
 
-				// todo: send correct answer to leader
+	game.currentTheme = themeID
+	game.currentQuestion = questionID
+	game.currentPrice = quest.Price
 
-				game.broadcastServerEvent(ChooseQuestServer, chooseQuest, time.Now().In(time.UTC).Add(newDuration).Unix())
-			case GetQuest:
-				if game.currentStep == Getting {
-					player := game.players[game.hub.clients[event.Token]]
-					if player.client.role == User {
-						game.currentStep = Answering
-						game.currentPlayerID = game.playersQueueIDByToken[event.Token]
+	chooseQuest := ChooseQuestServerEvent{
+		ThemeID:    themeID,
+		QuestionID: questionID,
+	}
 
-						newDuration = 20 * time.Second
+	game.broadcastServerEvent(ChooseQuestServer, chooseQuest, 0)
+	game.sendCorrectAnswer()
 
-						takenQuest := TakenQuestServerEvent{
-							QueueID: game.playersQueueIDByToken[event.Token],
-						}
+	switch quest.Type {
+	case Auction:
+		return game.startAuction(quest)
+	case Cat, BagCat:
+		return game.startCatInBag(quest)
+	}
 
-						game.broadcastServerEvent(TakenQuestServer, takenQuest, time.Now().In(time.UTC).Add(newDuration).Unix())
-					}
-				}
-			case AcceptAnswer:
-				var found bool
-				for _, theme := range game.Rounds[game.currentRound-1].Themes {
-					for _, question := range theme.Quests {
-						if question.Price >= 0 && question.Id != game.currentQuestion {
-							found = true
-						}
-					}
-				}
-				if !found {
-					if len(game.Rounds) > game.currentRound-1 {
-						game.currentRound++
-						game.currentStep = ChooseQuestion
-
-						newDuration = 30 * time.Second
-					} else {
-						game.currentStep = Final
-						newDuration = 5 * time.Minute
-
-						var winnerID int
-						var maxScore int
-						for _, player := range game.players {
-							if player.score > maxScore {
-								maxScore = player.score
-								winnerID = game.playersQueueIDByToken[player.client.token]
-							}
-						}
-
-						game.broadcastServerEvent(FinalServer, FinalServerEvent{WinnerID: winnerID}, time.Now().In(time.UTC).Add(newDuration).Unix())
-					}
-				} else {
-					game.currentStep = ChooseQuestion
-					newDuration = 30 * time.Second
-				}
+	return Getting
+}
 
-				curQuest := game.Rounds[game.currentRound-1].Themes[game.currentTheme-1].Quests[game.currentQuestion-1]
-				game.players[game.hub.clients[game.playersTokenByQueueID[game.currentPlayerID]]].score += curQuest.Price
+// scoreAnswer applies the price of the current question to the answering player
+// and passes the turn to the next one.
+func (game *Game) scoreAnswer(correct bool) {
+	answeringID := game.currentPlayerID
+
+	var score int
+	if player, ok := game.playerByQueueID(answeringID); ok {
+		if correct {
+			player.score += game.currentPrice
+		} else {
+			player.score -= game.currentPrice
+		}
 
-				if len(game.players) > game.currentPlayerID {
-					game.currentPlayerID++
-				} else {
-					game.currentPlayerID = 1
-				}
+		score = player.score
+	}
 
-				scoreChanged := ScoreChangedServerEvent{
-					QueueID: game.currentPlayerID,
-					Score:   game.players[game.hub.clients[event.Token]].score,
-				}
+	game.recordOutcome(answeringID, game.currentPrice, correct)
 
-				game.broadcastServerEvent(AnswerAcceptedServer, nil, time.Now().In(time.UTC).Add(newDuration).Unix())
-				game.broadcastServerEvent(ScoreChangedServer, scoreChanged, 0)
-
-			case DeclineAnswer:
-				var found bool
-				for _, theme := range game.Rounds[game.currentRound-1].Themes {
-					for _, question := range theme.Quests {
-						if question.Price >= 0 && question.Id != game.currentQuestion {
-							found = true
-						}
-					}
-				}
-				if !found {
-					if len(game.Rounds) > game.currentRound-1 {
-						game.currentRound++
-						game.currentStep = ChooseQuestion
-
-						newDuration = 30 * time.Second
-					} else {
-						game.currentStep = Final
-						newDuration = 5 * time.Minute
-
-						var winnerID int
-						var maxScore int
-						for _, player := range game.players {
-							if player.score > maxScore {
-								maxScore = player.score
-								winnerID = game.playersQueueIDByToken[player.client.token]
-							}
-						}
-
-						game.broadcastServerEvent(AnswerDeclinedServer, nil, time.Now().In(time.UTC).Add(newDuration).Unix())
-						game.broadcastServerEvent(FinalServer, FinalServerEvent{WinnerID: winnerID}, 0)
-					}
-				} else {
-					game.currentStep = ChooseQuestion
-					newDuration = 10 * time.Second
-				}
+	if len(game.players) > game.currentPlayerID {
+		game.currentPlayerID++
+	} else {
+		game.currentPlayerID = 1
+	}
 
-				curQuest := game.Rounds[game.currentRound-1].Themes[game.currentTheme-1].Quests[game.currentQuestion-1]
-				game.players[game.hub.clients[event.Token]].score -= curQuest.Price
+	scoreChanged := ScoreChangedServerEvent{
+		QueueID: answeringID,
+		Score:   score,
+	}
 
-				if len(game.players) > game.currentPlayerID {
-					game.currentPlayerID++
-				} else {
-					game.currentPlayerID = 1
-				}
+	if correct {
+		game.broadcastServerEvent(AnswerAcceptedServer, nil, 0)
+	} else {
+		game.broadcastServerEvent(AnswerDeclinedServer, nil, 0)
+	}
 
-				scoreChanged := ScoreChangedServerEvent{
-					QueueID: game.currentPlayerID,
-					Score:   game.players[game.hub.clients[event.Token]].score,
-				}
+	game.broadcastServerEvent(ScoreChangedServer, scoreChanged, 0)
+}
 
-				game.broadcastServerEvent(ScoreChangedServer, scoreChanged, time.Now().In(time.UTC).Add(newDuration).Unix())
-			}
+// nextQuestion closes the current question and lets the next player choose from the wall,
+// moving on to the next round when the wall is empty.
+func (game *Game) nextQuestion() Step {
+	if quest, ok := game.question(game.currentTheme, game.currentQuestion); ok {
+		quest.Price = -1
+	}
 
-			if newDuration != 0 {
-				ticker.Stop()
-				ticker = time.NewTicker(newDuration)
+	for _, theme := range game.Rounds[game.currentRound-1].Themes {
+		for _, question := range theme.Quests {
+			if question.Price >= 0 {
+				return ChooseQuestion
 			}
-		case <-ticker.C:
-			var newDuration time.Duration
-
-			switch game.currentStep {
-			case WaitingStart:
-				singleton.DegTemporaryPack(game.UID)
-				if !singleton.IsExistemporaryPack(game.UID) {
-					err := os.Remove(game.configuration.PackTemporary.Path + "/" + string(game.UID[:]))
-					if err != nil {
-						// todo: logging
-					}
-				}
-
-				game.hub.close <- struct{}{}
-
-				break
-			case Grettings:
-				if len(game.Rounds) > game.currentRound {
-					game.currentStep = ReadingRound
-					game.currentRound++
-
-					newDuration = 4 * time.Second
-				} else {
-					game.currentStep = Final
-
-					newDuration = 5 * time.Minute
-
-					game.broadcastServerEvent(FinalServer, FinalServerEvent{WinnerID: 1}, time.Now().In(time.UTC).Add(newDuration).Unix())
-				}
-
-				round := game.Rounds[game.currentRound-1]
-
-				readingRound := ReadingRoundServerEvent{
-					Name: round.Name,
-				}
-
-				game.broadcastServerEvent(ReadingRoundServer, readingRound, time.Now().In(time.UTC).Add(newDuration).Unix())
-			case ReadingRound:
-				game.currentStep = ReadingThemes
-
-				round := game.Rounds[game.currentRound-1]
-
-				newDuration = time.Duration(len(round.Themes)) * 3 * time.Second
-
-				themeNames := make([]string, 0, len(round.Themes))
-				for _, theme := range round.Themes {
-					themeNames = append(themeNames, theme.Name)
-				}
-
-				readingThemes := ReadingThemesServerEvent{
-					ThemeNames: themeNames,
-				}
-
-				game.broadcastServerEvent(ReadingThemesServer, readingThemes, time.Now().In(time.UTC).Add(newDuration).Unix())
-			case ReadingThemes:
-				game.currentStep = ChooseQuestion
+		}
+	}
 
-				newDuration = 30 * time.Second
+	return game.nextRound()
+}
 
-				round := game.Rounds[game.currentRound-1]
+// nextRound moves on to the next round or finishes the game when no rounds are left.
+func (game *Game) nextRound() Step {
+	if len(game.Rounds) <= game.currentRound {
+		return Final
+	}
 
-				wall := WallServerEvent{
-					Themes: round.Themes,
-				}
+	game.currentRound++
 
-				game.broadcastServerEvent(WallServer, wall, time.Now().In(time.UTC).Add(newDuration).Unix())
-			case ChooseQuestion:
-				game.currentStep = Getting
-
-				round := game.Rounds[game.currentRound-1]
-				var themeID int
-				var quest *Question
-				for _, theme := range round.Themes {
-					for _, question := range theme.Quests {
-						if question.Price >= 0 {
-							themeID = theme.Id
-							quest = question
-						}
-					}
-				}
+	return ReadingRound
+}
 
-				game.currentQuestion = quest.Id
-				game.currentTheme = themeID
+func (game *Game) question(themeID, questionID int) (*Question, bool) {
+	if game.currentRound < 1 || game.currentRound > len(game.Rounds) {
+		return nil, false
+	}
 
-				getQuest := GetQuestServerEvent{
-					QueueID: game.currentPlayerID,
-				}
+	themes := game.Rounds[game.currentRound-1].Themes
+	if themeID < 1 || themeID > len(themes) {
+		return nil, false
+	}
 
-				newDuration = 10 * time.Second
+	quests := themes[themeID-1].Quests
+	if questionID < 1 || questionID > len(quests) {
+		return nil, false
+	}
 
-				game.broadcastServerEvent(GetQuestServer, getQuest, time.Now().In(time.UTC).Add(newDuration).Unix())
+	return quests[questionID-1], true
+}
 
-				// todo: send correct answer to leader
-			case Getting:
-				var found bool
-				for _, theme := range game.Rounds[game.currentRound-1].Themes {
-					for _, question := range theme.Quests {
-						if question.Price >= 0 && question.Id != game.currentQuestion {
-							found = true
-						}
-					}
-				}
-				if !found {
-					if len(game.Rounds) > game.currentRound-1 {
-						game.currentRound++
-						game.currentStep = ChooseQuestion
-
-						newDuration = 30 * time.Second
-					} else {
-						game.currentStep = Final
-						newDuration = 5 * time.Minute
-
-						var winnerID int
-						var maxScore int
-						for _, player := range game.players {
-							if player.score > maxScore {
-								maxScore = player.score
-								winnerID = game.playersQueueIDByToken[player.client.token]
-							}
-						}
-
-						game.broadcastServerEvent(FinalServer, FinalServerEvent{WinnerID: winnerID}, time.Now().In(time.UTC).Add(newDuration).Unix())
-					}
-				} else {
-					game.currentStep = ChooseQuestion
-					newDuration = 10 * time.Second
-				}
+func (game *Game) playerByQueueID(queueID int) (*Player, bool) {
+	client, ok := game.hub.client(game.playersTokenByQueueID[queueID])
+	if !ok {
+		return nil, false
+	}
 
-				currentQuest := game.Rounds[game.currentRound-1].Themes[game.currentTheme-1].Quests[game.currentQuestion-1]
+	player, ok := game.players[client]
 
-				currentQuest.Price = -1
+	return player, ok
+}
 
-				wall := WallServerEvent{
-					Themes: game.Rounds[game.currentRound-1].Themes,
-				}
+// sendCorrectAnswer shows the answer of the current question to the leader, players and spectators never get it.
+func (game *Game) sendCorrectAnswer() {
+	quest, ok := game.question(game.currentTheme, game.currentQuestion)
+	if !ok {
+		return
+	}
 
-				game.broadcastServerEvent(WallServer, wall, time.Now().In(time.UTC).Add(newDuration).Unix())
-			case Answering:
-				var found bool
-				for _, theme := range game.Rounds[game.currentRound-1].Themes {
-					for _, question := range theme.Quests {
-						if question.Price >= 0 && question.Id != game.currentQuestion {
-							found = true
-						}
-					}
-				}
-				if !found {
-					if len(game.Rounds) > game.currentRound-1 {
-						game.currentRound++
-						game.currentStep = ChooseQuestion
-
-						newDuration = 10 * time.Second
-					} else {
-						game.currentStep = Final
-						newDuration = 5 * time.Minute
-
-						var winnerID int
-						var maxScore int
-						for _, player := range game.players {
-							if player.score > maxScore {
-								maxScore = player.score
-								winnerID = game.playersQueueIDByToken[player.client.token]
-							}
-						}
-
-						game.broadcastServerEvent(FinalServer, FinalServerEvent{WinnerID: winnerID}, time.Now().In(time.UTC).Add(newDuration).Unix())
-					}
-				} else {
-					game.currentStep = ChooseQuestion
-					newDuration = 10 * time.Second
-				}
+	correctAnswer := CorrectAnswerServerEvent{
+		ThemeID:    game.currentTheme,
+		QuestionID: game.currentQuestion,
+		Answers:    quest.Answer,
+	}
 
-				curQuest := game.Rounds[game.currentRound-1].Themes[game.currentTheme-1].Quests[game.currentQuestion-1]
-				game.players[game.hub.clients[game.playersTokenByQueueID[game.currentPlayerID]]].score -= curQuest.Price
+	for _, client := range game.hub.clientList() {
+		if client.role == Leader {
+			game.sendServerEvent(client, CorrectAnswerServer, correctAnswer, 0)
+		}
+	}
+}
 
-				if len(game.players) > game.currentPlayerID {
-					game.currentPlayerID++
-				} else {
-					game.currentPlayerID = 1
-				}
+// revealCorrectAnswer shows the answer of the current question to everybody once nobody can answer it anymore.
+func (game *Game) revealCorrectAnswer() {
+	quest, ok := game.question(game.currentTheme, game.currentQuestion)
+	if !ok {
+		return
+	}
 
-				scoreChanged := ScoreChangedServerEvent{
-					QueueID: game.currentPlayerID,
-					Score:   game.players[game.hub.clients[game.playersTokenByQueueID[game.currentPlayerID]]].score,
-				}
+	correctAnswer := CorrectAnswerServerEvent{
+		ThemeID:    game.currentTheme,
+		QuestionID: game.currentQuestion,
+		Answers:    quest.Answer,
+	}
 
-				game.broadcastServerEvent(ScoreChangedServer, scoreChanged, time.Now().In(time.UTC).Add(newDuration).Unix())
-			case Final:
-				singleton.DegTemporaryPack(game.UID)
-				if !singleton.IsExistemporaryPack(game.UID) {
-					err := os.Remove(game.configuration.PackTemporary.Path + "/" + string(game.UID[:]))
-					if err != nil {
-						// todo: logging
-					}
-				}
-				game.hub.close <- struct{}{}
+	game.broadcastServerEvent(CorrectAnswerServer, correctAnswer, 0)
+}
 
-				break
-			}
+func (game *Game) sendMessage(token string, message string) {
+	if client, ok := game.hub.client(token); ok {
+		game.hub.send(client, []byte(message))
+	}
+}
 
-			if newDuration != 0 {
-				ticker.Stop()
-				ticker = time.NewTicker(newDuration)
-			}
-		}
+// exp returns the deadline of the current step as sent to clients.
+func (game *Game) exp() int64 {
+	if game.deadline.IsZero() {
+		return 0
 	}
+
+	return game.deadline.In(time.UTC).Unix()
 }
 
 func (game *Game) broadcastServerEvent(eventType ServerEventType, event interface{}, exp int64) error {
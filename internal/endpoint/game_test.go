@@ -0,0 +1,384 @@
+package endpoint
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	jwtgo "github.com/dgrijalva/jwt-go"
+	"mygame/tools/jwt"
+)
+
+// newTestGame returns a pack of a round with one theme of two questions and a final round of two themes.
+func newTestGame() *Game {
+	question := func(id, price int, text, answer string) *Question {
+		return &Question{
+			Id:         id,
+			Price:      price,
+			Type:       Simple,
+			Scene:      []*Object{{Id: 1, Type: Text, Src: text, Placement: PlacementScreen}},
+			Answer:     []*Object{{Id: 1, Type: Answer, Src: answer}},
+			AnswerType: AnswerTypeText,
+		}
+	}
+
+	return &Game{
+		Name:   "Test pack",
+		Author: "Tester",
+		Rounds: []*Round{
+			{
+				Id:   1,
+				Name: "First round",
+				Themes: []*Theme{
+					{Id: 1, Name: "Animals", Quests: []*Question{
+						question(1, 100, "Who says meow?", "Cat"),
+						question(2, 200, "Who says woof?", "Dog"),
+					}},
+				},
+			},
+			{
+				Id:   2,
+				Name: "Final",
+				Type: FinalRound,
+				Themes: []*Theme{
+					{Id: 1, Name: "History", Quests: []*Question{question(1, 0, "Year of the first spaceflight?", "1961")}},
+					{Id: 2, Name: "Music", Quests: []*Question{question(1, 0, "Who wrote Yesterday?", "McCartney")}},
+				},
+			},
+		},
+	}
+}
+
+func TestGameSequence(t *testing.T) {
+	s := newSimulation(t, newTestGame(), 2)
+	leader, player1, player2 := s.leader, s.players[0], s.players[1]
+
+	s.expect(leader, StateSnapshotServer, JoinServer, JoinServer, JoinServer)
+	s.expect(player1, StateSnapshotServer, JoinServer, JoinServer)
+	s.expect(player2, StateSnapshotServer, JoinServer)
+
+	if err := s.send(player1, StartGame, nil); err != errPermissionDenied {
+		t.Fatalf("start by a player: got %v, want %v", err, errPermissionDenied)
+	}
+
+	if err := s.send(leader, StartGame, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	greetings := s.expect(leader, GreetingsServer)
+	if want := simulationStart.Add(10 * time.Second).Unix(); greetings[0].Exp != want {
+		t.Fatalf("greetings expire at %d, want %d", greetings[0].Exp, want)
+	}
+
+	s.expect(player1, GreetingsServer)
+	s.expect(player2, GreetingsServer)
+
+	s.expire()
+	s.expectAll(ReadingRoundServer, RoundManifestServer)
+
+	s.expire()
+	s.expectAll(ReadingThemesServer)
+
+	s.expire()
+	s.expectAll(WallServer)
+
+	if err := s.send(player2, ChooseQuest, ChooseQuestClientEvent{ThemeID: 1, QuestionID: 1}); err != errNotYourTurn {
+		t.Fatalf("choice out of turn: got %v, want %v", err, errNotYourTurn)
+	}
+
+	if len(player2.messages) != 1 || player2.messages[0] != errNotYourTurn.Error() {
+		t.Fatalf("player is told %q, want %q", player2.messages, errNotYourTurn.Error())
+	}
+
+	// the first player chooses, the second one takes the question and is right
+	if err := s.send(player1, ChooseQuest, ChooseQuestClientEvent{ThemeID: 1, QuestionID: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	s.expect(leader, ChooseQuestServer, CorrectAnswerServer, GetQuestServer)
+	s.expect(player1, ChooseQuestServer, GetQuestServer)
+	s.expect(player2, ChooseQuestServer, GetQuestServer)
+
+	if err := s.send(player2, GetQuest, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	taken := s.expect(leader, TakenQuestServer)
+
+	var takenQuest TakenQuestServerEvent
+	decodeEvent(t, taken[0], &takenQuest)
+
+	if takenQuest.QueueID != 2 {
+		t.Fatalf("question taken by %d, want 2", takenQuest.QueueID)
+	}
+
+	s.expect(player1, TakenQuestServer)
+	s.expect(player2, TakenQuestServer)
+
+	if err := s.send(leader, AcceptAnswer, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	s.expectAll(AnswerAcceptedServer, ScoreChangedServer, WallServer)
+
+	// the first player chooses again, takes the question and is wrong, which ends the round
+	if err := s.send(player1, ChooseQuest, ChooseQuestClientEvent{ThemeID: 1, QuestionID: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	s.expect(leader, ChooseQuestServer, CorrectAnswerServer, GetQuestServer)
+	s.expect(player1, ChooseQuestServer, GetQuestServer)
+	s.expect(player2, ChooseQuestServer, GetQuestServer)
+
+	if err := s.send(player1, GetQuest, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	s.expectAll(TakenQuestServer)
+
+	if err := s.send(leader, DeclineAnswer, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	s.expectAll(AnswerDeclinedServer, ScoreChangedServer, ReadingRoundServer, RoundManifestServer)
+
+	if s.score(1) != -200 || s.score(2) != 100 {
+		t.Fatalf("scores are %d and %d, want -200 and 100", s.score(1), s.score(2))
+	}
+
+	s.expire()
+	s.expectAll(ReadingThemesServer)
+
+	// only the second player has a positive score and plays the final
+	s.expire()
+	s.expectAll(FinalThemesServer)
+
+	if err := s.send(player1, RemoveTheme, RemoveThemeClientEvent{ThemeID: 1}); err != errNotYourTurn {
+		t.Fatalf("theme removal out of turn: got %v, want %v", err, errNotYourTurn)
+	}
+
+	if err := s.send(player2, RemoveTheme, RemoveThemeClientEvent{ThemeID: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	s.expectAll(ThemeRemovedServer, FinalBettingServer)
+
+	if err := s.send(player2, MakeBet, MakeBetClientEvent{Bet: 101}); err == nil {
+		t.Fatal("bet above the score is accepted")
+	}
+
+	if err := s.send(player2, MakeBet, MakeBetClientEvent{Bet: 50}); err != nil {
+		t.Fatal(err)
+	}
+
+	events := s.expect(leader, BetMadeServer, FinalQuestionServer, CorrectAnswerServer)
+	s.expect(player1, BetMadeServer, FinalQuestionServer)
+	s.expect(player2, BetMadeServer, FinalQuestionServer)
+
+	var finalQuestion FinalQuestionServerEvent
+	decodeEvent(t, events[1], &finalQuestion)
+
+	if finalQuestion.ThemeID != 2 || len(finalQuestion.Scene) != 1 || finalQuestion.Scene[0].Src != "Who wrote Yesterday?" {
+		t.Fatalf("final question is %+v, want the question of the second theme", finalQuestion)
+	}
+
+	if err := s.send(player2, GiveAnswer, GiveAnswerClientEvent{Answer: "McCartney"}); err != nil {
+		t.Fatal(err)
+	}
+
+	events = s.expect(player1, FinalAnswerMadeServer, CorrectAnswerServer, FinalJudgingServer)
+	s.expect(leader, FinalAnswerMadeServer, CorrectAnswerServer, FinalJudgingServer)
+	s.expect(player2, FinalAnswerMadeServer, CorrectAnswerServer, FinalJudgingServer)
+
+	var correctAnswer CorrectAnswerServerEvent
+	decodeEvent(t, events[1], &correctAnswer)
+
+	if len(correctAnswer.Answers) != 1 || correctAnswer.Answers[0].Src != "McCartney" {
+		t.Fatalf("revealed answer is %+v, want McCartney", correctAnswer.Answers)
+	}
+
+	if err := s.send(leader, AcceptAnswer, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	events = s.expect(leader, FinalBetRevealedServer, ScoreChangedServer, FinalServer)
+	s.expect(player1, FinalBetRevealedServer, ScoreChangedServer, FinalServer)
+	s.expect(player2, FinalBetRevealedServer, ScoreChangedServer, FinalServer)
+
+	var final FinalServerEvent
+	decodeEvent(t, events[2], &final)
+
+	if final.WinnerID != 2 || s.score(2) != 150 {
+		t.Fatalf("winner is %d with %d, want 2 with 150", final.WinnerID, s.score(2))
+	}
+
+	s.expire()
+
+	if !s.closed() {
+		t.Fatal("hub is not closed when the game is over")
+	}
+
+	if s.closes != 1 || s.result == nil || len(s.result.Questions) != 3 {
+		t.Fatalf("onClose called %d times with %+v, want once with three questions", s.closes, s.result)
+	}
+}
+
+func TestGameSequenceOnTimeouts(t *testing.T) {
+	s := newSimulation(t, newTestGame(), 1)
+	leader, player := s.leader, s.players[0]
+
+	s.expect(leader, StateSnapshotServer, JoinServer, JoinServer)
+	s.expect(player, StateSnapshotServer, JoinServer)
+
+	if err := s.send(leader, StartGame, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	s.expectAll(GreetingsServer)
+
+	s.advance(10 * time.Second)
+	s.expectAll(ReadingRoundServer, RoundManifestServer)
+
+	s.advance(4 * time.Second)
+	s.expectAll(ReadingThemesServer)
+
+	s.advance(3 * time.Second)
+	s.expectAll(WallServer)
+
+	// nobody chooses, the last question is taken
+	s.advance(30 * time.Second)
+
+	events := s.expect(leader, ChooseQuestServer, CorrectAnswerServer, GetQuestServer)
+	s.expect(player, ChooseQuestServer, GetQuestServer)
+
+	var chooseQuest ChooseQuestServerEvent
+	decodeEvent(t, events[0], &chooseQuest)
+
+	if chooseQuest.ThemeID != 1 || chooseQuest.QuestionID != 2 {
+		t.Fatalf("question %d of theme %d is chosen, want the second one", chooseQuest.QuestionID, chooseQuest.ThemeID)
+	}
+
+	// nobody takes it
+	s.advance(10 * time.Second)
+	s.expectAll(WallServer)
+
+	s.expire()
+	s.expect(leader, ChooseQuestServer, CorrectAnswerServer, GetQuestServer)
+	s.expect(player, ChooseQuestServer, GetQuestServer)
+
+	if err := s.send(player, GetQuest, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	s.expectAll(TakenQuestServer)
+
+	// the leader does not judge in time, the answer is wrong
+	s.advance(20 * time.Second)
+	s.expectAll(AnswerDeclinedServer, ScoreChangedServer, ReadingRoundServer, RoundManifestServer)
+
+	if s.score(1) != -100 {
+		t.Fatalf("score is %d, want -100", s.score(1))
+	}
+
+	s.expire()
+	s.expectAll(ReadingThemesServer)
+
+	// nobody has a positive score for the final
+	s.expire()
+
+	events = s.expect(leader, FinalServer)
+	s.expect(player, FinalServer)
+
+	var final FinalServerEvent
+	decodeEvent(t, events[0], &final)
+
+	if final.WinnerID != 0 {
+		t.Fatalf("winner is %d, want nobody", final.WinnerID)
+	}
+
+	s.advance(5 * time.Minute)
+
+	if !s.closed() || s.closes != 1 {
+		t.Fatalf("hub closed %v, onClose called %d times, want closed once", s.closed(), s.closes)
+	}
+}
+
+func TestGameRejectsExpiredTokens(t *testing.T) {
+	s := newSimulation(t, newTestGame(), 0)
+
+	token, err := jwt.CreateJWT(s.keys, &jwt.Claims{
+		ID:    10,
+		Login: "late",
+		StandardClaims: jwtgo.StandardClaims{
+			ExpiresAt: s.clock.Now().Add(-time.Second).Unix(),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the client is not registered, the game has no connection to close
+	err = s.dispatch(&ClientEvent{Type: Join, Token: token})
+	if err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Fatalf("join with an expired token: got %v, want an expiry error", err)
+	}
+
+	if len(s.game.players) != 0 {
+		t.Fatalf("%d players have joined with an expired token", len(s.game.players))
+	}
+}
+
+func TestGameKeepsSeatsForReturningPlayers(t *testing.T) {
+	s := newSimulation(t, newTestGame(), 2)
+	leader, player1, player2 := s.leader, s.players[0], s.players[1]
+
+	s.expect(leader, StateSnapshotServer, JoinServer, JoinServer, JoinServer)
+	s.expect(player1, StateSnapshotServer, JoinServer, JoinServer)
+	s.expect(player2, StateSnapshotServer, JoinServer)
+
+	s.disconnect(player2)
+	s.settle()
+
+	events := s.expect(leader, DisconnectServer)
+	s.expect(player1, DisconnectServer)
+
+	if want := s.clock.Now().Add(reconnectGracePeriod).Unix(); events[0].Exp != want {
+		t.Fatalf("seat is kept until %d, want %d", events[0].Exp, want)
+	}
+
+	if !s.hub.isReturning(player2.id) || !s.hub.hasUser(player2.id) {
+		t.Fatal("disconnected player is not returning")
+	}
+
+	player2 = s.reconnect(player2)
+
+	s.expect(leader, JoinServer)
+	s.expect(player1, JoinServer)
+
+	events = s.expect(player2, StateSnapshotServer, JoinServer)
+
+	var snapshot StateSnapshotServerEvent
+	decodeEvent(t, events[0], &snapshot)
+
+	if snapshot.QueueID != 2 {
+		t.Fatalf("returning player got queue ID %d, want 2", snapshot.QueueID)
+	}
+
+	// the grace period of the first player runs out
+	s.disconnect(player1)
+
+	s.expect(leader, DisconnectServer)
+	s.expect(player2, DisconnectServer)
+
+	s.advance(reconnectGracePeriod)
+
+	events = s.expect(leader, LeaveServer)
+	s.expect(player2, LeaveServer)
+
+	var leave LeaveServerEvent
+	decodeEvent(t, events[0], &leave)
+
+	if leave.QueueID != 1 || s.hub.isReturning(player1.id) || s.hub.hasUser(player1.id) {
+		t.Fatalf("player %d has left, want 1 and no seat kept", leave.QueueID)
+	}
+}
@@ -0,0 +1,210 @@
+package endpoint
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"mygame/internal/models"
+	"mygame/internal/repository"
+	"mygame/tools/helpers"
+	"mygame/tools/jwt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	defaultGuestNickname = "guest"
+
+	guestSuffixLength = 4
+	// Suffixes tried before giving up on the nickname.
+	maxGuestAttempts = 10
+
+	// Length of the login column.
+	maxLoginLength = 32
+
+	// Guests one address may create within the window.
+	maxGuestsPerAddress = 10
+	guestAttemptWindow  = time.Hour
+
+	// Guests who have played no game and cannot sign in any more are deleted after staleGuestAge.
+	staleGuestAge      = 30 * 24 * time.Hour
+	guestCleanupPeriod = time.Hour
+)
+
+// createGuest persists a guest with the nickname made unique by a random suffix, like "bob#K7QX".
+func (e *Endpoint) createGuest(ctx context.Context, nickname string) (uint64, string, error) {
+	nickname = strings.TrimSpace(strings.ReplaceAll(nickname, models.GuestSuffixSeparator, ""))
+	if nickname == "" {
+		nickname = defaultGuestNickname
+	}
+
+	maxNicknameLength := maxLoginLength - len(models.GuestSuffixSeparator) - guestSuffixLength
+	for utf8.RuneCountInString(nickname) > maxNicknameLength {
+		_, size := utf8.DecodeLastRuneInString(nickname)
+		nickname = nickname[:len(nickname)-size]
+	}
+
+	for i := 0; i < maxGuestAttempts; i++ {
+		suffix, err := helpers.GenerateCode(guestSuffixLength)
+		if err != nil {
+			return 0, "", err
+		}
+
+		login := nickname + models.GuestSuffixSeparator + suffix
+
+		id, err := e.repository.UserRepository.CreateGuest(ctx, login, e.clock.Now())
+		if err == repository.ErrLoginTaken {
+			continue
+		} else if err != nil {
+			return 0, "", err
+		}
+
+		return id, login, nil
+	}
+
+	return 0, "", errors.New("cannot find a free guest nickname")
+}
+
+// CleanupGuests deletes the stale guests every guestCleanupPeriod until the context is done.
+func (e *Endpoint) CleanupGuests(ctx context.Context) {
+	timer := e.clock.NewTimer(0)
+
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C():
+		}
+
+		now := e.clock.Now()
+
+		deleted, err := e.repository.UserRepository.DeleteStaleGuests(ctx, now.Add(-staleGuestAge), now)
+		if err != nil {
+			e.logger.Error(
+				"delete stale guests error",
+				zap.Error(err),
+			)
+		} else if deleted != 0 {
+			e.logger.Info(
+				"stale guests deleted",
+				zap.Int64("count", deleted),
+			)
+		}
+
+		timer.Reset(guestCleanupPeriod)
+	}
+}
+
+// registerGuest turns the guest of the access token into a registered user, keeping its games and ratings.
+func (e *Endpoint) registerGuest(w http.ResponseWriter, r *http.Request) {
+	ctx := e.CreateContext(w, r)
+
+	if r.Method != http.MethodPost {
+		e.responseWriterError(errors.New("method not allowed"), w, http.StatusMethodNotAllowed, ctx, "")
+
+		return
+	}
+
+	token, err := jwt.ParseJWT(e.configuration.JWT.KeySet, r.Header.Get("Authorization"))
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusUnauthorized, ctx, "parse jwt error")
+
+		return
+	}
+
+	revoked, err := e.isRevoked(ctx, token)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "check token error")
+
+		return
+	}
+
+	if revoked {
+		e.responseWriterError(errTokenRevoked, w, http.StatusUnauthorized, ctx, "")
+
+		return
+	}
+
+	if token.ID == 0 {
+		e.responseWriterError(repository.ErrUserNotGuest, w, http.StatusBadRequest, ctx, "")
+
+		return
+	}
+
+	var user *models.User
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusBadRequest, ctx, "read body error")
+
+		return
+	}
+
+	err = json.Unmarshal(body, &user)
+	if err != nil || user == nil {
+		e.responseWriterError(errors.New("incorrect user"), w, http.StatusBadRequest, ctx, "unmarshal body to struct error")
+
+		return
+	}
+
+	err = user.Validate()
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusBadRequest, ctx, "")
+
+		return
+	}
+
+	hashPassword, err := helpers.HashPassword(user.Password)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "hash password error")
+
+		return
+	}
+
+	user.Password = hashPassword
+
+	err = e.repository.UserRepository.ConvertGuest(ctx, token.ID, user)
+	switch err {
+	case nil:
+	case repository.ErrLoginTaken, repository.ErrEmailTaken, repository.ErrUserNotGuest:
+		e.responseWriterError(err, w, http.StatusBadRequest, ctx, "")
+
+		return
+	default:
+		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "convert guest error")
+
+		return
+	}
+
+	if user.Email != "" {
+		e.sendVerification(ctx, token.ID, user.Email)
+	}
+
+	// tokens of the guest carry its old login
+	if token.SessionID != "" {
+		err = e.repository.TokenRepository.RevokeTokenFamily(ctx, token.SessionID, e.clock.Now())
+		if err != nil {
+			e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "revoke token error")
+
+			return
+		}
+	}
+
+	accessToken, refreshToken, err := e.issueTokens(ctx, token.ID, user.Login)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "generate token error")
+
+		return
+	}
+
+	e.responseWriter(http.StatusOK, map[string]interface{}{
+		"access_token":  accessToken,
+		"refresh_token": refreshToken,
+	}, w, ctx)
+}
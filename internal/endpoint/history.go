@@ -0,0 +1,172 @@
+package endpoint
+
+import (
+	"errors"
+	"mygame/internal/models"
+	"mygame/tools/jwt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultGamesLimit = 20
+	maxGamesLimit     = 100
+)
+
+// recordOutcome remembers how the current question has been played for the game history.
+func (game *Game) recordOutcome(queueID int, price int, correct bool) {
+	game.outcomes = append(game.outcomes, &models.QuestionOutcome{
+		Round:      game.currentRound,
+		ThemeID:    game.currentTheme,
+		QuestionID: game.currentQuestion,
+		QueueID:    queueID,
+		Price:      price,
+		Correct:    correct,
+		AnsweredAt: game.clock.Now(),
+	})
+}
+
+// isAbandoned reports whether nobody is left in the hub, nor is anybody expected back.
+func (game *Game) isAbandoned() bool {
+	return len(game.hub.clientList()) == 0 && len(game.disconnected) == 0
+}
+
+// result returns the game history, nil when the game has never started.
+func (game *Game) result() *models.GameResult {
+	if game.startedAt.IsZero() {
+		return nil
+	}
+
+	endReason := models.GameAbandoned
+	if game.finished {
+		endReason = models.GameFinished
+	}
+
+	result := &models.GameResult{
+		HubName:     game.hub.opts.Name,
+		PackHash:    append([]byte(nil), game.UID[:]...),
+		PackName:    game.Name,
+		LeaderID:    game.hub.leaderID,
+		LeaderLogin: game.hub.leaderLogin,
+		StartedAt:   game.startedAt,
+		FinishedAt:  game.clock.Now(),
+		EndReason:   endReason,
+		Questions:   game.outcomes,
+	}
+
+	for queueID := 1; queueID <= len(game.playersTokenByQueueID); queueID++ {
+		player, ok := game.participants[queueID]
+		if !ok {
+			continue
+		}
+
+		result.Participants = append(result.Participants, &models.GameParticipant{
+			QueueID:  queueID,
+			UserID:   player.client.id,
+			Nickname: player.nickname,
+			Score:    player.score,
+		})
+	}
+
+	return result
+}
+
+func (e *Endpoint) getGames(w http.ResponseWriter, r *http.Request) {
+	ctx := e.CreateContext(w, r)
+
+	if r.Method != http.MethodGet {
+		e.responseWriterError(errors.New("method not allowed"), w, http.StatusMethodNotAllowed, ctx, "")
+
+		return
+	}
+
+	query := r.URL.Query()
+
+	var userID uint64
+	var err error
+
+	// the games of the requester unless another user is asked for
+	if value := query.Get("user_id"); value != "" {
+		userID, err = strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			e.responseWriterError(errors.New("incorrect user id"), w, http.StatusBadRequest, ctx, "")
+
+			return
+		}
+	} else {
+		token, err := jwt.ParseJWT(e.configuration.JWT.KeySet, r.Header.Get("Authorization"))
+		if err != nil {
+			e.responseWriterError(err, w, http.StatusUnauthorized, ctx, "parse jwt error")
+
+			return
+		}
+
+		userID = token.ID
+	}
+
+	if userID == 0 {
+		e.responseWriterError(errors.New("anonymous players have no game history"), w, http.StatusBadRequest, ctx, "")
+
+		return
+	}
+
+	limit := defaultGamesLimit
+	if value := query.Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxGamesLimit {
+			e.responseWriterError(errors.New("incorrect limit"), w, http.StatusBadRequest, ctx, "")
+
+			return
+		}
+	}
+
+	var offset int
+	if value := query.Get("offset"); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			e.responseWriterError(errors.New("incorrect offset"), w, http.StatusBadRequest, ctx, "")
+
+			return
+		}
+	}
+
+	games, err := e.repository.GameRepository.GetGamesByUserID(ctx, userID, limit, offset)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "get games error")
+
+		return
+	}
+
+	e.responseWriter(http.StatusOK, map[string]interface{}{
+		"games": games,
+	}, w, ctx)
+}
+
+func (e *Endpoint) getGame(w http.ResponseWriter, r *http.Request) {
+	ctx := e.CreateContext(w, r)
+
+	if r.Method != http.MethodGet {
+		e.responseWriterError(errors.New("method not allowed"), w, http.StatusMethodNotAllowed, ctx, "")
+
+		return
+	}
+
+	id, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, GameEndpoint.ToString()), 10, 64)
+	if err != nil {
+		e.responseWriterError(errors.New("incorrect game id"), w, http.StatusBadRequest, ctx, "")
+
+		return
+	}
+
+	game, err := e.repository.GameRepository.GetGameByID(ctx, id)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusNotFound, ctx, "")
+
+		return
+	}
+
+	e.responseWriter(http.StatusOK, map[string]interface{}{
+		"game": game,
+	}, w, ctx)
+}
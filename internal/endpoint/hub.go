@@ -2,13 +2,23 @@ package endpoint
 
 import (
 	"context"
+	"go.uber.org/zap"
 	"mygame/config"
+	"mygame/tools/clock"
+	"sort"
+	"sync"
+	"time"
 )
 
-var hubs = make(map[int]*Hub)
+var (
+	hubs      = make(map[int]*Hub)
+	lastHubID int
+	hubsMutex sync.RWMutex
+)
 
 type Hub struct {
-	// Registered clients.
+	id int
+	// Registered clients, guarded by mutex. The hub adds them, the hub and the game remove them.
 	clients map[string]*Client
 
 	// Inbound messages from the clients.
@@ -20,36 +30,110 @@ type Hub struct {
 	// Unregister requests from clients.
 	unregister chan *Client
 
+	// Closed by the game when it is over.
 	close chan struct{}
 
 	opts Options
 
 	game *Game
+
+	// User ID of the leader, who may connect again with the hub ID.
+	leaderID    uint64
+	leaderLogin string
+
+	createdAt time.Time
+
+	// Failed password attempts by address.
+	passwordAttempts *attemptLimiter
+
+	clock clock.Clock
+
+	// State of the game published for the lobby and the clients, guarded by mutex.
+	mutex   sync.RWMutex
+	step    Step
+	players []*PlayerSnapshot
+	// Disconnected players the game keeps the seats for, by user ID.
+	returning map[uint64]bool
+	// Users kicked by moderators, who cannot join again.
+	kickedUsers map[uint64]bool
+	// Connections of the users in the hub.
+	members map[member]int
+}
+
+// member tells users apart, anonymous players by the login only.
+type member struct {
+	id    uint64
+	login string
 }
 
 type Options struct {
 	Name     string
 	Password string
 
-	MaxPlayers int
+	MaxPlayers    int
+	MaxSpectators int
 }
 
-func registerHub(ctx context.Context, game *Game, configuration *config.Config) *Hub {
-	hub := newHub(ctx, game, configuration)
+// registerHub lists the hub in the lobby and starts the game.
+func registerHub(ctx context.Context, hub *Hub) {
+	hubsMutex.Lock()
+	lastHubID++
+	hub.id = lastHubID
+	hubs[hub.id] = hub
+	hubsMutex.Unlock()
+
 	go hub.run()
+	go hub.game.runGame(ctx)
+}
 
-	hubs[len(hubs)+1] = hub
+func unregisterHub(hub *Hub) {
+	hubsMutex.Lock()
+	delete(hubs, hub.id)
+	hubsMutex.Unlock()
 
-	return hub
+	removeInviteCodes(hub.id)
+}
+
+func findHub(id int) (*Hub, bool) {
+	hubsMutex.RLock()
+	defer hubsMutex.RUnlock()
+
+	hub, ok := hubs[id]
+
+	return hub, ok
 }
 
-func newHub(ctx context.Context, game *Game, configuration *config.Config) *Hub {
+// listHubs returns the open hubs, the newest first.
+func listHubs() []*Hub {
+	hubsMutex.RLock()
+	list := make([]*Hub, 0, len(hubs))
+	for _, hub := range hubs {
+		list = append(list, hub)
+	}
+	hubsMutex.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].id > list[j].id
+	})
+
+	return list
+}
+
+func newHub(game *Game, configuration *config.Config, clock clock.Clock) *Hub {
 	hub := &Hub{
 		broadcast:  make(chan []byte),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
+		close:      make(chan struct{}),
 		clients:    make(map[string]*Client),
 		game:       game,
+		clock:      clock,
+		createdAt:  clock.Now(),
+
+		passwordAttempts: newAttemptLimiter(clock, maxPasswordAttempts, passwordAttemptWindow),
+
+		kickedUsers: make(map[uint64]bool),
+		members:     make(map[member]int),
 	}
 
 	game.currentPlayerID = 1
@@ -57,13 +141,17 @@ func newHub(ctx context.Context, game *Game, configuration *config.Config) *Hub
 	game.players = make(map[*Client]*Player)
 	game.playersTokenByQueueID = make(map[int]string)
 	game.playersQueueIDByToken = make(map[string]int)
+	game.disconnected = make(map[uint64]*Player)
+	game.spectators = make(map[string]bool)
+	game.participants = make(map[int]*Player)
+	game.kicked = make(map[string]bool)
 
 	game.configuration = configuration
+	game.clock = clock
+	game.logger = zap.NewNop()
 
 	game.hub = hub
 
-	go game.runGame(ctx)
-
 	return hub
 }
 
@@ -71,41 +159,230 @@ func (h *Hub) run() {
 	for {
 		select {
 		case client := <-h.register:
-			h.clients[client.token] = client
+			// a user connecting again takes the place of the previous connection,
+			// the new connection is registered first so that the game never sees the hub empty
+			replaced := h.replaceClient(client)
+
+			for _, registered := range replaced {
+				h.sendToGame(&ClientEvent{
+					Type:  Disconnect,
+					Token: registered.token,
+				})
+			}
 
 			event := ClientEvent{
 				Type:  Join,
 				Token: client.token,
 			}
 
-			h.game.eventChannel <- &event
+			h.sendToGame(&event)
 		case client := <-h.unregister:
-			if _, ok := h.clients[client.token]; ok {
-				delete(h.clients, client.token)
-				close(client.send)
-			}
-
-			event := ClientEvent{
-				Type:  Disconnect,
-				Token: client.token,
+			if !client.replaced {
+				h.remove(client)
 			}
-
-			h.game.eventChannel <- &event
 		case message := <-h.broadcast:
-			for _, client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					close(client.send)
-					delete(h.clients, client.token)
-				}
-			}
+			h.deliver(message)
 		case <-h.close:
+			h.mutex.Lock()
 			for _, client := range h.clients {
-				h.unregister <- client
+				h.dropClient(client)
 			}
+			h.mutex.Unlock()
+
+			return
+		}
+	}
+}
+
+// publish makes the state of the game visible to the lobby and to the players connecting again.
+func (h *Hub) publish(step Step, players []*PlayerSnapshot, returning map[uint64]bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.step = step
+	h.players = players
+	h.returning = returning
+}
+
+func (h *Hub) published() (Step, []*PlayerSnapshot) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	return h.step, h.players
+}
 
-			break
+func (h *Hub) countClients(role Role) int {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	var count int
+	for _, client := range h.clients {
+		if client.role == role {
+			count++
+		}
+	}
+
+	return count
+}
+
+// sendToGame passes the event to the game, delivering broadcasts meanwhile
+// so that the game is never blocked on the hub.
+func (h *Hub) sendToGame(event *ClientEvent) {
+	for {
+		select {
+		case h.game.eventChannel <- event:
+			return
+		case message := <-h.broadcast:
+			h.deliver(message)
+		case <-h.close:
+			return
 		}
 	}
 }
+
+// remove closes the client connection and tells the game about it.
+func (h *Hub) remove(client *Client) {
+	h.mutex.Lock()
+	h.dropClient(client)
+	h.mutex.Unlock()
+
+	event := ClientEvent{
+		Type:  Disconnect,
+		Token: client.token,
+	}
+
+	h.sendToGame(&event)
+}
+
+func (h *Hub) deliver(message []byte) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for _, client := range h.clients {
+		h.sendLocked(client, message)
+	}
+}
+
+// send queues the message for the client without blocking, a client that cannot keep up is dropped
+// and its connection is closed. Safe to call from the game.
+func (h *Hub) send(client *Client, message []byte) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.sendLocked(client, message)
+}
+
+func (h *Hub) sendLocked(client *Client, message []byte) {
+	if client.closed {
+		return
+	}
+
+	select {
+	case client.send <- message:
+	default:
+		h.dropClient(client)
+	}
+}
+
+// client returns the registered client with the token, safe to call from the game.
+func (h *Hub) client(token string) (*Client, bool) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	client, ok := h.clients[token]
+
+	return client, ok
+}
+
+// clientList returns the registered clients, safe to call from the game.
+func (h *Hub) clientList() []*Client {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	list := make([]*Client, 0, len(h.clients))
+	for _, client := range h.clients {
+		list = append(list, client)
+	}
+
+	return list
+}
+
+// replaceClient registers the client in place of the connections of the same user and returns them.
+func (h *Hub) replaceClient(client *Client) []*Client {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	var replaced []*Client
+	for _, registered := range h.clients {
+		if registered.token == client.token || client.id != 0 && registered.id == client.id {
+			registered.replaced = true
+
+			h.dropClient(registered)
+
+			replaced = append(replaced, registered)
+		}
+	}
+
+	h.clients[client.token] = client
+	h.members[member{id: client.id, login: client.login}]++
+
+	return replaced
+}
+
+// dropClient unregisters the client and closes its send channel once, the mutex must be held.
+func (h *Hub) dropClient(client *Client) {
+	if client.closed {
+		return
+	}
+
+	client.closed = true
+	close(client.send)
+
+	if registered, ok := h.clients[client.token]; ok && registered == client {
+		delete(h.clients, client.token)
+	}
+
+	key := member{id: client.id, login: client.login}
+	if h.members[key]--; h.members[key] <= 0 {
+		delete(h.members, key)
+	}
+}
+
+// isReturning tells if the user has a seat kept in the game, safe to call outside of the hub.
+func (h *Hub) isReturning(id uint64) bool {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	return h.returning[id]
+}
+
+// isMember tells if the user is connected to the hub, safe to call outside of the hub.
+func (h *Hub) isMember(id uint64, login string) bool {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	return h.members[member{id: id, login: login}] > 0
+}
+
+// hasUser tells if the registered user is connected to the hub under any login or has a seat kept in it,
+// safe to call outside of the hub.
+func (h *Hub) hasUser(id uint64) bool {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	if id == 0 {
+		return false
+	}
+
+	if h.returning[id] {
+		return true
+	}
+
+	for member := range h.members {
+		if member.id == id {
+			return true
+		}
+	}
+
+	return false
+}
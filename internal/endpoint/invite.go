@@ -0,0 +1,202 @@
+package endpoint
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"mygame/tools/clock"
+	"mygame/tools/helpers"
+	"mygame/tools/jwt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	inviteCodeLength = 8
+
+	// Failed password attempts allowed from one address within the window.
+	maxPasswordAttempts   = 5
+	passwordAttemptWindow = time.Minute
+)
+
+var errTooManyAttempts = errors.New("too many attempts, try again later")
+
+type InviteServerEvent struct {
+	// Code is valid until the hub is closed.
+	Code string
+	// Link is valid until LinkExp.
+	Link    string
+	LinkExp int64
+}
+
+var (
+	// Hub IDs by invite code.
+	invites      = make(map[string]int)
+	invitesMutex sync.Mutex
+)
+
+func newInviteCode(hubID int) (string, error) {
+	invitesMutex.Lock()
+	defer invitesMutex.Unlock()
+
+	for {
+		code, err := helpers.GenerateCode(inviteCodeLength)
+		if err != nil {
+			return "", err
+		}
+
+		if _, ok := invites[code]; !ok {
+			invites[code] = hubID
+
+			return code, nil
+		}
+	}
+}
+
+func findHubByInviteCode(code string) (*Hub, bool) {
+	invitesMutex.Lock()
+	hubID, ok := invites[code]
+	invitesMutex.Unlock()
+
+	if !ok {
+		return nil, false
+	}
+
+	return findHub(hubID)
+}
+
+func removeInviteCodes(hubID int) {
+	invitesMutex.Lock()
+	defer invitesMutex.Unlock()
+
+	for code, id := range invites {
+		if id == hubID {
+			delete(invites, code)
+		}
+	}
+}
+
+// handleCreateInvite sends the leader a new invite code and link, both let players in without the password.
+func handleCreateInvite(game *Game, event *ClientEvent) (Step, error) {
+	client, ok := game.hub.client(event.Token)
+	if !ok {
+		return stay, errors.New("client not found")
+	}
+
+	code, err := newInviteCode(game.hub.id)
+	if err != nil {
+		return stay, errors.New("cannot create invite code")
+	}
+
+	linkExp := game.clock.Now().Add(game.configuration.Hub.InviteTTL)
+
+	inviteToken, err := jwt.CreateInviteJWT(game.configuration.JWT.KeySet, game.hub.id, linkExp)
+	if err != nil {
+		return stay, errors.New("cannot create invite link")
+	}
+
+	invite := InviteServerEvent{
+		Code:    code,
+		Link:    game.configuration.Hub.InviteURL + "?invite=" + url.QueryEscape(inviteToken),
+		LinkExp: linkExp.In(time.UTC).Unix(),
+	}
+
+	return stay, game.sendServerEvent(client, InviteServer, invite, 0)
+}
+
+// remoteHost returns the address of the peer without the port.
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// attemptLimiter counts failed attempts by key within a fixed window.
+type attemptLimiter struct {
+	mutex    sync.Mutex
+	clock    clock.Clock
+	attempts map[string]*attempts
+
+	max    int
+	window time.Duration
+}
+
+type attempts struct {
+	count   int
+	resetAt time.Time
+}
+
+func newAttemptLimiter(clock clock.Clock, max int, window time.Duration) *attemptLimiter {
+	return &attemptLimiter{
+		clock:    clock,
+		attempts: make(map[string]*attempts),
+		max:      max,
+		window:   window,
+	}
+}
+
+func (l *attemptLimiter) allowed(key string) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	a, ok := l.attempts[key]
+	if !ok {
+		return true
+	}
+
+	if !l.clock.Now().Before(a.resetAt) {
+		delete(l.attempts, key)
+
+		return true
+	}
+
+	return a.count < l.max
+}
+
+func (l *attemptLimiter) fail(key string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.clock.Now()
+
+	a, ok := l.attempts[key]
+	if !ok || !now.Before(a.resetAt) {
+		a = &attempts{
+			resetAt: now.Add(l.window),
+		}
+
+		l.attempts[key] = a
+	}
+
+	a.count++
+}
+
+// checkPassword compares the password in constant time, refusing to check it at all
+// after too many failures from the same address.
+func (h *Hub) checkPassword(address string, password string) error {
+	if h.opts.Password == "" {
+		return nil
+	}
+
+	if !h.passwordAttempts.allowed(address) {
+		return errTooManyAttempts
+	}
+
+	// hashing first keeps the comparison independent of the password length
+	expected := sha256.Sum256([]byte(h.opts.Password))
+	actual := sha256.Sum256([]byte(password))
+
+	if subtle.ConstantTimeCompare(expected[:], actual[:]) != 1 {
+		h.passwordAttempts.fail(address)
+
+		return errors.New("incorrect password")
+	}
+
+	return nil
+}
@@ -0,0 +1,33 @@
+package endpoint
+
+import (
+	"mygame/tools/clock"
+	"testing"
+)
+
+func TestAttemptLimiter(t *testing.T) {
+	fake := clock.NewFake(simulationStart)
+	limiter := newAttemptLimiter(fake, maxGuestsPerAddress, guestAttemptWindow)
+
+	for i := 0; i < maxGuestsPerAddress; i++ {
+		if !limiter.allowed("10.0.0.1") {
+			t.Fatalf("attempt %d is refused", i+1)
+		}
+
+		limiter.fail("10.0.0.1")
+	}
+
+	if limiter.allowed("10.0.0.1") {
+		t.Fatal("attempt over the limit is allowed")
+	}
+
+	if !limiter.allowed("10.0.0.2") {
+		t.Fatal("another address is refused")
+	}
+
+	fake.Advance(guestAttemptWindow)
+
+	if !limiter.allowed("10.0.0.1") {
+		t.Fatal("attempt is refused after the window")
+	}
+}
@@ -0,0 +1,217 @@
+package endpoint
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type hubSummary struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	PackName    string    `json:"pack_name"`
+	LeaderLogin string    `json:"leader_login"`
+	Players     int       `json:"players"`
+	MaxPlayers  int       `json:"max_players"`
+	HasPassword bool      `json:"has_password"`
+	Step        Step      `json:"step"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (h *Hub) summary() *hubSummary {
+	step, players := h.published()
+
+	return &hubSummary{
+		ID:          h.id,
+		Name:        h.opts.Name,
+		PackName:    h.game.Name,
+		LeaderLogin: h.leaderLogin,
+		Players:     len(players),
+		MaxPlayers:  h.opts.MaxPlayers,
+		HasPassword: h.opts.Password != "",
+		Step:        step,
+		CreatedAt:   h.createdAt,
+	}
+}
+
+// hubFilter selects hubs by the query of the lobby request.
+type hubFilter struct {
+	name     string
+	pack     string
+	password *bool
+	free     bool
+	step     *Step
+}
+
+func parseHubFilter(query url.Values) (*hubFilter, error) {
+	filter := &hubFilter{
+		name: strings.ToLower(query.Get("name")),
+		pack: strings.ToLower(query.Get("pack")),
+	}
+
+	if value := query.Get("password"); value != "" {
+		password, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, errors.New("incorrect password filter")
+		}
+
+		filter.password = &password
+	}
+
+	if value := query.Get("free"); value != "" {
+		free, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, errors.New("incorrect free filter")
+		}
+
+		filter.free = free
+	}
+
+	if value := query.Get("step"); value != "" {
+		step, err := strconv.Atoi(value)
+		if err != nil || step < int(WaitingStart) || step >= int(Closed) {
+			return nil, errors.New("incorrect step filter")
+		}
+
+		filter.step = (*Step)(&step)
+	}
+
+	return filter, nil
+}
+
+func (f *hubFilter) match(summary *hubSummary) bool {
+	if f.name != "" && !strings.Contains(strings.ToLower(summary.Name), f.name) {
+		return false
+	}
+
+	if f.pack != "" && !strings.Contains(strings.ToLower(summary.PackName), f.pack) {
+		return false
+	}
+
+	if f.password != nil && *f.password != summary.HasPassword {
+		return false
+	}
+
+	if f.free && summary.Players >= summary.MaxPlayers {
+		return false
+	}
+
+	if f.step != nil && *f.step != summary.Step {
+		return false
+	}
+
+	return true
+}
+
+func (e *Endpoint) getHubs(w http.ResponseWriter, r *http.Request) {
+	ctx := e.CreateContext(w, r)
+
+	if r.Method != http.MethodGet {
+		e.responseWriterError(errors.New("method not allowed"), w, http.StatusMethodNotAllowed, ctx, "")
+
+		return
+	}
+
+	query := r.URL.Query()
+
+	filter, err := parseHubFilter(query)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusBadRequest, ctx, "")
+
+		return
+	}
+
+	var limit, offset int
+
+	if value := query.Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			e.responseWriterError(errors.New("incorrect limit"), w, http.StatusBadRequest, ctx, "")
+
+			return
+		}
+	}
+
+	if value := query.Get("offset"); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			e.responseWriterError(errors.New("incorrect offset"), w, http.StatusBadRequest, ctx, "")
+
+			return
+		}
+	}
+
+	summaries := make([]*hubSummary, 0)
+	for _, hub := range listHubs() {
+		summary := hub.summary()
+		if summary.Step == Closed || !filter.match(summary) {
+			continue
+		}
+
+		summaries = append(summaries, summary)
+	}
+
+	total := len(summaries)
+
+	if offset > len(summaries) {
+		offset = len(summaries)
+	}
+
+	summaries = summaries[offset:]
+
+	if limit != 0 && limit < len(summaries) {
+		summaries = summaries[:limit]
+	}
+
+	e.responseWriter(http.StatusOK, map[string]interface{}{
+		"hubs":  summaries,
+		"total": total,
+	}, w, ctx)
+}
+
+func (e *Endpoint) getHub(w http.ResponseWriter, r *http.Request) {
+	if strings.Contains(strings.TrimPrefix(r.URL.Path, HubInfoEndpoint.ToString()), hubMediaPath) {
+		e.getHubMedia(w, r)
+
+		return
+	}
+
+	if strings.HasSuffix(r.URL.Path, hubMediaTokenPath) {
+		e.createMediaToken(w, r)
+
+		return
+	}
+
+	ctx := e.CreateContext(w, r)
+
+	if r.Method != http.MethodGet {
+		e.responseWriterError(errors.New("method not allowed"), w, http.StatusMethodNotAllowed, ctx, "")
+
+		return
+	}
+
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, HubInfoEndpoint.ToString()))
+	if err != nil {
+		e.responseWriterError(errors.New("incorrect hub id"), w, http.StatusBadRequest, ctx, "")
+
+		return
+	}
+
+	hub, ok := findHub(id)
+	if !ok {
+		e.responseWriterError(errors.New("hub not found"), w, http.StatusNotFound, ctx, "")
+
+		return
+	}
+
+	_, players := hub.published()
+
+	e.responseWriter(http.StatusOK, map[string]interface{}{
+		"hub":            hub.summary(),
+		"players":        players,
+		"max_spectators": hub.opts.MaxSpectators,
+	}, w, ctx)
+}
@@ -0,0 +1,235 @@
+package endpoint
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"mime"
+	"mygame/tools/jwt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// hubMediaPath follows the hub id in the path of the media requests.
+	hubMediaPath = "/media/"
+
+	// hubMediaTokenPath follows the hub id in the path of the media token requests.
+	hubMediaTokenPath = "/media_token"
+
+	// Media is unpacked for the whole game, so clients may keep it for as long.
+	mediaCacheControl = "private, max-age=86400"
+
+	// Time a media token is good for.
+	mediaTokenTTL = 15 * time.Minute
+)
+
+// Types of the media SIGame packs usually have, the system mime table misses some of them.
+var mediaTypes = map[string]string{
+	".mp3":  "audio/mpeg",
+	".ogg":  "audio/ogg",
+	".wav":  "audio/wav",
+	".m4a":  "audio/mp4",
+	".mp4":  "video/mp4",
+	".webm": "video/webm",
+}
+
+var errMediaNotFound = errors.New("media not found")
+
+// getHubMedia handles GET /hubs/{id}/media/{type}/{name}, where the type and the name are the ones
+// of the object in the game events. Only the participants of the hub get the files. Browsers cannot
+// set the header for media elements, so a media token of the hub may come in the media_token parameter instead.
+func (e *Endpoint) getHubMedia(w http.ResponseWriter, r *http.Request) {
+	ctx := e.CreateContext(w, r)
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		e.responseWriterError(errors.New("method not allowed"), w, http.StatusMethodNotAllowed, ctx, "")
+
+		return
+	}
+
+	path := strings.SplitN(strings.TrimPrefix(r.URL.Path, HubInfoEndpoint.ToString()), "/", 4)
+	if len(path) != 4 || "/"+path[1]+"/" != hubMediaPath {
+		e.responseWriterError(errMediaNotFound, w, http.StatusNotFound, ctx, "")
+
+		return
+	}
+
+	id, err := strconv.Atoi(path[0])
+	if err != nil {
+		e.responseWriterError(errors.New("incorrect hub id"), w, http.StatusBadRequest, ctx, "")
+
+		return
+	}
+
+	var userID uint64
+	var login string
+
+	if mediaToken := r.URL.Query().Get("media_token"); mediaToken != "" {
+		claims, err := jwt.ParseMediaJWT(e.configuration.JWT.KeySet, mediaToken)
+		if err != nil || claims.HubID != id {
+			e.responseWriterError(errors.New("incorrect media token"), w, http.StatusUnauthorized, ctx, "")
+
+			return
+		}
+
+		userID, login = claims.ID, claims.Login
+	} else {
+		token, status, err := e.authorize(ctx, r)
+		if err != nil {
+			e.responseWriterError(err, w, status, ctx, "")
+
+			return
+		}
+
+		userID, login = token.ID, token.Login
+	}
+
+	hub, ok := findHub(id)
+	if !ok {
+		e.responseWriterError(errors.New("hub not found"), w, http.StatusNotFound, ctx, "")
+
+		return
+	}
+
+	if !hub.isMember(userID, login) {
+		e.responseWriterError(errPermissionDenied, w, http.StatusForbidden, ctx, "")
+
+		return
+	}
+
+	dir, ok := mediaDirs[ObjectType(path[2])]
+	name := path[3]
+	if !ok || !isMediaName(name) {
+		e.responseWriterError(errMediaNotFound, w, http.StatusNotFound, ctx, "")
+
+		return
+	}
+
+	packDir := e.configuration.PackTemporary.Path + "/" + hex.EncodeToString(hub.game.UID[:])
+
+	file, err := openMedia(packDir+"/"+dir, name)
+	if err != nil {
+		e.responseWriterError(errMediaNotFound, w, http.StatusNotFound, ctx, "")
+
+		return
+	}
+
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		e.responseWriterError(errMediaNotFound, w, http.StatusNotFound, ctx, "")
+
+		return
+	}
+
+	e.setCors(w)
+	w.Header().Set("ETag", mediaETag(packDir, dir, name, info))
+	w.Header().Set("Cache-Control", mediaCacheControl)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// html objects are served from the same origin, keep them away from the tokens of the site
+	w.Header().Set("Content-Security-Policy", "sandbox")
+
+	if contentType := mediaType(name); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+
+	http.ServeContent(w, r, name, info.ModTime(), file)
+}
+
+// createMediaToken handles POST /hubs/{id}/media_token, the token is put in the media URLs of the hub
+// and is good for mediaTokenTTL, clients ask for a new one before it expires.
+func (e *Endpoint) createMediaToken(w http.ResponseWriter, r *http.Request) {
+	ctx := e.CreateContext(w, r)
+
+	if r.Method != http.MethodPost {
+		e.responseWriterError(errors.New("method not allowed"), w, http.StatusMethodNotAllowed, ctx, "")
+
+		return
+	}
+
+	token, status, err := e.authorize(ctx, r)
+	if err != nil {
+		e.responseWriterError(err, w, status, ctx, "")
+
+		return
+	}
+
+	id, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, HubInfoEndpoint.ToString()), hubMediaTokenPath))
+	if err != nil {
+		e.responseWriterError(errors.New("incorrect hub id"), w, http.StatusBadRequest, ctx, "")
+
+		return
+	}
+
+	hub, ok := findHub(id)
+	if !ok {
+		e.responseWriterError(errors.New("hub not found"), w, http.StatusNotFound, ctx, "")
+
+		return
+	}
+
+	if !hub.isMember(token.ID, token.Login) {
+		e.responseWriterError(errPermissionDenied, w, http.StatusForbidden, ctx, "")
+
+		return
+	}
+
+	exp := e.clock.Now().Add(mediaTokenTTL)
+
+	mediaToken, err := jwt.CreateMediaJWT(e.configuration.JWT.KeySet, id, token.ID, token.Login, exp)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "create media token error")
+
+		return
+	}
+
+	e.responseWriter(http.StatusOK, map[string]interface{}{
+		"media_token": mediaToken,
+		"exp":         exp.In(time.UTC).Unix(),
+	}, w, ctx)
+}
+
+// mediaETag is the content hash of the file when the manifest of the pack has it,
+// otherwise the pack, the name, the size and the modification time of the file.
+func mediaETag(packDir, dir, name string, info os.FileInfo) string {
+	if hash, ok := packMediaHash(packDir, dir+"/"+name); ok {
+		return `"` + hash + `"`
+	}
+
+	sum := sha256.Sum256([]byte(packDir + "/" + dir + "/" + name + "/" +
+		strconv.FormatInt(info.Size(), 10) + "/" + strconv.FormatInt(info.ModTime().UnixNano(), 10)))
+
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// isMediaName tells if the name may only refer to a file right in the media directory.
+func isMediaName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+// openMedia opens the file of the object, SIGame escapes the names of the files in the archives.
+func openMedia(dir, name string) (*os.File, error) {
+	file, err := os.Open(dir + "/" + url.PathEscape(name))
+	if err == nil || !os.IsNotExist(err) {
+		return file, err
+	}
+
+	return os.Open(dir + "/" + name)
+}
+
+func mediaType(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+
+	if contentType, ok := mediaTypes[ext]; ok {
+		return contentType
+	}
+
+	return mime.TypeByExtension(ext)
+}
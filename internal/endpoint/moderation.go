@@ -0,0 +1,356 @@
+package endpoint
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"mygame/internal/models"
+	"mygame/tools/jwt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Time a moderator waits for the game to carry out the command.
+const commandTimeout = 10 * time.Second
+
+var errHubClosed = errors.New("hub is closed")
+
+type KickClientEvent struct {
+	// Queue ID of the player, or the user to remove from the hub whatever the role.
+	QueueID int
+	UserID  uint64
+	Reason  string
+}
+
+type CloseHubClientEvent struct {
+	Reason string
+}
+
+type KickedServerEvent struct {
+	Reason string
+}
+
+type HubClosedServerEvent struct {
+	Reason string
+}
+
+// guardRole lets only users with one of the account roles send the event.
+func guardRole(roles ...string) func(game *Game, event *ClientEvent) error {
+	return func(game *Game, event *ClientEvent) error {
+		for _, role := range roles {
+			if event.claims.Role == role {
+				return nil
+			}
+		}
+
+		return errPermissionDenied
+	}
+}
+
+// handleKick removes the player from the game for good, a kicked user cannot join the hub again.
+func handleKick(game *Game, event *ClientEvent) (Step, error) {
+	var kick KickClientEvent
+
+	err := json.Unmarshal(event.Data, &kick)
+	if err != nil || kick.QueueID <= 0 && kick.UserID == 0 {
+		return stay, errors.New("incorrect kick")
+	}
+
+	var kicked bool
+
+	for client := range game.players {
+		queueID := game.playersQueueIDByToken[client.token]
+		if queueID != kick.QueueID && (kick.UserID == 0 || client.id != kick.UserID) {
+			continue
+		}
+
+		delete(game.players, client)
+
+		game.dismiss(client, kick.Reason)
+		game.broadcastServerEvent(LeaveServer, LeaveServerEvent{QueueID: queueID}, 0)
+
+		kicked = true
+	}
+
+	for id, player := range game.disconnected {
+		queueID := game.playersQueueIDByToken[player.client.token]
+		if queueID != kick.QueueID && id != kick.UserID {
+			continue
+		}
+
+		delete(game.disconnected, id)
+
+		game.hub.kickUser(id)
+		game.broadcastServerEvent(LeaveServer, LeaveServerEvent{QueueID: queueID}, 0)
+
+		kicked = true
+	}
+
+	if kick.UserID != 0 {
+		for token := range game.spectators {
+			client, ok := game.hub.client(token)
+			if !ok || client.id != kick.UserID {
+				continue
+			}
+
+			delete(game.spectators, token)
+
+			game.dismiss(client, kick.Reason)
+
+			kicked = true
+		}
+	}
+
+	if !kicked {
+		return stay, errors.New("player not found")
+	}
+
+	if game.isAbandoned() {
+		return Closed, nil
+	}
+
+	return stay, nil
+}
+
+// dismiss tells the client why it is kicked and closes its connection.
+func (game *Game) dismiss(client *Client, reason string) {
+	game.kicked[client.token] = true
+
+	if client.id != 0 {
+		game.hub.kickUser(client.id)
+	}
+
+	game.sendServerEvent(client, KickedServer, KickedServerEvent{Reason: reason}, 0)
+
+	// the hub is busy passing the event to the game, so it is told in the background
+	hub := game.hub
+	go func() {
+		select {
+		case hub.unregister <- client:
+		case <-hub.close:
+		}
+	}()
+}
+
+func handleCloseHub(game *Game, event *ClientEvent) (Step, error) {
+	var closeHub CloseHubClientEvent
+
+	err := json.Unmarshal(event.Data, &closeHub)
+	if err != nil {
+		return stay, errors.New("incorrect close")
+	}
+
+	game.broadcastServerEvent(HubClosedServer, HubClosedServerEvent{Reason: closeHub.Reason}, 0)
+
+	return Closed, nil
+}
+
+// answer passes the result of the event to the server that has sent it.
+func (event *ClientEvent) answer(err error) {
+	if event.reply != nil {
+		event.reply <- err
+	}
+}
+
+func (h *Hub) kickUser(userID uint64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.kickedUsers[userID] = true
+}
+
+func (h *Hub) isKicked(userID uint64) bool {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	return h.kickedUsers[userID]
+}
+
+// command sends the event to the game on behalf of the holder of the access token and waits for the result.
+func (h *Hub) command(ctx context.Context, accessToken string, eventType EventType, data interface{}) error {
+	rawData, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	event := &ClientEvent{
+		Type:  eventType,
+		Token: accessToken,
+		Data:  rawData,
+		reply: make(chan error, 1),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+
+	select {
+	case h.game.eventChannel <- event:
+	case <-h.close:
+		return errHubClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err = <-event.reply:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// authorize checks the access token of the request and that the user has one of the account roles,
+// any authenticated user passes when no roles are given.
+func (e *Endpoint) authorize(ctx context.Context, r *http.Request, roles ...string) (*jwt.Claims, int, error) {
+	token, err := jwt.ParseJWT(e.configuration.JWT.KeySet, r.Header.Get("Authorization"))
+	if err != nil {
+		return nil, http.StatusUnauthorized, err
+	}
+
+	revoked, err := e.isRevoked(ctx, token)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	if revoked {
+		return nil, http.StatusUnauthorized, errTokenRevoked
+	}
+
+	if len(roles) == 0 {
+		return token, http.StatusOK, nil
+	}
+
+	for _, role := range roles {
+		if token.Role == role {
+			return token, http.StatusOK, nil
+		}
+	}
+
+	return nil, http.StatusForbidden, errPermissionDenied
+}
+
+// moderateHub handles POST /moderation/hubs/{id}/kick for moderators
+// and POST /moderation/hubs/{id}/close for admins.
+func (e *Endpoint) moderateHub(w http.ResponseWriter, r *http.Request) {
+	ctx := e.CreateContext(w, r)
+
+	if r.Method != http.MethodPost {
+		e.responseWriterError(errors.New("method not allowed"), w, http.StatusMethodNotAllowed, ctx, "")
+
+		return
+	}
+
+	path := strings.Split(strings.TrimPrefix(r.URL.Path, ModerationHubEndpoint.ToString()), "/")
+	if len(path) != 2 {
+		e.responseWriterError(errors.New("not found"), w, http.StatusNotFound, ctx, "")
+
+		return
+	}
+
+	id, err := strconv.Atoi(path[0])
+	if err != nil {
+		e.responseWriterError(errors.New("incorrect hub id"), w, http.StatusBadRequest, ctx, "")
+
+		return
+	}
+
+	var eventType EventType
+	var roles []string
+
+	switch path[1] {
+	case "kick":
+		eventType = Kick
+		roles = []string{models.RoleModerator, models.RoleAdmin}
+	case "close":
+		eventType = CloseHub
+		roles = []string{models.RoleAdmin}
+	default:
+		e.responseWriterError(errors.New("not found"), w, http.StatusNotFound, ctx, "")
+
+		return
+	}
+
+	_, status, err := e.authorize(ctx, r, roles...)
+	if err != nil {
+		e.responseWriterError(err, w, status, ctx, "")
+
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusBadRequest, ctx, "read body error")
+
+		return
+	}
+
+	if len(body) == 0 {
+		body = []byte("{}")
+	}
+
+	var data json.RawMessage
+
+	err = json.Unmarshal(body, &data)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusBadRequest, ctx, "unmarshal body to struct error")
+
+		return
+	}
+
+	hub, ok := findHub(id)
+	if !ok {
+		e.responseWriterError(errors.New("hub not found"), w, http.StatusNotFound, ctx, "")
+
+		return
+	}
+
+	err = hub.command(ctx, r.Header.Get("Authorization"), eventType, data)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusBadRequest, ctx, "")
+
+		return
+	}
+
+	e.responseWriter(http.StatusOK, map[string]interface{}{}, w, ctx)
+}
+
+// kickEverywhere removes the user from every hub the user is in, used when the user is banned.
+// The hubs are told at once, a busy game does not hold the others up.
+func kickEverywhere(ctx context.Context, accessToken string, userID uint64) {
+	logger := ctx.Value(LoggerContext).(*zap.Logger)
+
+	var wg sync.WaitGroup
+
+	for _, hub := range listHubs() {
+		if !hub.hasUser(userID) {
+			continue
+		}
+
+		wg.Add(1)
+
+		go func(hub *Hub) {
+			defer wg.Done()
+
+			err := hub.command(ctx, accessToken, Kick, KickClientEvent{
+				UserID: userID,
+				Reason: errUserBanned.Error(),
+			})
+			// the hub may have closed since it was listed
+			if err != nil && err != errHubClosed {
+				logger.Error(
+					"kick banned user error",
+					zap.Int("hub_id", hub.id),
+					zap.Uint64("user_id", userID),
+					zap.Error(err),
+				)
+			}
+		}(hub)
+	}
+
+	wg.Wait()
+}
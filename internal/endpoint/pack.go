@@ -0,0 +1,160 @@
+package endpoint
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"go.uber.org/zap"
+	"io"
+	"io/ioutil"
+	"mygame/internal/models"
+	"mygame/internal/repository"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const siGameExtension = ".siq"
+
+var errPackInvalid = errors.New("pack is invalid")
+
+// packFileName is the name the archive is stored with, content addressed so that uploads never collide.
+func packFileName(hash models.PackHash) string {
+	return hex.EncodeToString(hash[:]) + siGameExtension + ToArchiveType
+}
+
+// packDisplayName strips the directories and the extensions from the name of an uploaded file.
+func packDisplayName(fileName string) string {
+	name := filepath.Base(strings.ReplaceAll(fileName, "\\", "/"))
+	name = strings.TrimSuffix(name, ToArchiveType)
+
+	return strings.TrimSuffix(name, siGameExtension)
+}
+
+// readPackFile hashes the archive and validates it.
+func readPackFile(path string, pack *models.Pack) (*models.PackReport, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	digest := sha256.New()
+	if _, err = io.Copy(digest, file); err != nil {
+		return nil, err
+	}
+
+	copy(pack.Hash[:], digest.Sum(nil))
+
+	return validatePack(file, pack.Size, pack), nil
+}
+
+// storePack validates the received archive, moves it into the packs directory and adds it to the catalog.
+// A pack with errors in the report is rejected.
+func (e *Endpoint) storePack(ctx context.Context, path string, pack *models.Pack) (*models.Pack, *models.PackReport, int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, http.StatusInternalServerError, err
+	}
+
+	report := validatePack(file, pack.Size, pack)
+	file.Close()
+
+	if !report.Valid {
+		return nil, report, http.StatusUnprocessableEntity, errPackInvalid
+	}
+
+	// uploaded before, the catalog keeps the first uploader
+	existing, err := e.repository.PackRepository.GetPack(ctx, pack.Hash)
+	if err == nil {
+		os.Remove(path)
+
+		return existing, report, http.StatusOK, nil
+	} else if err != repository.ErrPackNotFound {
+		return nil, nil, http.StatusInternalServerError, err
+	}
+
+	pack.FileName = packFileName(pack.Hash)
+	archivePath := e.configuration.Pack.Path + SiGameArchivesPath + "/" + pack.FileName
+
+	err = os.Rename(path, archivePath)
+	if err != nil {
+		return nil, nil, http.StatusInternalServerError, err
+	}
+
+	created, err := e.repository.PackRepository.CreatePack(ctx, pack)
+	if err != nil {
+		os.Remove(archivePath)
+
+		return nil, nil, http.StatusInternalServerError, err
+	}
+
+	// uploaded at the same time by somebody else, the archive is the same
+	if !created {
+		pack, err = e.repository.PackRepository.GetPack(ctx, pack.Hash)
+		if err != nil {
+			return nil, nil, http.StatusInternalServerError, err
+		}
+	}
+
+	return pack, report, http.StatusOK, nil
+}
+
+// BackfillPacks fills the empty catalog with the archives lying in the packs directory.
+func (e *Endpoint) BackfillPacks(ctx context.Context) (int, error) {
+	count, err := e.repository.PackRepository.CountPacks(ctx)
+	if err != nil || count != 0 {
+		return 0, err
+	}
+
+	dir := e.configuration.Pack.Path + SiGameArchivesPath
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var added int
+
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ToArchiveType) {
+			continue
+		}
+
+		pack := &models.Pack{
+			FileName:   f.Name(),
+			Name:       packDisplayName(f.Name()),
+			Size:       f.Size(),
+			UploadedAt: f.ModTime().UTC(),
+		}
+
+		report, err := readPackFile(dir+"/"+f.Name(), pack)
+		if err != nil {
+			return added, err
+		}
+
+		if !report.Valid {
+			e.logger.Warn(
+				"skip invalid pack",
+				zap.String("file_name", f.Name()),
+				zap.Any("problems", report.Problems),
+			)
+
+			continue
+		}
+
+		created, err := e.repository.PackRepository.CreatePack(ctx, pack)
+		if err != nil {
+			return added, err
+		}
+
+		if created {
+			added++
+		}
+	}
+
+	return added, nil
+}
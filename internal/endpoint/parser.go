@@ -2,11 +2,13 @@ package endpoint
 
 import (
 	"encoding/xml"
+	"errors"
 	"io/ioutil"
 	"mygame/internal/models"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const (
@@ -17,6 +19,36 @@ const (
 	defaultImagesPath = "/Images"
 
 	defaultVideoPath = "/Video"
+
+	defaultHTMLPath = "/Html"
+)
+
+// Params of format 5 questions.
+const (
+	questionContentParam = "question"
+	answerContentParam   = "answer"
+	answerTypeParam      = "answerType"
+	answerOptionsParam   = "answerOptions"
+	priceParam           = "price"
+	selectionModeParam   = "selectionMode"
+
+	// The secret question may be given to the chooser as well.
+	selectionModeAny = "any"
+)
+
+// Question types of format 5 that the game plays as auctions and cats in a bag.
+const (
+	stakeQuestion             = "stake"
+	secretQuestion            = "secret"
+	secretPublicPriceQuestion = "secretPublicPrice"
+	secretNoQuestion          = "secretNoQuestion"
+)
+
+const (
+	// Atom of format 4 with the words of the host.
+	atomSay ObjectType = "say"
+	// Format 5 calls audio by its name.
+	itemAudio ObjectType = "audio"
 )
 
 type Parser struct {
@@ -65,54 +97,43 @@ func (p *Parser) ParsingSiGamePack(packName string) error {
 
 func (p *Parser) InitMyGame() error {
 	p.myGame = &Game{
-		Name:   p.siGame.Name,
-		Author: p.siGame.Info.Authors.Author,
-		Date:   p.siGame.Date,
+		Name: p.siGame.Name,
+		Date: p.siGame.Date,
+	}
+
+	// the validator lets packs without authors and with empty themes through
+	if p.siGame.Info != nil && p.siGame.Info.Authors != nil {
+		p.myGame.Author = p.siGame.Info.Authors.Author
 	}
 
+	if p.siGame.Rounds == nil {
+		return errors.New("pack has no rounds")
+	}
+
+	version := formatVersion(p.siGame)
+
 	for i, round := range p.siGame.Rounds.Round {
 		var themes []*Theme
 
+		if round.Themes == nil {
+			return errors.New("round has no themes")
+		}
+
 		for j, theme := range round.Themes.Theme {
 			var quests []*Question
 
-			for k, question := range theme.Questions.Question {
-				var answer []*Object
-
-				answer = append(answer, &Object{
-					Id:   1,
-					Type: Answer,
-					Src:  strings.Join(question.Right.Answer, " "),
-				})
-
-				var scene []*Object
-
-				for z, atom := range question.Scenario.Atom {
-					if atom.Type == "" {
-						atom.Type = Text.String()
-					} else if atom.Type == Video.String() || atom.Type == Image.String() ||
-						atom.Type == Audio.String() {
-						atom.Text = strings.ReplaceAll(atom.Text, "@", "")
-					}
-
-					scene = append(scene, &Object{
-						Id:   z + 1,
-						Src:  atom.Text,
-						Type: ObjectType(atom.Type),
-					})
-				}
+			if theme.Questions == nil {
+				theme.Questions = new(models.Questions)
+			}
 
-				price, err := strconv.Atoi(question.Price)
+			for k, question := range theme.Questions.Question {
+				quest, err := convertQuestion(question, version)
 				if err != nil {
 					return err
 				}
 
-				quests = append(quests, &Question{
-					Id:     k + 1,
-					Price:  price,
-					Scene:  scene,
-					Answer: answer,
-				})
+				quest.Id = k + 1
+				quests = append(quests, quest)
 			}
 
 			themes = append(themes, &Theme{
@@ -125,6 +146,7 @@ func (p *Parser) InitMyGame() error {
 		p.myGame.Rounds = append(p.myGame.Rounds, &Round{
 			Id:     i + 1,
 			Name:   round.Name,
+			Type:   ObjectType(round.Type),
 			Themes: themes,
 		})
 	}
@@ -132,6 +154,231 @@ func (p *Parser) InitMyGame() error {
 	return nil
 }
 
+// formatVersion returns the major version of the SIGame format, packs of format 5 and newer
+// keep the content of the questions in params instead of scenarios.
+func formatVersion(siGame *models.Package) int {
+	version, err := strconv.ParseFloat(siGame.Version, 64)
+	if err == nil && version >= 1 {
+		return int(version)
+	}
+
+	if siGame.Rounds == nil {
+		return 4
+	}
+
+	for _, round := range siGame.Rounds.Round {
+		if round.Themes == nil {
+			continue
+		}
+
+		for _, theme := range round.Themes.Theme {
+			if theme.Questions == nil {
+				continue
+			}
+
+			for _, question := range theme.Questions.Question {
+				if question.Params != nil {
+					return 5
+				}
+			}
+		}
+	}
+
+	return 4
+}
+
+// convertQuestion maps the question of either format onto the game model. The question is returned
+// even when the price is not a number, so that the validator could look further.
+func convertQuestion(question *models.Question, version int) (*Question, error) {
+	quest := &Question{
+		Type:       Simple,
+		Params:     make(map[string]string),
+		AnswerType: AnswerTypeText,
+	}
+
+	var answers []string
+	if question.Right != nil {
+		answers = question.Right.Answer
+	}
+
+	if question.Wrong != nil {
+		quest.Wrong = question.Wrong.Answer
+	}
+
+	quest.Answer = append(quest.Answer, &Object{
+		Id:            1,
+		Type:          Answer,
+		Src:           strings.Join(answers, " "),
+		Placement:     PlacementScreen,
+		WaitForFinish: true,
+	})
+
+	if version >= 5 {
+		convertQuestionParams(question, quest)
+	} else {
+		convertQuestionScenario(question, quest)
+	}
+
+	price, err := strconv.Atoi(question.Price)
+	if err != nil {
+		return quest, err
+	}
+
+	quest.Price = price
+
+	return quest, nil
+}
+
+// convertQuestionScenario reads the atoms and the type element of format 4 and older.
+func convertQuestionScenario(question *models.Question, quest *Question) {
+	if question.Scenario != nil {
+		for z, atom := range question.Scenario.Atom {
+			object := &Object{
+				Id:            z + 1,
+				Type:          ObjectType(atom.Type),
+				Src:           atom.Text,
+				Placement:     PlacementScreen,
+				WaitForFinish: true,
+			}
+
+			switch object.Type {
+			case "":
+				object.Type = Text
+			case atomSay:
+				object.Type = Text
+				object.Placement = PlacementReplic
+			case Video, Image, Audio:
+				// media without @ is a link outside of the pack
+				object.IsRef = strings.HasPrefix(atom.Text, "@")
+				object.Src = strings.TrimPrefix(atom.Text, "@")
+			}
+
+			if seconds, err := strconv.ParseFloat(atom.Time, 64); err == nil && seconds > 0 {
+				object.Duration = int64(seconds * 1000)
+			}
+
+			quest.Scene = append(quest.Scene, object)
+		}
+	}
+
+	if question.Type != nil && question.Type.Name != "" {
+		quest.Type = ObjectType(question.Type.Name)
+
+		for _, param := range question.Type.Param {
+			quest.Params[param.Name] = param.Text
+		}
+	}
+}
+
+// convertQuestionParams reads the params of format 5 and newer: the content of the question and of the answer,
+// the answer type with its options and the params of the question type.
+func convertQuestionParams(question *models.Question, quest *Question) {
+	if question.Params != nil {
+		for _, param := range question.Params.Param {
+			switch {
+			case param.Name == questionContentParam:
+				quest.Scene = append(quest.Scene, itemObjects(param.Item, len(quest.Scene))...)
+			case param.Name == answerContentParam:
+				quest.Answer = append(quest.Answer, itemObjects(param.Item, len(quest.Answer))...)
+			case param.Name == answerTypeParam:
+				if answerType := strings.TrimSpace(param.Text); answerType != "" {
+					quest.AnswerType = answerType
+				}
+			case param.Name == answerOptionsParam:
+				for _, option := range param.Param {
+					quest.AnswerOptions = append(quest.AnswerOptions, &AnswerOption{
+						Label:   option.Name,
+						Content: itemObjects(option.Item, 0),
+					})
+				}
+			case param.NumberSet != nil:
+				// a fixed price of a secret question is the cost of the cat in a bag
+				if param.Name == priceParam && param.NumberSet.Minimum > 0 &&
+					param.NumberSet.Minimum == param.NumberSet.Maximum {
+					quest.Params[catCostParam] = strconv.Itoa(param.NumberSet.Minimum)
+				}
+			default:
+				quest.Params[param.Name] = strings.TrimSpace(param.Text)
+			}
+		}
+	}
+
+	switch question.TypeName {
+	case "", Simple.String():
+		quest.Type = Simple
+	case stakeQuestion:
+		quest.Type = Auction
+	case secretQuestion, secretPublicPriceQuestion, secretNoQuestion:
+		quest.Type = Cat
+
+		if quest.Params[selectionModeParam] == selectionModeAny {
+			quest.Type = BagCat
+			quest.Params[catSelfParam] = catSelfAllowed
+		}
+	default:
+		quest.Type = ObjectType(question.TypeName)
+	}
+}
+
+// itemObjects converts the content items of format 5, numbering them after the objects there are already.
+func itemObjects(items []*models.Item, count int) []*Object {
+	objects := make([]*Object, 0, len(items))
+
+	for i, item := range items {
+		object := &Object{
+			Id:            count + i + 1,
+			Type:          ObjectType(item.Type),
+			Src:           item.Text,
+			IsRef:         item.IsRef,
+			Placement:     item.Placement,
+			Duration:      parseTimeSpan(item.Duration).Milliseconds(),
+			WaitForFinish: !strings.EqualFold(item.WaitForFinish, "false"),
+		}
+
+		switch object.Type {
+		case "":
+			object.Type = Text
+		case itemAudio:
+			object.Type = Audio
+		}
+
+		if object.Placement == "" {
+			object.Placement = PlacementScreen
+		}
+
+		objects = append(objects, object)
+	}
+
+	return objects
+}
+
+// parseTimeSpan reads the durations of format 5 written as hh:mm:ss with optional fractions of a second,
+// zero if the duration is missing or incorrect.
+func parseTimeSpan(value string) time.Duration {
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 {
+		return 0
+	}
+
+	hours, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0
+	}
+
+	minutes, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0
+	}
+
+	seconds, err := strconv.ParseFloat(parts[2], 64)
+	if err != nil {
+		return 0
+	}
+
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute +
+		time.Duration(seconds*float64(time.Second))
+}
+
 func (p *Parser) GetMyGame() *Game {
 	return p.myGame
 }
@@ -0,0 +1,272 @@
+package endpoint
+
+import (
+	"encoding/xml"
+	"mygame/internal/models"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const formatFiveContent = `<?xml version="1.0" encoding="utf-8"?>
+<package name="Cats" version="5" date="01.02.2023">
+  <info><authors><author>Cat</author></authors></info>
+  <rounds>
+    <round name="First">
+      <themes>
+        <theme name="Pets">
+          <questions>
+            <question price="100">
+              <params>
+                <param name="question" type="content">
+                  <item>Who is it?</item>
+                  <item type="image" isRef="True" duration="00:00:05.5">cat.jpg</item>
+                  <item type="audio" isRef="True" placement="background" waitForFinish="False">meow.mp3</item>
+                </param>
+                <param name="answer" type="content">
+                  <item type="video" isRef="True" placement="screen">cat.mp4</item>
+                </param>
+              </params>
+              <right><answer>Cat</answer></right>
+              <wrong><answer>Dog</answer></wrong>
+            </question>
+            <question price="200" type="secret">
+              <params>
+                <param name="selectionMode">any</param>
+                <param name="price" type="numberSet"><numberSet minimum="500" maximum="500" step="0" /></param>
+                <param name="question" type="content"><item>Whose is the bag?</item></param>
+              </params>
+              <right><answer>Cat's</answer></right>
+            </question>
+            <question price="300">
+              <params>
+                <param name="question" type="content"><item>Which one purrs?</item></param>
+                <param name="answerType">select</param>
+                <param name="answerOptions" type="group">
+                  <param name="A" type="content"><item>Dog</item></param>
+                  <param name="B" type="content"><item type="image" isRef="True">cat.jpg</item></param>
+                </param>
+              </params>
+              <right><answer>B</answer></right>
+            </question>
+            <question price="400" type="stake">
+              <params>
+                <param name="question" type="content"><item>How many lives?</item></param>
+              </params>
+              <right><answer>Nine</answer></right>
+            </question>
+          </questions>
+        </theme>
+      </themes>
+    </round>
+  </rounds>
+</package>`
+
+const formatFourContent = `<?xml version="1.0" encoding="utf-8"?>
+<package name="Cats" version="4">
+  <rounds>
+    <round name="First">
+      <themes>
+        <theme name="Pets">
+          <questions>
+            <question price="100">
+              <scenario>
+                <atom>Who is it?</atom>
+                <atom type="say">Listen carefully</atom>
+                <atom type="image" time="2.5">@cat.jpg</atom>
+                <atom type="video">https://example.com/cat.mp4</atom>
+              </scenario>
+              <right><answer>Cat</answer></right>
+            </question>
+            <question price="200">
+              <type name="cat">
+                <param name="theme">Dogs</param>
+                <param name="cost">300</param>
+              </type>
+              <scenario><atom>Who barks?</atom></scenario>
+              <right><answer>Dog</answer></right>
+            </question>
+          </questions>
+        </theme>
+      </themes>
+    </round>
+  </rounds>
+</package>`
+
+func parseTestPack(t *testing.T, content string) *Game {
+	t.Helper()
+
+	packsPath := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(packsPath, "pack"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(packsPath, "pack", defaultContentName), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	parser := NewParser(packsPath)
+
+	if err := parser.ParsingSiGamePack("pack"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := parser.InitMyGame(); err != nil {
+		t.Fatal(err)
+	}
+
+	return parser.GetMyGame()
+}
+
+func checkObjects(t *testing.T, name string, got []*Object, want []Object) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("%s has %d objects, want %d", name, len(got), len(want))
+	}
+
+	for i := range want {
+		if *got[i] != want[i] {
+			t.Errorf("%s object %d is %+v, want %+v", name, i+1, *got[i], want[i])
+		}
+	}
+}
+
+func TestFormatVersion(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		content string
+		want    int
+	}{
+		{name: "version 5", content: `<package version="5"/>`, want: 5},
+		{name: "version 5.0", content: `<package version="5.0"/>`, want: 5},
+		{name: "version 4", content: `<package version="4"><rounds><round><themes><theme><questions>` +
+			`<question><params/></question></questions></theme></themes></round></rounds></package>`, want: 4},
+		{name: "no version with params", content: `<package><rounds><round><themes><theme><questions>` +
+			`<question><params/></question></questions></theme></themes></round></rounds></package>`, want: 5},
+		{name: "no version with scenario", content: `<package><rounds><round><themes><theme><questions>` +
+			`<question><scenario/></question></questions></theme></themes></round></rounds></package>`, want: 4},
+		{name: "no rounds", content: `<package/>`, want: 4},
+	} {
+		var siGame models.Package
+
+		if err := xml.Unmarshal([]byte(test.content), &siGame); err != nil {
+			t.Fatal(err)
+		}
+
+		if version := formatVersion(&siGame); version != test.want {
+			t.Errorf("%s: version is %d, want %d", test.name, version, test.want)
+		}
+	}
+}
+
+func TestParserFormatFive(t *testing.T) {
+	game := parseTestPack(t, formatFiveContent)
+
+	if game.Name != "Cats" || game.Author != "Cat" || len(game.Rounds) != 1 || len(game.Rounds[0].Themes) != 1 {
+		t.Fatalf("game is %+v", game)
+	}
+
+	quests := game.Rounds[0].Themes[0].Quests
+	if len(quests) != 4 {
+		t.Fatalf("theme has %d questions", len(quests))
+	}
+
+	simple := quests[0]
+	if simple.Id != 1 || simple.Price != 100 || simple.Type != Simple || simple.AnswerType != AnswerTypeText ||
+		len(simple.Wrong) != 1 || simple.Wrong[0] != "Dog" {
+		t.Errorf("simple question is %+v", simple)
+	}
+
+	checkObjects(t, "scene", simple.Scene, []Object{
+		{Id: 1, Type: Text, Src: "Who is it?", Placement: PlacementScreen, WaitForFinish: true},
+		{Id: 2, Type: Image, Src: "cat.jpg", IsRef: true, Placement: PlacementScreen, Duration: 5500, WaitForFinish: true},
+		{Id: 3, Type: Audio, Src: "meow.mp3", IsRef: true, Placement: PlacementBackground},
+	})
+
+	// the right answer goes first, the content of the answer follows it
+	checkObjects(t, "answer", simple.Answer, []Object{
+		{Id: 1, Type: Answer, Src: "Cat", Placement: PlacementScreen, WaitForFinish: true},
+		{Id: 2, Type: Video, Src: "cat.mp4", IsRef: true, Placement: PlacementScreen, WaitForFinish: true},
+	})
+
+	secret := quests[1]
+	if secret.Type != BagCat || secret.Price != 200 || secret.Params[catCostParam] != "500" ||
+		secret.Params[catSelfParam] != catSelfAllowed {
+		t.Errorf("secret question is %+v with the params %v", secret, secret.Params)
+	}
+
+	selection := quests[2]
+	if selection.AnswerType != AnswerTypeSelect || len(selection.AnswerOptions) != 2 {
+		t.Fatalf("select question is %+v", selection)
+	}
+
+	for i, want := range []struct {
+		label  string
+		object Object
+	}{
+		{label: "A", object: Object{Id: 1, Type: Text, Src: "Dog", Placement: PlacementScreen, WaitForFinish: true}},
+		{label: "B", object: Object{Id: 1, Type: Image, Src: "cat.jpg", IsRef: true, Placement: PlacementScreen, WaitForFinish: true}},
+	} {
+		option := selection.AnswerOptions[i]
+		if option.Label != want.label {
+			t.Errorf("option %d is labelled %q, want %q", i+1, option.Label, want.label)
+		}
+
+		checkObjects(t, "option "+want.label, option.Content, []Object{want.object})
+	}
+
+	if stake := quests[3]; stake.Type != Auction || stake.Price != 400 {
+		t.Errorf("stake question is %+v", stake)
+	}
+}
+
+func TestParserFormatFour(t *testing.T) {
+	game := parseTestPack(t, formatFourContent)
+
+	quests := game.Rounds[0].Themes[0].Quests
+	if len(quests) != 2 {
+		t.Fatalf("theme has %d questions", len(quests))
+	}
+
+	simple := quests[0]
+	if simple.Type != Simple || simple.Price != 100 || simple.AnswerType != AnswerTypeText {
+		t.Errorf("simple question is %+v", simple)
+	}
+
+	checkObjects(t, "scene", simple.Scene, []Object{
+		{Id: 1, Type: Text, Src: "Who is it?", Placement: PlacementScreen, WaitForFinish: true},
+		{Id: 2, Type: Text, Src: "Listen carefully", Placement: PlacementReplic, WaitForFinish: true},
+		{Id: 3, Type: Image, Src: "cat.jpg", IsRef: true, Placement: PlacementScreen, Duration: 2500, WaitForFinish: true},
+		// media without @ is a link outside of the pack
+		{Id: 4, Type: Video, Src: "https://example.com/cat.mp4", Placement: PlacementScreen, WaitForFinish: true},
+	})
+
+	checkObjects(t, "answer", simple.Answer, []Object{
+		{Id: 1, Type: Answer, Src: "Cat", Placement: PlacementScreen, WaitForFinish: true},
+	})
+
+	cat := quests[1]
+	if cat.Type != Cat || cat.Params["theme"] != "Dogs" || cat.Params[catCostParam] != "300" {
+		t.Errorf("cat question is %+v with the params %v", cat, cat.Params)
+	}
+}
+
+func TestParseTimeSpan(t *testing.T) {
+	for value, want := range map[string]time.Duration{
+		"00:00:05":     5 * time.Second,
+		"00:01:02.25":  time.Minute + 2250*time.Millisecond,
+		"01:00:00":     time.Hour,
+		"":             0,
+		"5":            0,
+		"00:xx:05":     0,
+		"00:00:05:00":  0,
+		"00:00:second": 0,
+	} {
+		if got := parseTimeSpan(value); got != want {
+			t.Errorf("%q is %v, want %v", value, got, want)
+		}
+	}
+}
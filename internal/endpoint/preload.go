@@ -0,0 +1,263 @@
+package endpoint
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// MediaFile is a file of the pack a client may load before the question shows it,
+// the type and the source are the ones of the objects and of the media requests.
+type MediaFile struct {
+	Type     ObjectType
+	Src      string
+	Size     int64
+	MimeType string
+	// Hex encoded SHA-256 of the content.
+	Hash string
+}
+
+// RoundManifestServerEvent lists the media of the round when the round is announced.
+type RoundManifestServerEvent struct {
+	RoundID int
+	Files   []*MediaFile
+}
+
+type PreloadProgressClientEvent struct {
+	RoundID int
+	// Count of the files of the manifest the client has loaded.
+	Loaded int
+}
+
+// PreloadProgressServerEvent is sent to the leader alone.
+type PreloadProgressServerEvent struct {
+	QueueID int
+	RoundID int
+	Loaded  int
+	Total   int
+	Done    bool
+}
+
+// packMedia keeps the media of the unpacked packs by pack directory, hubs playing the same pack hash it once.
+var (
+	packMedia      = make(map[string]*packMediaFiles)
+	packMediaMutex sync.Mutex
+)
+
+// packMediaFiles are the media files of a pack by media directory and name, nil for the files the pack does not have.
+type packMediaFiles struct {
+	once  sync.Once
+	done  chan struct{}
+	files map[string]*MediaFile
+	err   error
+}
+
+// buildRoundManifests lists the media every round refers to, a file shown in several questions is listed once per round.
+// The files missing from the unpacked pack are left out, the pack validation reports them on upload.
+func buildRoundManifests(game *Game, packDir string) error {
+	packMediaMutex.Lock()
+	media, ok := packMedia[packDir]
+	if !ok {
+		media = &packMediaFiles{done: make(chan struct{})}
+		packMedia[packDir] = media
+	}
+	packMediaMutex.Unlock()
+
+	media.once.Do(func() {
+		media.files, media.err = readPackMedia(game, packDir)
+		close(media.done)
+	})
+
+	if media.err != nil {
+		// the next hub tries again
+		forgetPackMedia(packDir)
+
+		return media.err
+	}
+
+	for _, round := range game.Rounds {
+		listed := make(map[*MediaFile]bool)
+
+		for _, theme := range round.Themes {
+			for _, quest := range theme.Quests {
+				for _, object := range questionObjects(quest) {
+					dir, ok := mediaDirs[object.Type]
+					if !ok || !object.IsRef {
+						continue
+					}
+
+					file := media.files[dir+"/"+object.Src]
+					if file == nil || listed[file] {
+						continue
+					}
+
+					listed[file] = true
+					round.Manifest = append(round.Manifest, file)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// forgetPackMedia drops the media of the pack once its unpacked copy is removed.
+func forgetPackMedia(packDir string) {
+	packMediaMutex.Lock()
+	delete(packMedia, packDir)
+	packMediaMutex.Unlock()
+}
+
+// packMediaHash returns the content hash of the media file of the pack if the pack media has been read.
+func packMediaHash(packDir, key string) (string, bool) {
+	packMediaMutex.Lock()
+	media, ok := packMedia[packDir]
+	packMediaMutex.Unlock()
+
+	if !ok {
+		return "", false
+	}
+
+	select {
+	case <-media.done:
+	default:
+		// still being read by the hub
+		return "", false
+	}
+
+	file := media.files[key]
+	if media.err != nil || file == nil {
+		return "", false
+	}
+
+	return file.Hash, true
+}
+
+// readPackMedia hashes every media file the questions of the game refer to.
+func readPackMedia(game *Game, packDir string) (map[string]*MediaFile, error) {
+	files := make(map[string]*MediaFile)
+
+	for _, round := range game.Rounds {
+		for _, theme := range round.Themes {
+			for _, quest := range theme.Quests {
+				for _, object := range questionObjects(quest) {
+					dir, ok := mediaDirs[object.Type]
+					if !ok || !object.IsRef {
+						continue
+					}
+
+					key := dir + "/" + object.Src
+					if _, ok := files[key]; ok {
+						continue
+					}
+
+					file, err := readMediaFile(packDir+"/"+dir, object)
+					if err != nil {
+						return nil, err
+					}
+
+					files[key] = file
+				}
+			}
+		}
+	}
+
+	return files, nil
+}
+
+func questionObjects(quest *Question) []*Object {
+	objects := append(append([]*Object(nil), quest.Scene...), quest.Answer...)
+	for _, option := range quest.AnswerOptions {
+		objects = append(objects, option.Content...)
+	}
+
+	return objects
+}
+
+// readMediaFile returns nil when the object refers to a file the pack does not have.
+func readMediaFile(dir string, object *Object) (*MediaFile, error) {
+	if !isMediaName(object.Src) {
+		return nil, nil
+	}
+
+	f, err := openMedia(dir, object.Src)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	hash := sha256.New()
+
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MediaFile{
+		Type:     object.Type,
+		Src:      object.Src,
+		Size:     size,
+		MimeType: mediaType(object.Src),
+		Hash:     hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
+
+// sendRoundManifest announces the media of the current round.
+func (game *Game) sendRoundManifest() {
+	round := game.Rounds[game.currentRound-1]
+
+	manifest := RoundManifestServerEvent{
+		RoundID: round.Id,
+		Files:   round.Manifest,
+	}
+
+	if manifest.Files == nil {
+		manifest.Files = []*MediaFile{}
+	}
+
+	game.broadcastServerEvent(RoundManifestServer, manifest, game.exp())
+}
+
+// handlePreloadProgress passes the progress of a player on to the leader, who decides when to go on.
+// It is accepted at any step, large files may take longer than the round announcement.
+func handlePreloadProgress(game *Game, event *ClientEvent) (Step, error) {
+	var clientEvent PreloadProgressClientEvent
+
+	err := json.Unmarshal(event.Data, &clientEvent)
+	if err != nil {
+		return stay, err
+	}
+
+	if game.currentRound < 1 || game.currentRound > len(game.Rounds) ||
+		game.Rounds[game.currentRound-1].Id != clientEvent.RoundID {
+		return stay, errors.New("incorrect round")
+	}
+
+	total := len(game.Rounds[game.currentRound-1].Manifest)
+	if clientEvent.Loaded < 0 || clientEvent.Loaded > total {
+		return stay, errors.New("incorrect loaded count")
+	}
+
+	progress := PreloadProgressServerEvent{
+		QueueID: game.playersQueueIDByToken[event.Token],
+		RoundID: clientEvent.RoundID,
+		Loaded:  clientEvent.Loaded,
+		Total:   total,
+		Done:    clientEvent.Loaded == total,
+	}
+
+	for _, client := range game.hub.clientList() {
+		if client.role == Leader {
+			game.sendServerEvent(client, PreloadProgressServer, progress, 0)
+		}
+	}
+
+	return stay, nil
+}
@@ -0,0 +1,80 @@
+package endpoint
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newMediaGame() *Game {
+	image := &Object{Id: 1, Type: Image, Src: "cat.png", IsRef: true}
+	missing := &Object{Id: 2, Type: Image, Src: "dog.png", IsRef: true}
+
+	return &Game{
+		Rounds: []*Round{
+			{Id: 1, Themes: []*Theme{
+				{Id: 1, Quests: []*Question{
+					{Id: 1, Scene: []*Object{image}},
+					{Id: 2, Scene: []*Object{image, missing}},
+				}},
+			}},
+		},
+	}
+}
+
+func TestBuildRoundManifestsHashesPackOnce(t *testing.T) {
+	packDir := t.TempDir()
+
+	dir := filepath.Join(packDir, mediaDirs[Image])
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "cat.png"), []byte("meow"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		forgetPackMedia(packDir)
+	})
+
+	first := newMediaGame()
+	if err := buildRoundManifests(first, packDir); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest := first.Rounds[0].Manifest
+	if len(manifest) != 1 || manifest[0].Src != "cat.png" || manifest[0].Size != 4 {
+		t.Fatalf("manifest is %+v, want cat.png of 4 bytes once", manifest)
+	}
+
+	if hash, ok := packMediaHash(packDir, mediaDirs[Image]+"/cat.png"); !ok || hash != manifest[0].Hash {
+		t.Fatalf("media hash is %q, want %q", hash, manifest[0].Hash)
+	}
+
+	// another hub of the same pack does not read the files again
+	if err := os.WriteFile(filepath.Join(dir, "cat.png"), []byte("purr purr"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	second := newMediaGame()
+	if err := buildRoundManifests(second, packDir); err != nil {
+		t.Fatal(err)
+	}
+
+	if second.Rounds[0].Manifest[0] != manifest[0] {
+		t.Fatal("pack media is hashed again for another hub")
+	}
+
+	// an unpacked copy made again is hashed again
+	forgetPackMedia(packDir)
+
+	third := newMediaGame()
+	if err := buildRoundManifests(third, packDir); err != nil {
+		t.Fatal(err)
+	}
+
+	if file := third.Rounds[0].Manifest[0]; file.Size != 9 || file.Hash == manifest[0].Hash {
+		t.Fatalf("media of the new copy is %+v, want it hashed again", file)
+	}
+}
@@ -0,0 +1,149 @@
+package endpoint
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"mygame/internal/models"
+	"mygame/tools/rating"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultLeaderboardLimit = 50
+	maxLeaderboardLimit     = 100
+
+	// Leaderboard periods, the weekly one counts the rating gained in the last seven days.
+	weekly = "weekly"
+	global = "global"
+
+	// Number of the latest rating changes shown in the rating history.
+	ratingHistoryLimit = 100
+)
+
+// rateGame updates the ratings of the players of the finished game, anonymous players are not rated.
+func (e *Endpoint) rateGame(ctx context.Context, result *models.GameResult) error {
+	if result.EndReason != models.GameFinished {
+		return nil
+	}
+
+	participants := make([]*models.GameParticipant, 0, len(result.Participants))
+	for _, participant := range result.Participants {
+		if participant.UserID != 0 {
+			participants = append(participants, participant)
+		}
+	}
+
+	if len(participants) < 2 {
+		return nil
+	}
+
+	return e.repository.RatingRepository.RateGame(ctx, result.ID, participants, result.FinishedAt, rating.Update)
+}
+
+func (e *Endpoint) getLeaderboard(w http.ResponseWriter, r *http.Request) {
+	ctx := e.CreateContext(w, r)
+
+	if r.Method != http.MethodGet {
+		e.responseWriterError(errors.New("method not allowed"), w, http.StatusMethodNotAllowed, ctx, "")
+
+		return
+	}
+
+	query := r.URL.Query()
+
+	filter := &models.LeaderboardFilter{
+		Limit: defaultLeaderboardLimit,
+	}
+
+	switch query.Get("period") {
+	case "", global:
+	case weekly:
+		since := e.clock.Now().AddDate(0, 0, -7)
+		filter.Since = &since
+	default:
+		e.responseWriterError(errors.New("incorrect period"), w, http.StatusBadRequest, ctx, "")
+
+		return
+	}
+
+	var err error
+
+	if value := query.Get("pack"); value != "" {
+		filter.PackHash, err = hex.DecodeString(value)
+		if err != nil {
+			e.responseWriterError(errors.New("incorrect pack hash"), w, http.StatusBadRequest, ctx, "")
+
+			return
+		}
+	}
+
+	if value := query.Get("limit"); value != "" {
+		filter.Limit, err = strconv.Atoi(value)
+		if err != nil || filter.Limit < 1 || filter.Limit > maxLeaderboardLimit {
+			e.responseWriterError(errors.New("incorrect limit"), w, http.StatusBadRequest, ctx, "")
+
+			return
+		}
+	}
+
+	if value := query.Get("offset"); value != "" {
+		filter.Offset, err = strconv.Atoi(value)
+		if err != nil || filter.Offset < 0 {
+			e.responseWriterError(errors.New("incorrect offset"), w, http.StatusBadRequest, ctx, "")
+
+			return
+		}
+	}
+
+	leaderboard, err := e.repository.RatingRepository.GetLeaderboard(ctx, filter)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "get leaderboard error")
+
+		return
+	}
+
+	e.responseWriter(http.StatusOK, map[string]interface{}{
+		"leaderboard": leaderboard,
+	}, w, ctx)
+}
+
+func (e *Endpoint) getRatingHistory(w http.ResponseWriter, r *http.Request) {
+	ctx := e.CreateContext(w, r)
+
+	if r.Method != http.MethodGet {
+		e.responseWriterError(errors.New("method not allowed"), w, http.StatusMethodNotAllowed, ctx, "")
+
+		return
+	}
+
+	userID, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, RatingEndpoint.ToString()), 10, 64)
+	if err != nil || userID == 0 {
+		e.responseWriterError(errors.New("incorrect user id"), w, http.StatusBadRequest, ctx, "")
+
+		return
+	}
+
+	userRating, err := e.repository.RatingRepository.GetRating(ctx, userID)
+	if err != nil {
+		// nothing rated yet
+		userRating = &models.Rating{
+			UserID: userID,
+			Rating: rating.Initial,
+		}
+	}
+
+	history, err := e.repository.RatingRepository.GetRatingHistory(ctx, userID, ratingHistoryLimit, 0)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "get rating history error")
+
+		return
+	}
+
+	e.responseWriter(http.StatusOK, map[string]interface{}{
+		"rating":  userRating,
+		"history": history,
+	}, w, ctx)
+}
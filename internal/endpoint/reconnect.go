@@ -0,0 +1,201 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Time given to a disconnected player to connect again and take back their place.
+const reconnectGracePeriod = 60 * time.Second
+
+type LeaveServerEvent struct {
+	QueueID int
+}
+
+type StateSnapshotServerEvent struct {
+	// Queue ID of the receiver, zero for the leader and spectators.
+	QueueID int
+
+	Step Step
+
+	RoundID   int
+	RoundName string
+	RoundType ObjectType
+	Themes    []*Theme
+
+	CurrentPlayerID int
+	ThemeID         int
+	QuestionID      int
+	Price           int
+
+	Players []*PlayerSnapshot
+}
+
+type PlayerSnapshot struct {
+	QueueID   int
+	Nickname  string
+	ImageUID  string
+	Score     int
+	Connected bool
+}
+
+// reclaimPlayer gives the place of the disconnected user back to the new connection
+// and returns the queue ID of the player.
+func (game *Game) reclaimPlayer(client *Client) (int, bool) {
+	if client.id == 0 {
+		return 0, false
+	}
+
+	player, ok := game.disconnected[client.id]
+	if !ok {
+		return 0, false
+	}
+
+	queueID := game.playersQueueIDByToken[player.client.token]
+
+	delete(game.disconnected, client.id)
+	delete(game.playersQueueIDByToken, player.client.token)
+
+	player.client = client
+	player.reconnectDeadline = time.Time{}
+
+	game.players[client] = player
+	game.playersQueueIDByToken[client.token] = queueID
+	game.playersTokenByQueueID[queueID] = client.token
+
+	return queueID, true
+}
+
+// dropDisconnected lets go of the players who have not connected again in time.
+func (game *Game) dropDisconnected() {
+	now := game.clock.Now()
+
+	for id, player := range game.disconnected {
+		if now.Before(player.reconnectDeadline) {
+			continue
+		}
+
+		delete(game.disconnected, id)
+
+		leave := LeaveServerEvent{
+			QueueID: game.playersQueueIDByToken[player.client.token],
+		}
+
+		game.broadcastServerEvent(LeaveServer, leave, 0)
+	}
+}
+
+// wakeUp returns the earliest time the game has to move on by itself, zero if it never has to.
+func (game *Game) wakeUp() time.Time {
+	wakeUp := game.deadline
+
+	for _, player := range game.disconnected {
+		if wakeUp.IsZero() || player.reconnectDeadline.Before(wakeUp) {
+			wakeUp = player.reconnectDeadline
+		}
+	}
+
+	return wakeUp
+}
+
+// tick drops players whose grace period is over and expires the current step when its deadline has passed.
+func (game *Game) tick() {
+	game.dropDisconnected()
+
+	if game.isAbandoned() {
+		game.moveTo(Closed)
+
+		return
+	}
+
+	if !game.deadline.IsZero() && !game.clock.Now().Before(game.deadline) {
+		game.expire()
+	}
+}
+
+// sendStateSnapshot sends the client everything needed to draw the game from scratch.
+func (game *Game) sendStateSnapshot(client *Client) error {
+	snapshot := StateSnapshotServerEvent{
+		QueueID:         game.playersQueueIDByToken[client.token],
+		Step:            game.currentStep,
+		CurrentPlayerID: game.currentPlayerID,
+		ThemeID:         game.currentTheme,
+		QuestionID:      game.currentQuestion,
+		Price:           game.currentPrice,
+		Players:         game.playerSnapshots(),
+	}
+
+	if game.currentRound >= 1 && game.currentRound <= len(game.Rounds) {
+		round := game.Rounds[game.currentRound-1]
+
+		snapshot.RoundID = round.Id
+		snapshot.RoundName = round.Name
+		snapshot.RoundType = round.Type
+		snapshot.Themes = round.Themes
+	}
+
+	return game.sendServerEvent(client, StateSnapshotServer, snapshot, game.exp())
+}
+
+// returningUsers returns the IDs of the disconnected players still waited for.
+func (game *Game) returningUsers() map[uint64]bool {
+	returning := make(map[uint64]bool, len(game.disconnected))
+	for id := range game.disconnected {
+		returning[id] = true
+	}
+
+	return returning
+}
+
+func (game *Game) playerSnapshots() []*PlayerSnapshot {
+	byQueueID := make(map[int]*PlayerSnapshot)
+
+	for client, player := range game.players {
+		queueID := game.playersQueueIDByToken[client.token]
+
+		byQueueID[queueID] = &PlayerSnapshot{
+			QueueID:   queueID,
+			Nickname:  player.nickname,
+			ImageUID:  player.client.imageUID,
+			Score:     player.score,
+			Connected: true,
+		}
+	}
+
+	for _, player := range game.disconnected {
+		queueID := game.playersQueueIDByToken[player.client.token]
+
+		byQueueID[queueID] = &PlayerSnapshot{
+			QueueID:  queueID,
+			Nickname: player.nickname,
+			ImageUID: player.client.imageUID,
+			Score:    player.score,
+		}
+	}
+
+	snapshots := make([]*PlayerSnapshot, 0, len(byQueueID))
+	for queueID := 1; queueID <= len(game.playersTokenByQueueID); queueID++ {
+		if snapshot, ok := byQueueID[queueID]; ok {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+
+	return snapshots
+}
+
+func (game *Game) sendServerEvent(client *Client, eventType ServerEventType, event interface{}, exp int64) error {
+	serverEvent := ServerEvent{
+		Type: eventType,
+		Exp:  exp,
+		Data: event,
+	}
+
+	msg, err := json.Marshal(&serverEvent)
+	if err != nil {
+		return err
+	}
+
+	game.hub.send(client, msg)
+
+	return nil
+}
@@ -0,0 +1,396 @@
+package endpoint
+
+import (
+	"context"
+	"encoding/json"
+	"mygame/config"
+	"mygame/internal/models"
+	"mygame/tools/clock"
+	"mygame/tools/jwt"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	jwtgo "github.com/dgrijalva/jwt-go"
+)
+
+// Capacity of the send channels of simulated clients, enough for any game between two checks.
+const simulationBufferSize = 4096
+
+// simulationStart is the time the virtual clock of a simulation starts at.
+var simulationStart = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// flushMessage is broadcast after every call to learn that the hub has delivered everything before it.
+var flushMessage = []byte("\x00flush")
+
+// simulatedEvent is a server event received by a simulated client.
+type simulatedEvent struct {
+	Type ServerEventType
+	Exp  int64
+	Data json.RawMessage
+}
+
+// simulatedClient is a client of a simulation, it keeps whatever it has received.
+type simulatedClient struct {
+	*Client
+
+	events []simulatedEvent
+	// Number of events already checked by expect.
+	checked int
+	// Text messages, the errors sent by the game.
+	messages []string
+
+	// Set when the connection is dropped or replaced.
+	gone bool
+}
+
+// simulation drives a game through runGame and a running hub on a fake clock, without websockets.
+// Every call returns once the game and the hub are done with it, so the received events can be checked.
+type simulation struct {
+	t *testing.T
+
+	clock *clock.Fake
+	keys  *jwt.KeySet
+
+	game *Game
+	hub  *Hub
+
+	leader  *simulatedClient
+	players []*simulatedClient
+	clients []*simulatedClient
+
+	// History passed to onClose and the number of calls.
+	result *models.GameResult
+	closes int
+}
+
+// newSimulation starts the game with a leader and the given number of players,
+// players get queue IDs from 1 to players in the order they join.
+func newSimulation(t *testing.T, game *Game, players int) *simulation {
+	t.Helper()
+
+	fake := clock.NewFake(simulationStart)
+
+	keys, err := jwt.NewKeySet("", jwt.WithSecretKey("", nil, "simulation", time.Time{}), fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &simulation{
+		t:     t,
+		clock: fake,
+		keys:  keys,
+		game:  game,
+	}
+
+	s.hub = newHub(game, &config.Config{JWT: config.JWT{KeySet: keys}}, fake)
+
+	game.onClose = func(result *models.GameResult) {
+		s.result = result
+		s.closes++
+	}
+
+	registerHub(context.Background(), s.hub)
+
+	t.Cleanup(func() {
+		unregisterHub(s.hub)
+	})
+
+	s.leader = s.join("leader", Leader)
+
+	for i := 1; i <= players; i++ {
+		s.players = append(s.players, s.join("player"+strconv.Itoa(i), User))
+	}
+
+	return s
+}
+
+// token returns an access token valid for a day of the virtual clock.
+func (s *simulation) token(id uint64, login string, role string) string {
+	s.t.Helper()
+
+	token, err := jwt.CreateJWT(s.keys, &jwt.Claims{
+		ID:    id,
+		Login: login,
+		Role:  role,
+		StandardClaims: jwtgo.StandardClaims{
+			ExpiresAt: s.clock.Now().Add(24 * time.Hour).Unix(),
+		},
+	})
+	if err != nil {
+		s.t.Fatal(err)
+	}
+
+	return token
+}
+
+// join connects a new user the way the hub registers a client.
+func (s *simulation) join(login string, role Role) *simulatedClient {
+	s.t.Helper()
+
+	id := uint64(len(s.clients) + 1)
+
+	return s.connect(&Client{
+		hub:   s.hub,
+		id:    id,
+		login: login,
+		token: s.token(id, login, ""),
+		role:  role,
+		send:  make(chan []byte, simulationBufferSize),
+	})
+}
+
+// reconnect connects the user of the client again, the new connection takes the place of the client.
+func (s *simulation) reconnect(client *simulatedClient) *simulatedClient {
+	s.t.Helper()
+
+	reconnected := s.connect(&Client{
+		hub:   s.hub,
+		id:    client.id,
+		login: client.login,
+		token: client.token,
+		role:  client.role,
+		send:  make(chan []byte, simulationBufferSize),
+	})
+
+	client.gone = true
+
+	if client == s.leader {
+		s.leader = reconnected
+	}
+
+	for i, player := range s.players {
+		if player == client {
+			s.players[i] = reconnected
+		}
+	}
+
+	return reconnected
+}
+
+func (s *simulation) connect(client *Client) *simulatedClient {
+	s.t.Helper()
+
+	simulated := &simulatedClient{Client: client}
+	s.clients = append(s.clients, simulated)
+
+	// what the hub does on register, the join is sent here to wait for its answer
+	replaced := s.hub.replaceClient(client)
+	for _, registered := range replaced {
+		if err := s.dispatch(&ClientEvent{Type: Disconnect, Token: registered.token}); err != nil {
+			s.t.Fatal(err)
+		}
+	}
+
+	if err := s.send(simulated, Join, nil); err != nil {
+		s.t.Fatal(err)
+	}
+
+	return simulated
+}
+
+// disconnect drops the connection of the client the way the hub does when the websocket is closed.
+func (s *simulation) disconnect(client *simulatedClient) {
+	s.t.Helper()
+
+	client.gone = true
+
+	s.hub.mutex.Lock()
+	s.hub.dropClient(client.Client)
+	s.hub.mutex.Unlock()
+
+	if err := s.send(client, Disconnect, nil); err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+// send sends the client event on behalf of the client and returns the answer of the game.
+func (s *simulation) send(client *simulatedClient, eventType EventType, data interface{}) error {
+	s.t.Helper()
+
+	rawData, err := json.Marshal(data)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+
+	err = s.dispatch(&ClientEvent{
+		Type:  eventType,
+		Token: client.token,
+		Data:  rawData,
+	})
+
+	s.flush()
+
+	return err
+}
+
+// dispatch passes the event to runGame and waits until it is handled.
+func (s *simulation) dispatch(event *ClientEvent) error {
+	event.reply = make(chan error, 1)
+
+	select {
+	case s.game.eventChannel <- event:
+	case <-s.hub.close:
+		return errHubClosed
+	}
+
+	// runGame answers every event it receives
+	return <-event.reply
+}
+
+// expire moves the virtual clock to the next deadline of the game and lets it expire.
+func (s *simulation) expire() {
+	s.t.Helper()
+
+	wakeUp := s.game.wakeUp()
+	if wakeUp.IsZero() {
+		s.t.Fatalf("step %d never expires", s.game.currentStep)
+	}
+
+	s.clock.AdvanceTo(wakeUp)
+	s.settle()
+}
+
+// advance moves the virtual clock forward, one deadline of the game at a time.
+func (s *simulation) advance(d time.Duration) {
+	s.t.Helper()
+
+	until := s.clock.Now().Add(d)
+
+	for !s.closed() {
+		wakeUp := s.game.wakeUp()
+		if wakeUp.IsZero() || wakeUp.After(until) {
+			break
+		}
+
+		s.expire()
+	}
+
+	s.clock.AdvanceTo(until)
+	s.settle()
+}
+
+// settle waits until runGame has received the fired timer and is done with it.
+func (s *simulation) settle() {
+	for s.clock.Fired() && !s.closed() {
+		runtime.Gosched()
+	}
+
+	// the game handles one thing at a time, an event is answered once the tick is over
+	s.dispatch(&ClientEvent{Type: "sync"})
+
+	s.flush()
+}
+
+// flush records everything the hub has delivered so far.
+func (s *simulation) flush() {
+	select {
+	case s.hub.broadcast <- flushMessage:
+	case <-s.hub.close:
+	}
+
+	for _, client := range s.clients {
+		for message := range client.send {
+			if string(message) == string(flushMessage) {
+				break
+			}
+
+			var event simulatedEvent
+
+			if err := json.Unmarshal(message, &event); err != nil {
+				client.messages = append(client.messages, string(message))
+
+				continue
+			}
+
+			client.events = append(client.events, event)
+		}
+	}
+}
+
+func (s *simulation) closed() bool {
+	select {
+	case <-s.hub.close:
+		return true
+	default:
+		return false
+	}
+}
+
+// expect checks that the client has received exactly the given server events since the previous check
+// and returns them in the order they are given. Events sent to a single client skip the hub loop,
+// so only the set of events is checked, not how they interleave with broadcasts.
+func (s *simulation) expect(client *simulatedClient, types ...ServerEventType) []simulatedEvent {
+	s.t.Helper()
+
+	events := client.events[client.checked:]
+	client.checked = len(client.events)
+
+	if len(events) != len(types) {
+		s.t.Fatalf("%s: expected events %v, got %v", client.login, types, eventTypes(events))
+	}
+
+	matched := make([]simulatedEvent, 0, len(types))
+	used := make([]bool, len(events))
+
+	for _, eventType := range types {
+		found := false
+
+		for i, event := range events {
+			if !used[i] && event.Type == eventType {
+				used[i] = true
+				found = true
+
+				matched = append(matched, event)
+
+				break
+			}
+		}
+
+		if !found {
+			s.t.Fatalf("%s: expected events %v, got %v", client.login, types, eventTypes(events))
+		}
+	}
+
+	return matched
+}
+
+// expectAll checks the events of the leader and every connected player.
+func (s *simulation) expectAll(types ...ServerEventType) {
+	s.t.Helper()
+
+	s.expect(s.leader, types...)
+
+	for _, player := range s.players {
+		if !player.gone {
+			s.expect(player, types...)
+		}
+	}
+}
+
+// score returns the score of the player with the queue ID.
+func (s *simulation) score(queueID int) int {
+	if player, ok := s.game.participants[queueID]; ok {
+		return player.score
+	}
+
+	return 0
+}
+
+func decodeEvent(t *testing.T, event simulatedEvent, data interface{}) {
+	t.Helper()
+
+	if err := json.Unmarshal(event.Data, data); err != nil {
+		t.Fatalf("%s: %v", event.Type, err)
+	}
+}
+
+func eventTypes(events []simulatedEvent) []ServerEventType {
+	types := make([]ServerEventType, 0, len(events))
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+
+	return types
+}
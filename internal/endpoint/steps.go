@@ -0,0 +1,587 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"mygame/internal/models"
+	"time"
+)
+
+// stay is returned by handlers to keep the game at the current step without restarting it.
+const stay Step = -1
+
+var (
+	errPermissionDenied = errors.New("permission denied")
+	errUnexpectedEvent  = errors.New("unexpected event")
+	errNotYourTurn      = errors.New("not your turn")
+	errTokenExpired     = errors.New("token expired")
+)
+
+// stepHandler describes a game step: how long the game stays at it, what happens
+// when the game enters and leaves it, and which client events move the game forward.
+type stepHandler struct {
+	// timeout returns the step duration, zero means the step never expires.
+	timeout func(game *Game) time.Duration
+
+	enter func(game *Game)
+	exit  func(game *Game)
+
+	// expire returns the next step when the step timeout has passed.
+	expire func(game *Game) Step
+
+	events map[EventType]eventHandler
+}
+
+// eventHandler describes a transition caused by a client event.
+type eventHandler struct {
+	// guard rejects the event before it is handled, the game state is left unchanged.
+	guard func(game *Game, event *ClientEvent) error
+
+	// handle applies the event and returns the next step.
+	handle func(game *Game, event *ClientEvent) (Step, error)
+}
+
+// steps is the transition table of the game.
+var steps map[Step]*stepHandler
+
+// commonEvents are handled at any step.
+var commonEvents map[EventType]eventHandler
+
+func init() {
+	commonEvents = map[EventType]eventHandler{
+		Join:         {handle: handleJoin},
+		Disconnect:   {handle: handleDisconnect},
+		CreateInvite: {handle: handleCreateInvite},
+		Kick:         {guard: guardRole(models.RoleModerator, models.RoleAdmin), handle: handleKick},
+		CloseHub:     {guard: guardRole(models.RoleAdmin), handle: handleCloseHub},
+
+		PreloadProgress: {guard: guardPlayer, handle: handlePreloadProgress},
+	}
+
+	steps = map[Step]*stepHandler{
+		WaitingStart: {
+			timeout: after(20 * time.Minute),
+			expire:  next(Closed),
+			events: map[EventType]eventHandler{
+				StartGame: {guard: guardHasPlayers, handle: handleStartGame},
+			},
+		},
+		Grettings: {
+			timeout: after(10 * time.Second),
+			enter:   enterGreetings,
+			expire:  (*Game).nextRound,
+		},
+		ReadingRound: {
+			timeout: after(4 * time.Second),
+			enter:   enterReadingRound,
+			expire:  next(ReadingThemes),
+		},
+		ReadingThemes: {
+			timeout: func(game *Game) time.Duration {
+				return time.Duration(len(game.Rounds[game.currentRound-1].Themes)) * 3 * time.Second
+			},
+			enter:  enterReadingThemes,
+			expire: expireReadingThemes,
+		},
+		ChooseQuestion: {
+			timeout: after(30 * time.Second),
+			enter:   enterChooseQuestion,
+			expire:  expireChooseQuestion,
+			events: map[EventType]eventHandler{
+				ChooseQuest: {guard: guardChooser, handle: handleChooseQuest},
+			},
+		},
+		Getting: {
+			timeout: after(10 * time.Second),
+			enter:   enterGetting,
+			expire:  expireGetting,
+			events: map[EventType]eventHandler{
+				GetQuest: {guard: guardPlayer, handle: handleGetQuest},
+			},
+		},
+		Answering: {
+			timeout: after(20 * time.Second),
+			enter:   enterAnswering,
+			expire:  judgeAnswer(false),
+			events: map[EventType]eventHandler{
+				AcceptAnswer:  {handle: handleJudgeAnswer(true)},
+				DeclineAnswer: {handle: handleJudgeAnswer(false)},
+			},
+		},
+		Bidding: {
+			timeout: after(stakeDuration),
+			enter:   enterBidding,
+			exit:    exitBidding,
+			expire:  expireBidding,
+			events: map[EventType]eventHandler{
+				MakeStake: {guard: guardBidder, handle: handleMakeStake},
+				PassStake: {guard: guardBidder, handle: handlePassStake},
+			},
+		},
+		Transferring: {
+			timeout: after(transferDuration),
+			enter:   enterTransferring,
+			exit:    exitTransferring,
+			expire:  expireTransferring,
+			events: map[EventType]eventHandler{
+				TransferQuest: {guard: guardChooser, handle: handleTransferQuest},
+			},
+		},
+		FinalThemes: {
+			timeout: after(finalThemeDuration),
+			enter:   enterFinalThemes,
+			expire:  expireFinalThemes,
+			events: map[EventType]eventHandler{
+				RemoveTheme: {guard: guardThemeRemover, handle: handleRemoveTheme},
+			},
+		},
+		FinalBetting: {
+			timeout: after(finalBetDuration),
+			enter:   enterFinalBetting,
+			expire:  expireFinalBetting,
+			events: map[EventType]eventHandler{
+				MakeBet: {guard: guardFinalist, handle: handleMakeBet},
+			},
+		},
+		FinalAnswering: {
+			timeout: after(finalAnswerDuration),
+			enter:   enterFinalAnswering,
+			expire:  next(FinalJudging),
+			events: map[EventType]eventHandler{
+				GiveAnswer: {guard: guardFinalist, handle: handleGiveFinalAnswer},
+			},
+		},
+		FinalJudging: {
+			timeout: after(finalJudgeDuration),
+			enter:   enterFinalJudging,
+			exit:    exitFinalJudging,
+			expire:  judgeFinalAnswer(false),
+			events: map[EventType]eventHandler{
+				AcceptAnswer:  {handle: handleJudgeFinalAnswer(true)},
+				DeclineAnswer: {handle: handleJudgeFinalAnswer(false)},
+			},
+		},
+		Final: {
+			timeout: after(5 * time.Minute),
+			enter:   enterFinal,
+			expire:  next(Closed),
+		},
+		Closed: {
+			enter: enterClosed,
+		},
+	}
+}
+
+func after(duration time.Duration) func(game *Game) time.Duration {
+	return func(game *Game) time.Duration {
+		return duration
+	}
+}
+
+func next(step Step) func(game *Game) Step {
+	return func(game *Game) Step {
+		return step
+	}
+}
+
+// dispatch checks the event against the transition table of the current step and applies it.
+func (game *Game) dispatch(event *ClientEvent) error {
+	if !game.isAllowed(event) {
+		return errPermissionDenied
+	}
+
+	handler, ok := steps[game.currentStep].events[event.Type]
+	if !ok {
+		handler, ok = commonEvents[event.Type]
+	}
+
+	if !ok {
+		return errUnexpectedEvent
+	}
+
+	if handler.guard != nil {
+		if err := handler.guard(game, event); err != nil {
+			return err
+		}
+	}
+
+	step, err := handler.handle(game, event)
+	if err != nil {
+		return err
+	}
+
+	game.moveTo(step)
+
+	return nil
+}
+
+// expire moves the game on when the current step has timed out.
+func (game *Game) expire() {
+	handler := steps[game.currentStep]
+	if handler.expire == nil {
+		return
+	}
+
+	step := handler.expire(game)
+	if step == stay {
+		// restart the step, otherwise it would expire again at once
+		step = game.currentStep
+	}
+
+	game.moveTo(step)
+}
+
+// moveTo leaves the current step and enters the given one. Moving to the current step
+// restarts it without calling its exit hook.
+func (game *Game) moveTo(step Step) {
+	if step == stay {
+		return
+	}
+
+	if step != game.currentStep {
+		if exit := steps[game.currentStep].exit; exit != nil {
+			exit(game)
+		}
+	}
+
+	game.enterStep(step)
+}
+
+func (game *Game) enterStep(step Step) {
+	handler := steps[step]
+
+	game.currentStep = step
+	game.deadline = time.Time{}
+
+	if handler.timeout != nil {
+		if timeout := handler.timeout(game); timeout > 0 {
+			game.deadline = game.clock.Now().Add(timeout)
+		}
+	}
+
+	if handler.enter != nil {
+		handler.enter(game)
+	}
+}
+
+func (game *Game) isAllowed(event *ClientEvent) bool {
+	accessedRoles := roleByEvent[event.Type]
+	if len(accessedRoles) == 0 {
+		return true
+	}
+
+	client, ok := game.hub.client(event.Token)
+	if !ok {
+		return false
+	}
+
+	for _, role := range accessedRoles {
+		if role == client.role {
+			return true
+		}
+	}
+
+	return false
+}
+
+func handleJoin(game *Game, event *ClientEvent) (Step, error) {
+	client, ok := game.hub.client(event.Token)
+	if !ok {
+		return stay, errors.New("client not found")
+	}
+
+	joinServer := JoinServerEvent{
+		QueueID:  0,
+		Nickname: event.claims.Login,
+		ImageUID: client.imageUID,
+	}
+
+	if client.role == Leader {
+		game.broadcastServerEvent(JoinServer, joinServer, 0)
+
+		return stay, game.sendStateSnapshot(client)
+	}
+
+	// spectators are not announced to the hub
+	if client.role == Spectator {
+		game.spectators[event.Token] = true
+
+		return stay, game.sendStateSnapshot(client)
+	}
+
+	queueID, ok := game.reclaimPlayer(client)
+	if !ok {
+		player := &Player{
+			client:   client,
+			nickname: event.claims.Login,
+			score:    0,
+		}
+
+		queueID = len(game.playersTokenByQueueID) + 1
+
+		game.players[client] = player
+		game.participants[queueID] = player
+		game.playersQueueIDByToken[event.Token] = queueID
+		game.playersTokenByQueueID[queueID] = event.Token
+	}
+
+	joinServer.QueueID = queueID
+
+	game.broadcastServerEvent(JoinServer, joinServer, 0)
+
+	return stay, game.sendStateSnapshot(client)
+}
+
+// handleDisconnect keeps the place of a user for the grace period,
+// anonymous players cannot be recognized when they come back and leave at once.
+func handleDisconnect(game *Game, event *ClientEvent) (Step, error) {
+	if game.kicked[event.Token] {
+		if game.isAbandoned() {
+			return Closed, nil
+		}
+
+		return stay, nil
+	}
+
+	if game.spectators[event.Token] {
+		delete(game.spectators, event.Token)
+
+		if game.isAbandoned() {
+			return Closed, nil
+		}
+
+		return stay, nil
+	}
+
+	queueID := game.playersQueueIDByToken[event.Token]
+
+	var exp int64
+	var left bool
+	for client, player := range game.players {
+		if client.token != event.Token {
+			continue
+		}
+
+		delete(game.players, client)
+
+		if client.id == 0 {
+			left = true
+
+			continue
+		}
+
+		player.reconnectDeadline = game.clock.Now().Add(reconnectGracePeriod)
+		game.disconnected[client.id] = player
+
+		exp = player.reconnectDeadline.In(time.UTC).Unix()
+	}
+
+	disconnectServer := DisconnectServerEvent{
+		QueueID: queueID,
+	}
+
+	game.broadcastServerEvent(DisconnectServer, disconnectServer, exp)
+
+	if left {
+		game.broadcastServerEvent(LeaveServer, LeaveServerEvent{QueueID: queueID}, 0)
+	}
+
+	if game.isAbandoned() {
+		return Closed, nil
+	}
+
+	return stay, nil
+}
+
+func guardHasPlayers(game *Game, event *ClientEvent) error {
+	if len(game.players) == 0 {
+		return errors.New("cannot start game: no players")
+	}
+
+	return nil
+}
+
+func guardPlayer(game *Game, event *ClientEvent) error {
+	if _, ok := game.playerByQueueID(game.playersQueueIDByToken[event.Token]); !ok {
+		return errPermissionDenied
+	}
+
+	return nil
+}
+
+// guardChooser allows the event only from the player whose turn is to choose.
+func guardChooser(game *Game, event *ClientEvent) error {
+	if game.playersQueueIDByToken[event.Token] != game.currentPlayerID {
+		return errNotYourTurn
+	}
+
+	return nil
+}
+
+func handleStartGame(game *Game, event *ClientEvent) (Step, error) {
+	game.startedAt = game.clock.Now()
+
+	return Grettings, nil
+}
+
+func enterGreetings(game *Game) {
+	greetingsServer := GreetingsServerEvent{
+		Name:   game.Name,
+		Author: game.Author,
+		Date:   game.Date,
+	}
+
+	game.broadcastServerEvent(GreetingsServer, greetingsServer, game.exp())
+}
+
+func enterReadingRound(game *Game) {
+	readingRound := ReadingRoundServerEvent{
+		Name: game.Rounds[game.currentRound-1].Name,
+	}
+
+	game.broadcastServerEvent(ReadingRoundServer, readingRound, game.exp())
+	game.sendRoundManifest()
+}
+
+func enterReadingThemes(game *Game) {
+	round := game.Rounds[game.currentRound-1]
+
+	themeNames := make([]string, 0, len(round.Themes))
+	for _, theme := range round.Themes {
+		themeNames = append(themeNames, theme.Name)
+	}
+
+	readingThemes := ReadingThemesServerEvent{
+		ThemeNames: themeNames,
+	}
+
+	game.broadcastServerEvent(ReadingThemesServer, readingThemes, game.exp())
+}
+
+func expireReadingThemes(game *Game) Step {
+	if game.Rounds[game.currentRound-1].Type == FinalRound {
+		return game.startFinal()
+	}
+
+	return ChooseQuestion
+}
+
+func enterChooseQuestion(game *Game) {
+	wall := WallServerEvent{
+		Themes: game.Rounds[game.currentRound-1].Themes,
+	}
+
+	game.broadcastServerEvent(WallServer, wall, game.exp())
+}
+
+func handleChooseQuest(game *Game, event *ClientEvent) (Step, error) {
+	var clientEvent ChooseQuestClientEvent
+
+	err := json.Unmarshal(event.Data, &clientEvent)
+	if err != nil {
+		return stay, err
+	}
+
+	quest, ok := game.question(clientEvent.ThemeID, clientEvent.QuestionID)
+	if !ok || quest.Price < 0 {
+		return stay, errors.New("incorrect question")
+	}
+
+	return game.selectQuestion(clientEvent.ThemeID, clientEvent.QuestionID), nil
+}
+
+// expireChooseQuestion picks the last available question when the chooser has not decided in time.
+func expireChooseQuestion(game *Game) Step {
+	var themeID, questionID int
+	for _, theme := range game.Rounds[game.currentRound-1].Themes {
+		for _, question := range theme.Quests {
+			if question.Price >= 0 {
+				themeID = theme.Id
+				questionID = question.Id
+			}
+		}
+	}
+
+	if themeID == 0 {
+		return game.nextRound()
+	}
+
+	return game.selectQuestion(themeID, questionID)
+}
+
+func enterGetting(game *Game) {
+	getQuest := GetQuestServerEvent{
+		QueueID: game.currentPlayerID,
+	}
+
+	game.broadcastServerEvent(GetQuestServer, getQuest, game.exp())
+}
+
+// expireGetting moves on when nobody has taken the question.
+func expireGetting(game *Game) Step {
+	game.recordOutcome(0, game.currentPrice, false)
+
+	return game.nextQuestion()
+}
+
+func handleGetQuest(game *Game, event *ClientEvent) (Step, error) {
+	game.currentPlayerID = game.playersQueueIDByToken[event.Token]
+
+	return Answering, nil
+}
+
+func enterAnswering(game *Game) {
+	takenQuest := TakenQuestServerEvent{
+		QueueID: game.currentPlayerID,
+	}
+
+	game.broadcastServerEvent(TakenQuestServer, takenQuest, game.exp())
+}
+
+func judgeAnswer(correct bool) func(game *Game) Step {
+	return func(game *Game) Step {
+		game.scoreAnswer(correct)
+
+		return game.nextQuestion()
+	}
+}
+
+func handleJudgeAnswer(correct bool) func(game *Game, event *ClientEvent) (Step, error) {
+	judge := judgeAnswer(correct)
+
+	return func(game *Game, event *ClientEvent) (Step, error) {
+		return judge(game), nil
+	}
+}
+
+func enterFinal(game *Game) {
+	var winnerID int
+	var maxScore int
+	for _, player := range game.players {
+		if player.score > maxScore {
+			maxScore = player.score
+			winnerID = game.playersQueueIDByToken[player.client.token]
+		}
+	}
+
+	game.finished = true
+
+	game.broadcastServerEvent(FinalServer, FinalServerEvent{WinnerID: winnerID}, game.exp())
+}
+
+// enterClosed releases the hub once, a game already closed may still be told to close by a common event.
+func enterClosed(game *Game) {
+	select {
+	case <-game.hub.close:
+		return
+	default:
+	}
+
+	unregisterHub(game.hub)
+
+	if game.onClose != nil {
+		game.onClose(game.result())
+	}
+
+	close(game.hub.close)
+}
@@ -0,0 +1,831 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"mygame/config"
+	"mygame/internal/models"
+	"mygame/tools/clock"
+	"mygame/tools/jwt"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// stepsFixture is a game with a leader and players that is driven step by step, without runGame.
+// Broadcasts are buffered so that handlers can be called from the test goroutine.
+type stepsFixture struct {
+	clock *clock.Fake
+	game  *Game
+
+	// The leader first, then players with queue IDs from 1.
+	clients []*Client
+
+	// Number of onClose calls.
+	closes int
+}
+
+func newStepsFixture(t *testing.T, players int) *stepsFixture {
+	t.Helper()
+
+	f := &stepsFixture{
+		clock: clock.NewFake(simulationStart),
+		game:  newTestGame(),
+	}
+
+	hub := newHub(f.game, &config.Config{}, f.clock)
+	hub.broadcast = make(chan []byte, simulationBufferSize)
+
+	f.game.onClose = func(result *models.GameResult) {
+		f.closes++
+	}
+
+	f.game.enterStep(WaitingStart)
+
+	f.join(t, "leader", Leader)
+
+	for i := 1; i <= players; i++ {
+		f.join(t, "player"+strconv.Itoa(i), User)
+	}
+
+	f.broadcasts()
+
+	return f
+}
+
+func (f *stepsFixture) join(t *testing.T, login string, role Role) {
+	t.Helper()
+
+	client := &Client{
+		hub:   f.game.hub,
+		id:    uint64(len(f.clients) + 1),
+		login: login,
+		token: login,
+		role:  role,
+		send:  make(chan []byte, simulationBufferSize),
+	}
+
+	f.clients = append(f.clients, client)
+	f.game.hub.replaceClient(client)
+
+	if err := f.game.dispatch(f.event(len(f.clients)-1, Join, "", nil)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// event returns the client event sent by the client with the given index, with claims of the given role.
+func (f *stepsFixture) event(from int, eventType EventType, role string, data interface{}) *ClientEvent {
+	rawData, _ := json.Marshal(data)
+
+	client := f.clients[from]
+
+	return &ClientEvent{
+		Type:   eventType,
+		Token:  client.token,
+		Data:   rawData,
+		claims: &jwt.Claims{ID: client.id, Login: client.login, Role: role},
+	}
+}
+
+// broadcasts returns the types of the events broadcast since the previous call.
+func (f *stepsFixture) broadcasts() []ServerEventType {
+	var types []ServerEventType
+
+	for {
+		select {
+		case message := <-f.game.hub.broadcast:
+			var event simulatedEvent
+			if err := json.Unmarshal(message, &event); err == nil {
+				types = append(types, event.Type)
+			}
+		default:
+			return types
+		}
+	}
+}
+
+func (f *stepsFixture) score(queueID int) int {
+	if player, ok := f.game.participants[queueID]; ok {
+		return player.score
+	}
+
+	return 0
+}
+
+// startQuestion puts the game at the given question of the first round, asked by the player.
+func startQuestion(game *Game, questionID int, playerID int) {
+	game.currentRound = 1
+	game.currentTheme = 1
+	game.currentQuestion = questionID
+	game.currentPrice = game.Rounds[0].Themes[0].Quests[questionID-1].Price
+	game.currentPlayerID = playerID
+}
+
+// startFinalRound puts the game at the final round played by the given players, the first of them has 100.
+func startFinalRound(game *Game, participants ...int) {
+	game.currentRound = 2
+	game.currentTheme = 2
+	game.currentQuestion = 1
+
+	game.final = &finalRound{
+		participants: participants,
+		removed:      make(map[int]bool),
+		bets:         make(map[int]int),
+		answers:      make(map[int]string),
+	}
+
+	game.participants[participants[0]].score = 100
+}
+
+func sameEvents(got, want []ServerEventType) bool {
+	if len(got) != len(want) {
+		return false
+	}
+
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestStepEvents(t *testing.T) {
+	tests := []struct {
+		name  string
+		step  Step
+		setup func(game *Game)
+
+		// Index of the sender, zero is the leader.
+		from  int
+		role  string
+		event EventType
+		data  interface{}
+
+		err    string
+		want   Step
+		events []ServerEventType
+		check  func(t *testing.T, f *stepsFixture)
+	}{
+		{
+			name:   "start by the leader",
+			step:   WaitingStart,
+			event:  StartGame,
+			want:   Grettings,
+			events: []ServerEventType{GreetingsServer},
+			check: func(t *testing.T, f *stepsFixture) {
+				if !f.game.startedAt.Equal(f.clock.Now()) {
+					t.Errorf("game started at %v, want %v", f.game.startedAt, f.clock.Now())
+				}
+			},
+		},
+		{
+			name:  "start by a player",
+			step:  WaitingStart,
+			from:  1,
+			event: StartGame,
+			err:   errPermissionDenied.Error(),
+		},
+		{
+			name: "start without players",
+			step: WaitingStart,
+			setup: func(game *Game) {
+				for client := range game.players {
+					delete(game.players, client)
+				}
+			},
+			event: StartGame,
+			err:   "cannot start game: no players",
+		},
+		{
+			name:  "event of another step",
+			step:  WaitingStart,
+			from:  1,
+			event: ChooseQuest,
+			data:  ChooseQuestClientEvent{ThemeID: 1, QuestionID: 1},
+			err:   errUnexpectedEvent.Error(),
+		},
+		{
+			name:   "question chosen by the chooser",
+			step:   ChooseQuestion,
+			setup:  func(game *Game) { startQuestion(game, 1, 1) },
+			from:   1,
+			event:  ChooseQuest,
+			data:   ChooseQuestClientEvent{ThemeID: 1, QuestionID: 2},
+			want:   Getting,
+			events: []ServerEventType{ChooseQuestServer, GetQuestServer},
+			check: func(t *testing.T, f *stepsFixture) {
+				if f.game.currentQuestion != 2 || f.game.currentPrice != 200 {
+					t.Errorf("question %d for %d is asked, want 2 for 200", f.game.currentQuestion, f.game.currentPrice)
+				}
+			},
+		},
+		{
+			name:  "question chosen out of turn",
+			step:  ChooseQuestion,
+			setup: func(game *Game) { startQuestion(game, 1, 1) },
+			from:  2,
+			event: ChooseQuest,
+			data:  ChooseQuestClientEvent{ThemeID: 1, QuestionID: 2},
+			err:   errNotYourTurn.Error(),
+		},
+		{
+			name: "played question chosen",
+			step: ChooseQuestion,
+			setup: func(game *Game) {
+				startQuestion(game, 1, 1)
+				game.Rounds[0].Themes[0].Quests[0].Price = -1
+			},
+			from:  1,
+			event: ChooseQuest,
+			data:  ChooseQuestClientEvent{ThemeID: 1, QuestionID: 1},
+			err:   "incorrect question",
+		},
+		{
+			name:  "question chosen by the leader",
+			step:  ChooseQuestion,
+			setup: func(game *Game) { startQuestion(game, 1, 1) },
+			event: ChooseQuest,
+			data:  ChooseQuestClientEvent{ThemeID: 1, QuestionID: 1},
+			err:   errPermissionDenied.Error(),
+		},
+		{
+			name:   "question taken",
+			step:   Getting,
+			setup:  func(game *Game) { startQuestion(game, 1, 1) },
+			from:   2,
+			event:  GetQuest,
+			want:   Answering,
+			events: []ServerEventType{TakenQuestServer},
+			check: func(t *testing.T, f *stepsFixture) {
+				if f.game.currentPlayerID != 2 {
+					t.Errorf("player %d answers, want 2", f.game.currentPlayerID)
+				}
+			},
+		},
+		{
+			name:  "question taken by the leader",
+			step:  Getting,
+			setup: func(game *Game) { startQuestion(game, 1, 1) },
+			event: GetQuest,
+			err:   errPermissionDenied.Error(),
+		},
+		{
+			name:   "answer accepted",
+			step:   Answering,
+			setup:  func(game *Game) { startQuestion(game, 1, 2) },
+			event:  AcceptAnswer,
+			want:   ChooseQuestion,
+			events: []ServerEventType{AnswerAcceptedServer, ScoreChangedServer, WallServer},
+			check: func(t *testing.T, f *stepsFixture) {
+				if f.score(2) != 100 || f.game.Rounds[0].Themes[0].Quests[0].Price != -1 {
+					t.Errorf("score is %d, want 100 and the question played", f.score(2))
+				}
+
+				if f.game.currentPlayerID != 1 {
+					t.Errorf("player %d chooses next, want 1", f.game.currentPlayerID)
+				}
+			},
+		},
+		{
+			name: "last answer declined",
+			step: Answering,
+			setup: func(game *Game) {
+				startQuestion(game, 2, 1)
+				game.Rounds[0].Themes[0].Quests[0].Price = -1
+			},
+			event:  DeclineAnswer,
+			want:   ReadingRound,
+			events: []ServerEventType{AnswerDeclinedServer, ScoreChangedServer, ReadingRoundServer, RoundManifestServer},
+			check: func(t *testing.T, f *stepsFixture) {
+				if f.score(1) != -200 || f.game.currentRound != 2 {
+					t.Errorf("score is %d in round %d, want -200 in round 2", f.score(1), f.game.currentRound)
+				}
+			},
+		},
+		{
+			name:  "answer judged by a player",
+			step:  Answering,
+			setup: func(game *Game) { startQuestion(game, 1, 2) },
+			from:  1,
+			event: AcceptAnswer,
+			err:   errPermissionDenied.Error(),
+		},
+		{
+			name: "nominal stake",
+			step: Bidding,
+			setup: func(game *Game) {
+				startQuestion(game, 1, 1)
+				game.participants[2].score = 500
+				game.startAuction(game.Rounds[0].Themes[0].Quests[0])
+			},
+			from:   1,
+			event:  MakeStake,
+			data:   StakeClientEvent{Stake: 100},
+			want:   Bidding,
+			events: []ServerEventType{StakeServer, AuctionServer},
+			check: func(t *testing.T, f *stepsFixture) {
+				// restarting the step keeps the auction
+				if a := f.game.auction; a == nil || a.bidderID != 2 || a.stake != 100 {
+					t.Errorf("auction is %+v, want the second player to bid over 100", a)
+				}
+			},
+		},
+		{
+			name: "stake out of turn",
+			step: Bidding,
+			setup: func(game *Game) {
+				startQuestion(game, 1, 1)
+				game.startAuction(game.Rounds[0].Themes[0].Quests[0])
+			},
+			from:  2,
+			event: MakeStake,
+			data:  StakeClientEvent{Stake: 100},
+			err:   errNotYourTurn.Error(),
+		},
+		{
+			name: "first stake passed",
+			step: Bidding,
+			setup: func(game *Game) {
+				startQuestion(game, 1, 1)
+				game.startAuction(game.Rounds[0].Themes[0].Quests[0])
+			},
+			from:  1,
+			event: PassStake,
+			err:   "first stake cannot be passed",
+		},
+		{
+			name: "stake passed by the last bidder",
+			step: Bidding,
+			setup: func(game *Game) {
+				startQuestion(game, 1, 1)
+				game.auction = &auction{minStake: 100, stake: 100, winnerID: 1, bidderID: 2, passed: make(map[int]bool)}
+			},
+			from:   2,
+			event:  PassStake,
+			want:   Answering,
+			events: []ServerEventType{StakeServer, AuctionResultServer, TakenQuestServer},
+			check: func(t *testing.T, f *stepsFixture) {
+				if f.game.auction != nil {
+					t.Error("auction is kept after bidding")
+				}
+
+				if f.game.currentPlayerID != 1 || f.game.currentPrice != 100 {
+					t.Errorf("player %d answers for %d, want 1 for 100", f.game.currentPlayerID, f.game.currentPrice)
+				}
+			},
+		},
+		{
+			name: "question transferred",
+			step: Transferring,
+			setup: func(game *Game) {
+				startQuestion(game, 1, 1)
+				game.catInBag = &catInBag{theme: "Animals", cost: 300}
+			},
+			from:   1,
+			event:  TransferQuest,
+			data:   TransferQuestClientEvent{QueueID: 2},
+			want:   Answering,
+			events: []ServerEventType{TransferredQuestServer, TakenQuestServer},
+			check: func(t *testing.T, f *stepsFixture) {
+				if f.game.catInBag != nil {
+					t.Error("cat in a bag is kept after the transfer")
+				}
+
+				if f.game.currentPlayerID != 2 || f.game.currentPrice != 300 {
+					t.Errorf("player %d answers for %d, want 2 for 300", f.game.currentPlayerID, f.game.currentPrice)
+				}
+			},
+		},
+		{
+			name: "question transferred to the chooser",
+			step: Transferring,
+			setup: func(game *Game) {
+				startQuestion(game, 1, 1)
+				game.catInBag = &catInBag{theme: "Animals", cost: 300}
+			},
+			from:  1,
+			event: TransferQuest,
+			data:  TransferQuestClientEvent{QueueID: 1},
+			err:   "question must be transferred to another player",
+		},
+		{
+			name: "question transferred to nobody",
+			step: Transferring,
+			setup: func(game *Game) {
+				startQuestion(game, 1, 1)
+				game.catInBag = &catInBag{theme: "Animals", cost: 300}
+			},
+			from:  1,
+			event: TransferQuest,
+			data:  TransferQuestClientEvent{QueueID: 5},
+			err:   "incorrect player",
+		},
+		{
+			name:   "final theme removed",
+			step:   FinalThemes,
+			setup:  func(game *Game) { startFinalRound(game, 1) },
+			from:   1,
+			event:  RemoveTheme,
+			data:   RemoveThemeClientEvent{ThemeID: 1},
+			want:   FinalBetting,
+			events: []ServerEventType{ThemeRemovedServer, FinalBettingServer},
+			check: func(t *testing.T, f *stepsFixture) {
+				if f.game.currentTheme != 2 {
+					t.Errorf("theme %d is played, want 2", f.game.currentTheme)
+				}
+			},
+		},
+		{
+			name:  "final theme removed out of turn",
+			step:  FinalThemes,
+			setup: func(game *Game) { startFinalRound(game, 1) },
+			from:  2,
+			event: RemoveTheme,
+			data:  RemoveThemeClientEvent{ThemeID: 1},
+			err:   errNotYourTurn.Error(),
+		},
+		{
+			name:   "final bet",
+			step:   FinalBetting,
+			setup:  func(game *Game) { startFinalRound(game, 1) },
+			from:   1,
+			event:  MakeBet,
+			data:   MakeBetClientEvent{Bet: 50},
+			want:   FinalAnswering,
+			events: []ServerEventType{BetMadeServer, FinalQuestionServer},
+		},
+		{
+			name:  "final bet by a player out of the final",
+			step:  FinalBetting,
+			setup: func(game *Game) { startFinalRound(game, 1) },
+			from:  2,
+			event: MakeBet,
+			data:  MakeBetClientEvent{Bet: 50},
+			err:   "you are not in the final",
+		},
+		{
+			name:   "final answer",
+			step:   FinalAnswering,
+			setup:  func(game *Game) { startFinalRound(game, 1) },
+			from:   1,
+			event:  GiveAnswer,
+			data:   GiveAnswerClientEvent{Answer: "McCartney"},
+			want:   FinalJudging,
+			events: []ServerEventType{FinalAnswerMadeServer, CorrectAnswerServer, FinalJudgingServer},
+		},
+		{
+			name: "final answer accepted",
+			step: FinalJudging,
+			setup: func(game *Game) {
+				startFinalRound(game, 1)
+				game.final.bets[1] = 50
+			},
+			event:  AcceptAnswer,
+			want:   Final,
+			events: []ServerEventType{FinalBetRevealedServer, ScoreChangedServer, FinalServer},
+			check: func(t *testing.T, f *stepsFixture) {
+				if f.game.final != nil {
+					t.Error("final round is kept after judging")
+				}
+
+				if f.score(1) != 150 {
+					t.Errorf("score is %d, want 150", f.score(1))
+				}
+			},
+		},
+		{
+			name:  "kick without the moderator role",
+			step:  ChooseQuestion,
+			from:  1,
+			role:  models.RoleUser,
+			event: Kick,
+			data:  KickClientEvent{QueueID: 2},
+			err:   errPermissionDenied.Error(),
+		},
+		{
+			name:   "hub closed by an admin",
+			step:   ChooseQuestion,
+			role:   models.RoleAdmin,
+			event:  CloseHub,
+			data:   CloseHubClientEvent{Reason: "maintenance"},
+			want:   Closed,
+			events: []ServerEventType{HubClosedServer},
+			check: func(t *testing.T, f *stepsFixture) {
+				if f.closes != 1 {
+					t.Errorf("onClose called %d times, want once", f.closes)
+				}
+			},
+		},
+		{
+			name:  "preload progress of the leader",
+			step:  ReadingRound,
+			setup: func(game *Game) { game.currentRound = 1 },
+			event: PreloadProgress,
+			data:  PreloadProgressClientEvent{RoundID: 1},
+			err:   errPermissionDenied.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newStepsFixture(t, 2)
+
+			if tt.setup != nil {
+				tt.setup(f.game)
+			}
+
+			f.game.currentStep = tt.step
+
+			err := f.game.dispatch(f.event(tt.from, tt.event, tt.role, tt.data))
+
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+
+				if f.game.currentStep != tt.step {
+					t.Errorf("rejected event moved the game to step %d", f.game.currentStep)
+				}
+
+				if events := f.broadcasts(); len(events) != 0 {
+					t.Errorf("rejected event broadcast %v", events)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if f.game.currentStep != tt.want {
+				t.Errorf("game is at step %d, want %d", f.game.currentStep, tt.want)
+			}
+
+			if events := f.broadcasts(); !sameEvents(events, tt.events) {
+				t.Errorf("broadcast %v, want %v", events, tt.events)
+			}
+
+			if tt.check != nil {
+				tt.check(t, f)
+			}
+		})
+	}
+}
+
+func TestStepExpire(t *testing.T) {
+	tests := []struct {
+		name  string
+		step  Step
+		setup func(game *Game)
+
+		want   Step
+		events []ServerEventType
+		check  func(t *testing.T, f *stepsFixture)
+	}{
+		{
+			name: "nobody starts",
+			step: WaitingStart,
+			want: Closed,
+		},
+		{
+			name:   "greetings",
+			step:   Grettings,
+			want:   ReadingRound,
+			events: []ServerEventType{ReadingRoundServer, RoundManifestServer},
+		},
+		{
+			name:   "round name",
+			step:   ReadingRound,
+			setup:  func(game *Game) { game.currentRound = 1 },
+			want:   ReadingThemes,
+			events: []ServerEventType{ReadingThemesServer},
+		},
+		{
+			name:   "round themes",
+			step:   ReadingThemes,
+			setup:  func(game *Game) { game.currentRound = 1 },
+			want:   ChooseQuestion,
+			events: []ServerEventType{WallServer},
+		},
+		{
+			name: "final themes",
+			step: ReadingThemes,
+			setup: func(game *Game) {
+				game.currentRound = 2
+				game.participants[1].score = 100
+			},
+			want:   FinalThemes,
+			events: []ServerEventType{FinalThemesServer},
+		},
+		{
+			name:   "final themes without finalists",
+			step:   ReadingThemes,
+			setup:  func(game *Game) { game.currentRound = 2 },
+			want:   Final,
+			events: []ServerEventType{FinalServer},
+		},
+		{
+			name:   "nobody chooses",
+			step:   ChooseQuestion,
+			setup:  func(game *Game) { startQuestion(game, 1, 1) },
+			want:   Getting,
+			events: []ServerEventType{ChooseQuestServer, GetQuestServer},
+			check: func(t *testing.T, f *stepsFixture) {
+				if f.game.currentQuestion != 2 {
+					t.Errorf("question %d is chosen, want the last one", f.game.currentQuestion)
+				}
+			},
+		},
+		{
+			name: "nothing left to choose",
+			step: ChooseQuestion,
+			setup: func(game *Game) {
+				startQuestion(game, 1, 1)
+				for _, quest := range game.Rounds[0].Themes[0].Quests {
+					quest.Price = -1
+				}
+			},
+			want:   ReadingRound,
+			events: []ServerEventType{ReadingRoundServer, RoundManifestServer},
+		},
+		{
+			name:   "nobody takes the question",
+			step:   Getting,
+			setup:  func(game *Game) { startQuestion(game, 1, 1) },
+			want:   ChooseQuestion,
+			events: []ServerEventType{WallServer},
+			check: func(t *testing.T, f *stepsFixture) {
+				if len(f.game.outcomes) != 1 || f.game.Rounds[0].Themes[0].Quests[0].Price != -1 {
+					t.Errorf("question is not played, outcomes %+v", f.game.outcomes)
+				}
+			},
+		},
+		{
+			name:   "leader does not judge",
+			step:   Answering,
+			setup:  func(game *Game) { startQuestion(game, 1, 2) },
+			want:   ChooseQuestion,
+			events: []ServerEventType{AnswerDeclinedServer, ScoreChangedServer, WallServer},
+			check: func(t *testing.T, f *stepsFixture) {
+				if f.score(2) != -100 {
+					t.Errorf("score is %d, want -100", f.score(2))
+				}
+			},
+		},
+		{
+			name: "chooser does not stake",
+			step: Bidding,
+			setup: func(game *Game) {
+				startQuestion(game, 1, 1)
+				game.startAuction(game.Rounds[0].Themes[0].Quests[0])
+			},
+			want:   Answering,
+			events: []ServerEventType{StakeServer, AuctionResultServer, TakenQuestServer},
+			check: func(t *testing.T, f *stepsFixture) {
+				if f.game.auction != nil || f.game.currentPrice != 100 {
+					t.Errorf("auction is %+v for %d, want it over for 100", f.game.auction, f.game.currentPrice)
+				}
+			},
+		},
+		{
+			name: "chooser does not transfer",
+			step: Transferring,
+			setup: func(game *Game) {
+				startQuestion(game, 1, 1)
+				game.catInBag = &catInBag{theme: "Animals", cost: 300}
+			},
+			want:   Answering,
+			events: []ServerEventType{TransferredQuestServer, TakenQuestServer},
+			check: func(t *testing.T, f *stepsFixture) {
+				if f.game.catInBag != nil || f.game.currentPlayerID != 2 {
+					t.Errorf("player %d answers, want the next one", f.game.currentPlayerID)
+				}
+			},
+		},
+		{
+			name:   "finalist does not remove a theme",
+			step:   FinalThemes,
+			setup:  func(game *Game) { startFinalRound(game, 1) },
+			want:   FinalBetting,
+			events: []ServerEventType{ThemeRemovedServer, FinalBettingServer},
+		},
+		{
+			name:   "finalist does not bet",
+			step:   FinalBetting,
+			setup:  func(game *Game) { startFinalRound(game, 1) },
+			want:   FinalAnswering,
+			events: []ServerEventType{FinalQuestionServer},
+			check: func(t *testing.T, f *stepsFixture) {
+				if f.game.final.bets[1] != 1 {
+					t.Errorf("bet is %d, want 1", f.game.final.bets[1])
+				}
+			},
+		},
+		{
+			name:   "finalist does not answer",
+			step:   FinalAnswering,
+			setup:  func(game *Game) { startFinalRound(game, 1) },
+			want:   FinalJudging,
+			events: []ServerEventType{CorrectAnswerServer, FinalJudgingServer},
+		},
+		{
+			name: "leader does not judge the final",
+			step: FinalJudging,
+			setup: func(game *Game) {
+				startFinalRound(game, 1)
+				game.final.bets[1] = 50
+			},
+			want:   Final,
+			events: []ServerEventType{FinalBetRevealedServer, ScoreChangedServer, FinalServer},
+			check: func(t *testing.T, f *stepsFixture) {
+				if f.game.final != nil || f.score(1) != 50 {
+					t.Errorf("score is %d, want 50 and the final over", f.score(1))
+				}
+			},
+		},
+		{
+			name: "game over",
+			step: Final,
+			want: Closed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newStepsFixture(t, 2)
+
+			if tt.setup != nil {
+				tt.setup(f.game)
+			}
+
+			f.game.currentStep = tt.step
+			f.game.expire()
+
+			if f.game.currentStep != tt.want {
+				t.Fatalf("game is at step %d, want %d", f.game.currentStep, tt.want)
+			}
+
+			if events := f.broadcasts(); !sameEvents(events, tt.events) {
+				t.Errorf("broadcast %v, want %v", events, tt.events)
+			}
+
+			// the entered step runs for its own timeout
+			var deadline time.Time
+			if timeout := steps[tt.want].timeout; timeout != nil {
+				deadline = f.clock.Now().Add(timeout(f.game))
+			}
+
+			if !f.game.deadline.Equal(deadline) {
+				t.Errorf("step expires at %v, want %v", f.game.deadline, deadline)
+			}
+
+			if tt.check != nil {
+				tt.check(t, f)
+			}
+		})
+	}
+}
+
+func TestEnterClosedOnce(t *testing.T) {
+	f := newStepsFixture(t, 1)
+	hub := f.game.hub
+
+	hubsMutex.Lock()
+	lastHubID++
+	hub.id = lastHubID
+	hubs[hub.id] = hub
+	hubsMutex.Unlock()
+
+	f.game.startedAt = f.clock.Now()
+	f.game.currentStep = Final
+
+	f.game.moveTo(Closed)
+
+	select {
+	case <-hub.close:
+	default:
+		t.Fatal("hub is not closed")
+	}
+
+	if _, ok := findHub(hub.id); ok {
+		t.Fatal("closed hub is still listed")
+	}
+
+	if f.closes != 1 {
+		t.Fatalf("onClose called %d times, want once", f.closes)
+	}
+
+	// common events are still handled by a closed game
+	err := f.game.dispatch(f.event(0, CloseHub, models.RoleAdmin, CloseHubClientEvent{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.game.moveTo(Closed)
+
+	if f.closes != 1 {
+		t.Fatalf("onClose called %d times, want once", f.closes)
+	}
+}
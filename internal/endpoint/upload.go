@@ -0,0 +1,555 @@
+package endpoint
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"mygame/internal/models"
+	"mygame/tools/clock"
+	"mygame/tools/helpers"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Received archives wait in the packs directory, so that they are moved into place without copying.
+	PackUploadsPath = "/uploads"
+
+	// An unfinished upload is dropped after it has not received a chunk for so long.
+	packUploadTTL = 24 * time.Hour
+
+	maxPackUploadsPerUser = 3
+
+	packUploadIDLength = 16
+
+	chunkBufferSize = 32 * 1024
+)
+
+var (
+	errPackTooLarge       = errors.New("pack is too large")
+	errPackUploadNotFound = errors.New("upload not found")
+	errTooManyPackUploads = errors.New("too many unfinished uploads")
+	errChecksumMismatch   = errors.New("checksum mismatch")
+)
+
+// receiveArchive writes the archive to a temporary file, hashing it on the way.
+// The caller removes the file.
+func (e *Endpoint) receiveArchive(reader io.Reader, fileName string, uploaderID uint64) (string, *models.Pack, int, error) {
+	dir := e.configuration.Pack.Path + PackUploadsPath
+
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return "", nil, http.StatusInternalServerError, err
+	}
+
+	file, err := ioutil.TempFile(dir, "*.part")
+	if err != nil {
+		return "", nil, http.StatusInternalServerError, err
+	}
+
+	digest := sha256.New()
+
+	size, err := io.Copy(io.MultiWriter(file, digest), io.LimitReader(reader, MaxPackSize+1))
+	file.Close()
+	if err != nil {
+		return file.Name(), nil, http.StatusBadRequest, err
+	}
+
+	if size > MaxPackSize {
+		return file.Name(), nil, http.StatusRequestEntityTooLarge, errPackTooLarge
+	}
+
+	pack := &models.Pack{
+		Name:       packDisplayName(fileName),
+		UploaderID: uploaderID,
+		Size:       size,
+		UploadedAt: e.clock.Now(),
+	}
+
+	copy(pack.Hash[:], digest.Sum(nil))
+
+	return file.Name(), pack, http.StatusOK, nil
+}
+
+// packUpload is a resumable upload, chunks are appended in order and hashed as they arrive.
+// Uploads are kept in memory, so they do not survive a restart of the server.
+type packUpload struct {
+	mutex  sync.Mutex
+	id     string
+	name   string
+	userID uint64
+	login  string
+	size   int64
+	offset int64
+	digest hash.Hash
+
+	// Guarded by the mutex of packUploads.
+	updatedAt time.Time
+}
+
+type packUploads struct {
+	mutex   sync.Mutex
+	clock   clock.Clock
+	uploads map[string]*packUpload
+}
+
+func newPackUploads(clock clock.Clock) *packUploads {
+	return &packUploads{
+		clock:   clock,
+		uploads: make(map[string]*packUpload),
+	}
+}
+
+func (u *packUploads) add(upload *packUpload) error {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	var count int
+	for _, other := range u.uploads {
+		if other.userID == upload.userID && other.login == upload.login {
+			count++
+		}
+	}
+
+	if count >= maxPackUploadsPerUser {
+		return errTooManyPackUploads
+	}
+
+	u.uploads[upload.id] = upload
+
+	return nil
+}
+
+// get returns the upload of the user, nobody else may see it.
+func (u *packUploads) get(id string, userID uint64, login string) (*packUpload, bool) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	upload, ok := u.uploads[id]
+	if !ok || upload.userID != userID || upload.login != login {
+		return nil, false
+	}
+
+	return upload, true
+}
+
+func (u *packUploads) touch(upload *packUpload) {
+	u.mutex.Lock()
+	upload.updatedAt = u.clock.Now()
+	u.mutex.Unlock()
+}
+
+func (u *packUploads) remove(id string) {
+	u.mutex.Lock()
+	delete(u.uploads, id)
+	u.mutex.Unlock()
+}
+
+// expired removes and returns the uploads that have not received a chunk for too long.
+func (u *packUploads) expired() []string {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	var ids []string
+
+	deadline := u.clock.Now().Add(-packUploadTTL)
+	for id, upload := range u.uploads {
+		if upload.updatedAt.Before(deadline) {
+			ids = append(ids, id)
+			delete(u.uploads, id)
+		}
+	}
+
+	return ids
+}
+
+func (e *Endpoint) packUploadPath(id string) string {
+	return e.configuration.Pack.Path + PackUploadsPath + "/" + id + ".part"
+}
+
+// createPackUpload starts a resumable upload of the pack with the declared size.
+func (e *Endpoint) createPackUpload(w http.ResponseWriter, r *http.Request) {
+	ctx := e.CreateContext(w, r)
+
+	if r.Method != http.MethodPost {
+		e.responseWriterError(errors.New("method not allowed"), w, http.StatusMethodNotAllowed, ctx, "")
+
+		return
+	}
+
+	token, status, err := e.authorize(ctx, r)
+	if err != nil {
+		e.responseWriterError(err, w, status, ctx, "")
+
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusBadRequest, ctx, "read body error")
+
+		return
+	}
+
+	type request struct {
+		Name string `json:"name"`
+		Size int64  `json:"size"`
+	}
+
+	var req *request
+
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusBadRequest, ctx, "unmarshal body to struct error")
+
+		return
+	}
+
+	if req.Size <= 0 {
+		e.responseWriterError(errors.New("incorrect size"), w, http.StatusBadRequest, ctx, "")
+
+		return
+	}
+
+	if req.Size > MaxPackSize {
+		e.responseWriterError(errPackTooLarge, w, http.StatusRequestEntityTooLarge, ctx, "")
+
+		return
+	}
+
+	for _, id := range e.uploads.expired() {
+		os.Remove(e.packUploadPath(id))
+	}
+
+	id, err := helpers.GenerateToken(packUploadIDLength)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "generate upload id error")
+
+		return
+	}
+
+	upload := &packUpload{
+		id:        id,
+		name:      req.Name,
+		userID:    token.ID,
+		login:     token.Login,
+		size:      req.Size,
+		digest:    sha256.New(),
+		updatedAt: e.clock.Now(),
+	}
+
+	err = e.uploads.add(upload)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusTooManyRequests, ctx, "")
+
+		return
+	}
+
+	err = os.MkdirAll(e.configuration.Pack.Path+PackUploadsPath, 0755)
+	if err == nil {
+		err = ioutil.WriteFile(e.packUploadPath(id), nil, 0644)
+	}
+	if err != nil {
+		e.uploads.remove(id)
+		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "create upload error")
+
+		return
+	}
+
+	e.responseWriter(http.StatusOK, map[string]interface{}{
+		"upload_id": id,
+		"offset":    0,
+	}, w, ctx)
+}
+
+// packUpload handles the upload with the id:
+// GET tells the offset to resume from, PUT ?offset= appends a chunk, DELETE aborts the upload
+// and POST /finalize checks the SHA-256 of the whole archive and stores the pack.
+func (e *Endpoint) packUpload(w http.ResponseWriter, r *http.Request) {
+	ctx := e.CreateContext(w, r)
+
+	token, status, err := e.authorize(ctx, r)
+	if err != nil {
+		e.responseWriterError(err, w, status, ctx, "")
+
+		return
+	}
+
+	path := strings.Split(strings.TrimPrefix(r.URL.Path, PackUploadSessionEndpoint.ToString()), "/")
+	if len(path) > 2 || (len(path) == 2 && path[1] != "finalize") {
+		e.responseWriterError(errors.New("not found"), w, http.StatusNotFound, ctx, "")
+
+		return
+	}
+
+	upload, ok := e.uploads.get(path[0], token.ID, token.Login)
+	if !ok {
+		e.responseWriterError(errPackUploadNotFound, w, http.StatusNotFound, ctx, "")
+
+		return
+	}
+
+	upload.mutex.Lock()
+	defer upload.mutex.Unlock()
+
+	switch {
+	case len(path) == 2 && r.Method == http.MethodPost:
+		e.finalizePackUpload(ctx, w, r, upload)
+	case len(path) == 1 && r.Method == http.MethodGet:
+		e.responseWriter(http.StatusOK, map[string]interface{}{
+			"offset": upload.offset,
+			"size":   upload.size,
+		}, w, ctx)
+	case len(path) == 1 && r.Method == http.MethodPut:
+		e.writePackChunk(ctx, w, r, upload)
+	case len(path) == 1 && r.Method == http.MethodDelete:
+		e.uploads.remove(upload.id)
+		os.Remove(e.packUploadPath(upload.id))
+
+		e.responseWriter(http.StatusOK, map[string]interface{}{}, w, ctx)
+	default:
+		e.responseWriterError(errors.New("method not allowed"), w, http.StatusMethodNotAllowed, ctx, "")
+	}
+}
+
+// writePackChunk appends the body at the offset, which must be where the upload has stopped.
+// What has been received before a connection drops is kept, so the client resumes from the offset in the response.
+func (e *Endpoint) writePackChunk(ctx context.Context, w http.ResponseWriter, r *http.Request, upload *packUpload) {
+	offset, err := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+	if err != nil {
+		e.responseWriterError(errors.New("incorrect offset"), w, http.StatusBadRequest, ctx, "")
+
+		return
+	}
+
+	if offset != upload.offset {
+		e.responseWriter(http.StatusConflict, map[string]interface{}{
+			"error":  "offset mismatch",
+			"offset": upload.offset,
+		}, w, ctx)
+
+		return
+	}
+
+	remaining := upload.size - upload.offset
+	if r.ContentLength > remaining {
+		e.responseWriterError(errPackTooLarge, w, http.StatusRequestEntityTooLarge, ctx, "")
+
+		return
+	}
+
+	file, err := os.OpenFile(e.packUploadPath(upload.id), os.O_WRONLY, 0644)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "open upload error")
+
+		return
+	}
+
+	defer file.Close()
+
+	_, err = file.Seek(upload.offset, io.SeekStart)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "open upload error")
+
+		return
+	}
+
+	e.uploads.touch(upload)
+
+	buf := make([]byte, chunkBufferSize)
+
+	for remaining > 0 {
+		if int64(len(buf)) > remaining {
+			buf = buf[:remaining]
+		}
+
+		n, readErr := r.Body.Read(buf)
+		if n > 0 {
+			// the file and the hash must not part ways, so a failed write ends the upload
+			if _, err = file.Write(buf[:n]); err != nil {
+				e.uploads.remove(upload.id)
+				os.Remove(e.packUploadPath(upload.id))
+				e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "write upload error")
+
+				return
+			}
+
+			upload.digest.Write(buf[:n])
+			upload.offset += int64(n)
+			remaining -= int64(n)
+		}
+
+		if readErr == io.EOF {
+			break
+		} else if readErr != nil {
+			e.responseWriterError(readErr, w, http.StatusBadRequest, ctx, "read body error")
+
+			return
+		}
+	}
+
+	if remaining == 0 {
+		if n, _ := r.Body.Read(make([]byte, 1)); n > 0 {
+			e.responseWriterError(errPackTooLarge, w, http.StatusRequestEntityTooLarge, ctx, "")
+
+			return
+		}
+	}
+
+	e.responseWriter(http.StatusOK, map[string]interface{}{
+		"offset": upload.offset,
+	}, w, ctx)
+}
+
+func (e *Endpoint) finalizePackUpload(ctx context.Context, w http.ResponseWriter, r *http.Request, upload *packUpload) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusBadRequest, ctx, "read body error")
+
+		return
+	}
+
+	type request struct {
+		SHA256 string `json:"sha256"`
+	}
+
+	var req *request
+
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusBadRequest, ctx, "unmarshal body to struct error")
+
+		return
+	}
+
+	if upload.offset != upload.size {
+		e.responseWriter(http.StatusConflict, map[string]interface{}{
+			"error":  "upload is not complete",
+			"offset": upload.offset,
+		}, w, ctx)
+
+		return
+	}
+
+	pack := &models.Pack{
+		Name:       packDisplayName(upload.name),
+		UploaderID: upload.userID,
+		Size:       upload.size,
+		UploadedAt: e.clock.Now(),
+	}
+
+	copy(pack.Hash[:], upload.digest.Sum(nil))
+
+	// whatever the outcome, the received archive cannot be resumed any more
+	e.uploads.remove(upload.id)
+	defer os.Remove(e.packUploadPath(upload.id))
+
+	if !strings.EqualFold(req.SHA256, hex.EncodeToString(pack.Hash[:])) {
+		e.responseWriterError(errChecksumMismatch, w, http.StatusBadRequest, ctx, "")
+
+		return
+	}
+
+	e.writeStoredPack(ctx, w, e.packUploadPath(upload.id), pack)
+}
+
+// writeStoredPack stores the received archive and responds with the pack and the validation report.
+func (e *Endpoint) writeStoredPack(ctx context.Context, w http.ResponseWriter, path string, pack *models.Pack) {
+	pack, report, status, err := e.storePack(ctx, path, pack)
+	if err == errPackInvalid {
+		e.responseWriter(status, map[string]interface{}{
+			"error":  err.Error(),
+			"report": report,
+		}, w, ctx)
+
+		return
+	} else if err != nil {
+		e.responseWriterError(err, w, status, ctx, "store pack error")
+
+		return
+	}
+
+	e.responseWriter(http.StatusOK, map[string]interface{}{
+		"pack":   pack,
+		"report": report,
+	}, w, ctx)
+}
+
+// validateSiGamePack checks the pack from the multipart form without storing it.
+func (e *Endpoint) validateSiGamePack(w http.ResponseWriter, r *http.Request) {
+	ctx := e.CreateContext(w, r)
+
+	if r.Method != http.MethodPost {
+		e.responseWriterError(errors.New("method not allowed"), w, http.StatusMethodNotAllowed, ctx, "")
+
+		return
+	}
+
+	token, status, err := e.authorize(ctx, r)
+	if err != nil {
+		e.responseWriterError(err, w, status, ctx, "")
+
+		return
+	}
+
+	part, err := packFormPart(r)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusBadRequest, ctx, "get data from form file error")
+
+		return
+	}
+
+	path, pack, status, err := e.receiveArchive(part, part.FileName(), token.ID)
+	if path != "" {
+		defer os.Remove(path)
+	}
+	if err != nil {
+		e.responseWriterError(err, w, status, ctx, "receive pack error")
+
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		e.responseWriterError(err, w, http.StatusInternalServerError, ctx, "open pack error")
+
+		return
+	}
+
+	defer file.Close()
+
+	e.responseWriter(http.StatusOK, map[string]interface{}{
+		"report": validatePack(file, pack.Size, pack),
+	}, w, ctx)
+}
+
+// packFormPart finds the pack in the multipart form without reading the form into memory.
+func packFormPart(r *http.Request) (*multipart.Part, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, errors.New("no pack in the form")
+		} else if err != nil {
+			return nil, err
+		}
+
+		if part.FormName() == SiGame.ToString() {
+			return part, nil
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+)
+
+// uploadResponse is the part of the upload responses the tests look at.
+type uploadResponse struct {
+	UploadID string `json:"upload_id"`
+	Offset   int64  `json:"offset"`
+	Size     int64  `json:"size"`
+	Error    string `json:"error"`
+}
+
+func decodeUpload(t *testing.T, w *httptest.ResponseRecorder) *uploadResponse {
+	t.Helper()
+
+	var resp uploadResponse
+
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("response %q: %v", w.Body, err)
+	}
+
+	return &resp
+}
+
+func newTestUpload(t *testing.T, e *Endpoint, size int) string {
+	t.Helper()
+
+	w := e.serve(t, e.createPackUpload, http.MethodPost, "/pack/uploads", `{"name": "pack.siq", "size": `+strconv.Itoa(size)+`}`, 1)
+	if w.Code != http.StatusOK {
+		t.Fatalf("create upload status is %d: %s", w.Code, w.Body)
+	}
+
+	return decodeUpload(t, w).UploadID
+}
+
+func TestPackUploadOffsets(t *testing.T) {
+	e, _ := newTestEndpoint(t, nil)
+
+	id := newTestUpload(t, e, 10)
+	target := "/pack/uploads/" + id
+
+	steps := []struct {
+		name   string
+		offset string
+		body   string
+		status int
+		// offset of the upload after the step
+		want int64
+	}{
+		{name: "first chunk", offset: "0", body: "abcd", status: http.StatusOK, want: 4},
+		{name: "chunk sent again", offset: "0", body: "abcd", status: http.StatusConflict, want: 4},
+		{name: "chunk ahead", offset: "6", body: "gh", status: http.StatusConflict, want: 4},
+		{name: "no offset", offset: "", body: "ef", status: http.StatusBadRequest, want: 4},
+		{name: "negative offset", offset: "-4", body: "ef", status: http.StatusConflict, want: 4},
+		{name: "past the size", offset: "4", body: "efghijklmn", status: http.StatusRequestEntityTooLarge, want: 4},
+		{name: "next chunk", offset: "4", body: "efg", status: http.StatusOK, want: 7},
+		{name: "last chunk", offset: "7", body: "hij", status: http.StatusOK, want: 10},
+		{name: "after the end", offset: "10", body: "k", status: http.StatusRequestEntityTooLarge, want: 10},
+	}
+
+	for _, step := range steps {
+		w := e.serve(t, e.packUpload, http.MethodPut, target+"?offset="+step.offset, step.body, 1)
+		if w.Code != step.status {
+			t.Fatalf("%s: status is %d, want %d: %s", step.name, w.Code, step.status, w.Body)
+		}
+
+		// a conflict tells where to resume
+		if resp := decodeUpload(t, w); (w.Code == http.StatusOK || w.Code == http.StatusConflict) && resp.Offset != step.want {
+			t.Fatalf("%s: offset in the response is %d, want %d", step.name, resp.Offset, step.want)
+		}
+
+		w = e.serve(t, e.packUpload, http.MethodGet, target, "", 1)
+		if resp := decodeUpload(t, w); resp.Offset != step.want || resp.Size != 10 {
+			t.Fatalf("%s: upload is at %d of %d, want %d of 10", step.name, resp.Offset, resp.Size, step.want)
+		}
+	}
+
+	data, err := os.ReadFile(e.packUploadPath(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != "abcdefghij" {
+		t.Fatalf("received %q", data)
+	}
+}
+
+func TestPackUploadBelongsToUploader(t *testing.T) {
+	e, _ := newTestEndpoint(t, nil)
+
+	id := newTestUpload(t, e, 10)
+
+	w := e.serve(t, e.packUpload, http.MethodPut, "/pack/uploads/"+id+"?offset=0", "abcd", 2)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status of another user is %d", w.Code)
+	}
+
+	w = e.serve(t, e.packUpload, http.MethodGet, "/pack/uploads/"+id, "", 1)
+	if resp := decodeUpload(t, w); resp.Offset != 0 {
+		t.Fatalf("upload is at %d after a chunk of another user", resp.Offset)
+	}
+}
+
+func TestPackUploadFinalizeChecksOffsetAndChecksum(t *testing.T) {
+	e, _ := newTestEndpoint(t, nil)
+
+	id := newTestUpload(t, e, 4)
+	target := "/pack/uploads/" + id
+
+	if w := e.serve(t, e.packUpload, http.MethodPut, target+"?offset=0", "ab", 1); w.Code != http.StatusOK {
+		t.Fatalf("chunk status is %d: %s", w.Code, w.Body)
+	}
+
+	w := e.serve(t, e.packUpload, http.MethodPost, target+"/finalize", `{"sha256": ""}`, 1)
+	if resp := decodeUpload(t, w); w.Code != http.StatusConflict || resp.Offset != 2 {
+		t.Fatalf("unfinished upload: status is %d at %d", w.Code, resp.Offset)
+	}
+
+	if w := e.serve(t, e.packUpload, http.MethodPut, target+"?offset=2", "cd", 1); w.Code != http.StatusOK {
+		t.Fatalf("chunk status is %d: %s", w.Code, w.Body)
+	}
+
+	w = e.serve(t, e.packUpload, http.MethodPost, target+"/finalize", `{"sha256": "00"}`, 1)
+	if w.Code != http.StatusBadRequest || decodeUpload(t, w).Error != errChecksumMismatch.Error() {
+		t.Fatalf("checksum mismatch: status is %d: %s", w.Code, w.Body)
+	}
+
+	// the upload cannot be resumed after a failed finalize
+	if w := e.serve(t, e.packUpload, http.MethodGet, target, "", 1); w.Code != http.StatusNotFound {
+		t.Fatalf("upload status after finalize is %d", w.Code)
+	}
+
+	if _, err := os.Stat(e.packUploadPath(id)); !os.IsNotExist(err) {
+		t.Fatalf("received archive is kept: %v", err)
+	}
+}
@@ -0,0 +1,321 @@
+package endpoint
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mygame/internal/models"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxPackFiles = 10000
+
+	// Limits against zip bombs, the ratio is only checked for files bigger than a megabyte.
+	maxUnpackedPackSize = 1024 * MB
+	maxCompressionRatio = 100
+
+	maxMediaSize = 20 * MB
+)
+
+// Directories of the archive the content refers to by the type of the object.
+var mediaDirs = map[ObjectType]string{
+	Image: strings.TrimPrefix(defaultImagesPath, "/"),
+	Audio: strings.TrimPrefix(defaultAudioPath, "/"),
+	Video: strings.TrimPrefix(defaultVideoPath, "/"),
+	HTML:  strings.TrimPrefix(defaultHTMLPath, "/"),
+}
+
+// validatePack checks the archive and content.xml of the pack, filling the pack with the description
+// and the counts along the way.
+func validatePack(file io.ReaderAt, size int64, pack *models.Pack) *models.PackReport {
+	report := models.NewPackReport()
+
+	archive, err := zip.NewReader(file, size)
+	if err != nil {
+		report.Add(models.SeverityError, "archive_invalid", "", "the pack is not a zip archive")
+
+		return report
+	}
+
+	if len(archive.File) > maxPackFiles {
+		report.Add(models.SeverityError, "too_many_files", "",
+			fmt.Sprintf("the archive has %d files, at most %d are allowed", len(archive.File), maxPackFiles))
+
+		return report
+	}
+
+	var content *zip.File
+	var unpacked uint64
+
+	// media files by directory and name, the names are escaped in SIGame archives
+	media := make(map[string]map[string]*zip.File)
+	for _, dir := range mediaDirs {
+		media[dir] = make(map[string]*zip.File)
+	}
+
+	for _, f := range archive.File {
+		unpacked += f.UncompressedSize64
+
+		if !isArchiveNameSafe(f.Name) {
+			report.Add(models.SeverityError, "path_unsafe", f.Name, "the file would be unpacked outside of the pack")
+
+			continue
+		}
+
+		if f.UncompressedSize64 > MB && f.CompressedSize64 > 0 &&
+			f.UncompressedSize64/f.CompressedSize64 > maxCompressionRatio {
+			report.Add(models.SeverityError, "compression_ratio", f.Name, "the file is compressed suspiciously well")
+		}
+
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		if f.Name == defaultContentName {
+			content = f
+
+			continue
+		}
+
+		slash := strings.Index(f.Name, "/")
+		if slash == -1 {
+			continue
+		}
+
+		files, ok := media[f.Name[:slash]]
+		if !ok {
+			continue
+		}
+
+		name, err := url.PathUnescape(f.Name[slash+1:])
+		if err != nil {
+			name = f.Name[slash+1:]
+		}
+
+		files[name] = f
+
+		if f.UncompressedSize64 > maxMediaSize {
+			report.Add(models.SeverityWarning, "media_oversized", f.Name,
+				fmt.Sprintf("the file takes %d MB, players may wait long for it", f.UncompressedSize64/MB))
+		}
+	}
+
+	if unpacked > maxUnpackedPackSize {
+		report.Add(models.SeverityError, "unpacked_too_large", "",
+			fmt.Sprintf("the pack takes %d MB unpacked, at most %d MB are allowed", unpacked/MB, maxUnpackedPackSize/MB))
+	}
+
+	pack.Images = len(media[mediaDirs[Image]])
+	pack.Audio = len(media[mediaDirs[Audio]])
+	pack.Video = len(media[mediaDirs[Video]])
+
+	if content == nil {
+		report.Add(models.SeverityError, "content_missing", "", "the archive has no "+defaultContentName)
+
+		return report
+	}
+
+	if !report.Valid {
+		return report
+	}
+
+	siGame, err := readContent(content)
+	if err != nil {
+		report.Add(models.SeverityError, "content_invalid", defaultContentName, err.Error())
+
+		return report
+	}
+
+	pack.Title = siGame.Name
+	pack.Created = siGame.Date
+	pack.Difficulty, _ = strconv.Atoi(siGame.Difficulty)
+
+	if siGame.Info != nil && siGame.Info.Authors != nil {
+		pack.Author = siGame.Info.Authors.Author
+	}
+
+	if strings.TrimSpace(siGame.Name) == "" {
+		report.Add(models.SeverityWarning, "name_missing", "", "the pack has no name")
+	}
+
+	if pack.Author == "" {
+		report.Add(models.SeverityWarning, "authors_missing", "", "the pack has no authors")
+	}
+
+	if siGame.Rounds == nil || len(siGame.Rounds.Round) == 0 {
+		report.Add(models.SeverityError, "rounds_missing", "", "the pack has no rounds")
+
+		return report
+	}
+
+	referenced := make(map[*zip.File]bool)
+	version := formatVersion(siGame)
+
+	pack.Rounds = len(siGame.Rounds.Round)
+
+	for i, round := range siGame.Rounds.Round {
+		roundLocation := fmt.Sprintf("round %d", i+1)
+
+		if round.Themes == nil || len(round.Themes.Theme) == 0 {
+			report.Add(models.SeverityError, "round_empty", roundLocation, "the round has no themes")
+
+			continue
+		}
+
+		pack.Themes += len(round.Themes.Theme)
+
+		for j, theme := range round.Themes.Theme {
+			themeLocation := fmt.Sprintf("%s, theme %d", roundLocation, j+1)
+
+			if theme.Questions == nil || len(theme.Questions.Question) == 0 {
+				report.Add(models.SeverityWarning, "theme_empty", themeLocation, "the theme has no questions")
+
+				continue
+			}
+
+			pack.Questions += len(theme.Questions.Question)
+
+			prices := make(map[int]bool)
+
+			for k, question := range theme.Questions.Question {
+				location := fmt.Sprintf("%s, question %d", themeLocation, k+1)
+
+				quest, err := convertQuestion(question, version)
+				if err != nil {
+					report.Add(models.SeverityError, "price_invalid", location,
+						fmt.Sprintf("the price %q is not a number", question.Price))
+				} else if prices[quest.Price] && round.Type != FinalRound.String() {
+					report.Add(models.SeverityWarning, "price_duplicate", location,
+						fmt.Sprintf("another question of the theme costs %d", quest.Price))
+				}
+
+				prices[quest.Price] = true
+
+				validateQuestion(report, location, question, quest, media, referenced)
+			}
+		}
+	}
+
+	for _, dir := range mediaDirs {
+		for _, f := range media[dir] {
+			if !referenced[f] {
+				report.Add(models.SeverityWarning, "media_unused", f.Name, "no question refers to the file")
+			}
+		}
+	}
+
+	return report
+}
+
+// isArchiveNameSafe tells if the file stays inside the pack once unpacked,
+// names are checked as they are and unescaped the way they are unpacked.
+func isArchiveNameSafe(name string) bool {
+	names := []string{name}
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		names = append(names, unescaped)
+	}
+
+	for _, name := range names {
+		if strings.HasPrefix(name, "/") || strings.HasPrefix(name, `\`) {
+			return false
+		}
+
+		for _, part := range strings.FieldsFunc(name, func(r rune) bool { return r == '/' || r == '\\' }) {
+			if part == ".." {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func validateQuestion(report *models.PackReport, location string, question *models.Question, quest *Question,
+	media map[string]map[string]*zip.File, referenced map[*zip.File]bool) {
+	if len(quest.Scene) == 0 {
+		report.Add(models.SeverityError, "scenario_missing", location, "the question has nothing to show")
+	}
+
+	objects := append(append([]*Object(nil), quest.Scene...), quest.Answer...)
+	for _, option := range quest.AnswerOptions {
+		objects = append(objects, option.Content...)
+	}
+
+	for _, object := range objects {
+		dir, ok := mediaDirs[object.Type]
+		if !ok || !object.IsRef {
+			continue
+		}
+
+		f, ok := media[dir][object.Src]
+		if !ok {
+			report.Add(models.SeverityError, "media_missing", location,
+				fmt.Sprintf("the file %s is not in the %s directory", object.Src, dir))
+
+			continue
+		}
+
+		referenced[f] = true
+	}
+
+	if question.Right == nil || strings.TrimSpace(strings.Join(question.Right.Answer, "")) == "" {
+		report.Add(models.SeverityError, "answer_missing", location, "the question has no right answer")
+	}
+
+	switch quest.AnswerType {
+	case AnswerTypeText:
+	case AnswerTypeSelect:
+		if len(quest.AnswerOptions) < 2 {
+			report.Add(models.SeverityError, "answer_options_missing", location,
+				"the question to select the answer for has less than two options")
+		}
+	default:
+		report.Add(models.SeverityWarning, "answer_type_unknown", location,
+			fmt.Sprintf("the answer type %q is played as a text answer", quest.AnswerType))
+	}
+
+	switch quest.Type {
+	case Simple, Auction:
+	case Cat, BagCat:
+		cost, ok := quest.Params[catCostParam]
+		if !ok {
+			break
+		}
+
+		if value, err := strconv.Atoi(cost); err != nil || value <= 0 {
+			report.Add(models.SeverityWarning, "param_invalid", location,
+				fmt.Sprintf("the cost %q is not a positive number, the price is used instead", cost))
+		}
+	default:
+		report.Add(models.SeverityWarning, "question_type_unknown", location,
+			fmt.Sprintf("the type %q is played as a simple question", quest.Type))
+	}
+}
+
+func readContent(f *zip.File) (*models.Package, error) {
+	reader, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	defer reader.Close()
+
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	var siGame models.Package
+
+	err = xml.Unmarshal(data, &siGame)
+	if err != nil {
+		return nil, err
+	}
+
+	return &siGame, nil
+}
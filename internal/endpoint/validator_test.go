@@ -0,0 +1,156 @@
+package endpoint
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"mygame/internal/models"
+	"testing"
+)
+
+// archiveFile is a file of the test archive, the sizes are only declared when compressed is set.
+type archiveFile struct {
+	name         string
+	data         string
+	compressed   uint64
+	uncompressed uint64
+}
+
+func newTestArchive(t *testing.T, files ...archiveFile) *bytes.Reader {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	archive := zip.NewWriter(&buf)
+
+	for _, f := range files {
+		var w io.Writer
+		var err error
+
+		data := []byte(f.data)
+
+		if f.compressed == 0 {
+			w, err = archive.Create(f.name)
+		} else {
+			// the sizes of the header are what the validator trusts, the data is never inflated
+			w, err = archive.CreateRaw(&zip.FileHeader{
+				Name:               f.name,
+				Method:             zip.Deflate,
+				CompressedSize64:   f.compressed,
+				UncompressedSize64: f.uncompressed,
+			})
+			data = make([]byte, f.compressed)
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return bytes.NewReader(buf.Bytes())
+}
+
+func hasProblem(report *models.PackReport, code string, location string) bool {
+	for _, problem := range report.Problems {
+		if problem.Code == code && problem.Location == location {
+			return true
+		}
+	}
+
+	return false
+}
+
+func problemCodes(report *models.PackReport) []string {
+	codes := make([]string, 0, len(report.Problems))
+	for _, problem := range report.Problems {
+		codes = append(codes, problem.Code+" "+problem.Location)
+	}
+
+	return codes
+}
+
+func TestValidatePackRejectsUnsafePaths(t *testing.T) {
+	for _, name := range []string{
+		"../evil",
+		"Images/../../evil",
+		"/etc/evil",
+		`..\evil`,
+		"%2e%2e/evil",
+		"Images%2F..%2F..%2Fevil",
+	} {
+		archive := newTestArchive(t,
+			archiveFile{name: defaultContentName, data: "<package/>"},
+			archiveFile{name: name, data: "evil"},
+		)
+
+		report := validatePack(archive, archive.Size(), &models.Pack{})
+		if report.Valid || !hasProblem(report, "path_unsafe", name) {
+			t.Errorf("%s: problems are %v", name, problemCodes(report))
+		}
+	}
+
+	// dots inside of a name are fine
+	archive := newTestArchive(t,
+		archiveFile{name: defaultContentName, data: "<package/>"},
+		archiveFile{name: "Images/..cat..%2Ejpg", data: "cat"},
+	)
+
+	if report := validatePack(archive, archive.Size(), &models.Pack{}); hasProblem(report, "path_unsafe", "Images/..cat..%2Ejpg") {
+		t.Error("a safe name is rejected")
+	}
+}
+
+func TestValidatePackRejectsZipBombs(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    []archiveFile
+		code     string
+		location string
+	}{
+		{
+			name:     "compression ratio",
+			files:    []archiveFile{{name: "Images/bomb.jpg", compressed: 20 * 1024, uncompressed: 2*MB + 1}},
+			code:     "compression_ratio",
+			location: "Images/bomb.jpg",
+		},
+		{
+			name: "unpacked size",
+			files: []archiveFile{
+				{name: "Video/1.mp4", compressed: 6 * MB, uncompressed: 512 * MB},
+				{name: "Video/2.mp4", compressed: 6 * MB, uncompressed: 512*MB + 1},
+			},
+			code: "unpacked_too_large",
+		},
+	}
+
+	for _, test := range tests {
+		archive := newTestArchive(t, append(test.files, archiveFile{name: defaultContentName, data: "<package/>"})...)
+
+		report := validatePack(archive, archive.Size(), &models.Pack{})
+		if report.Valid {
+			t.Errorf("%s: the pack is valid", test.name)
+		}
+
+		if !hasProblem(report, test.code, test.location) {
+			t.Errorf("%s: problems are %v, want %s", test.name, problemCodes(report), test.code)
+		}
+	}
+
+	// a well compressed small file is not a bomb
+	archive := newTestArchive(t,
+		archiveFile{name: defaultContentName, data: "<package/>"},
+		archiveFile{name: "Images/small.jpg", compressed: 10, uncompressed: MB},
+	)
+
+	if report := validatePack(archive, archive.Size(), &models.Pack{}); hasProblem(report, "compression_ratio", "Images/small.jpg") {
+		t.Error("the ratio of a file smaller than a megabyte is checked")
+	}
+}
@@ -14,10 +14,15 @@ func (c *Credentials) Validate() error {
 	if len(c.Login) > 32 {
 		return errors.New("логин не может быть больше 32 символов")
 	}
-	if len(c.Password) > 64 {
+
+	return ValidatePassword(c.Password)
+}
+
+func ValidatePassword(password string) error {
+	if len(password) > 64 {
 		return errors.New("пароль не может быть больше 64 символов")
 	}
-	if len(c.Password) < 8 {
+	if len(password) < 8 {
 		return errors.New("пароль не может быть меньше 8 символов")
 	}
 
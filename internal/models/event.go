@@ -1,12 +1,19 @@
 package models
 
 type CreateGame struct {
-	Name       string   `json:"name"`
-	Password   string   `json:"password"`
-	MaxPlayers int      `json:"max_players"`
-	PackUID    [32]byte `json:"pack_uid"`
+	Name          string   `json:"name"`
+	Password      string   `json:"password"`
+	MaxPlayers    int      `json:"max_players"`
+	MaxSpectators int      `json:"max_spectators"`
+	PackUID       [32]byte `json:"pack_uid"`
 }
 
 type JoinGame struct {
-	HubID int `json:"hub_id"`
+	HubID    int    `json:"hub_id"`
+	Password string `json:"password"`
+	Spectate bool   `json:"spectate"`
+
+	// Either of them lets in without the password, the hub ID is not needed then.
+	InviteCode string `json:"invite_code"`
+	Invite     string `json:"invite"`
 }
@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+const (
+	// The game has reached the final screen.
+	GameFinished = "finished"
+	// Everybody has left before the end.
+	GameAbandoned = "abandoned"
+)
+
+type GameResult struct {
+	ID          uint64    `json:"id"           db:"id"`
+	HubName     string    `json:"hub_name"     db:"hub_name"`
+	PackHash    []byte    `json:"pack_hash"    db:"pack_hash"`
+	PackName    string    `json:"pack_name"    db:"pack_name"`
+	LeaderID    uint64    `json:"leader_id"    db:"leader_id"`
+	LeaderLogin string    `json:"leader_login" db:"leader_login"`
+	StartedAt   time.Time `json:"started_at"   db:"started_at"`
+	FinishedAt  time.Time `json:"finished_at"  db:"finished_at"`
+	EndReason   string    `json:"end_reason"   db:"end_reason"`
+
+	Participants []*GameParticipant `json:"participants" db:"-"`
+	Questions    []*QuestionOutcome `json:"questions"    db:"-"`
+}
+
+type GameParticipant struct {
+	QueueID int `json:"queue_id" db:"queue_id"`
+	// Zero for anonymous players.
+	UserID   uint64 `json:"user_id"  db:"user_id"`
+	Nickname string `json:"nickname" db:"nickname"`
+	Score    int    `json:"score"    db:"score"`
+}
+
+type QuestionOutcome struct {
+	Round      int `json:"round"       db:"round"`
+	ThemeID    int `json:"theme_id"    db:"theme_id"`
+	QuestionID int `json:"question_id" db:"question_id"`
+	// Zero when nobody has answered.
+	QueueID    int       `json:"queue_id"    db:"queue_id"`
+	Price      int       `json:"price"       db:"price"`
+	Correct    bool      `json:"correct"     db:"correct"`
+	AnsweredAt time.Time `json:"answered_at" db:"answered_at"`
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"time"
+)
+
+// PackHash is the SHA-256 of the pack archive.
+type PackHash [32]byte
+
+func (h PackHash) Value() (driver.Value, error) {
+	return h[:], nil
+}
+
+func (h *PackHash) Scan(src interface{}) error {
+	data, ok := src.([]byte)
+	if !ok || len(data) != len(h) {
+		return errors.New("incorrect pack hash")
+	}
+
+	copy(h[:], data)
+
+	return nil
+}
+
+type Pack struct {
+	Hash PackHash `json:"hash"        db:"hash"`
+	// Name of the archive in the packs directory.
+	FileName      string    `json:"-"              db:"file_name"`
+	Name          string    `json:"name"           db:"name"`
+	UploaderID    uint64    `json:"uploader_id"    db:"uploader_id"`
+	UploaderLogin string    `json:"uploader_login" db:"uploader_login"`
+	Size          int64     `json:"size"           db:"size"`
+	UploadedAt    time.Time `json:"uploaded_at"    db:"uploaded_at"`
+
+	// Taken from content.xml of the pack.
+	Title      string `json:"title"      db:"title"`
+	Author     string `json:"author"     db:"author"`
+	Created    string `json:"created"    db:"created"`
+	Difficulty int    `json:"difficulty" db:"difficulty"`
+	Rounds     int    `json:"rounds"     db:"rounds"`
+	Themes     int    `json:"themes"     db:"themes"`
+	Questions  int    `json:"questions"  db:"questions"`
+	Images     int    `json:"images"     db:"images"`
+	Audio      int    `json:"audio"      db:"audio"`
+	Video      int    `json:"video"      db:"video"`
+}
+
+const (
+	// The pack cannot be played and is rejected.
+	SeverityError = "error"
+	// The pack can be played, but something in it is likely a mistake.
+	SeverityWarning = "warning"
+)
+
+type PackProblem struct {
+	Severity string `json:"severity"`
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+	// Round, theme and question the problem is found in, or the file of the archive.
+	Location string `json:"location,omitempty"`
+}
+
+// PackReport lists the problems found in the pack by the validation.
+type PackReport struct {
+	Valid    bool           `json:"valid"`
+	Errors   int            `json:"errors"`
+	Warnings int            `json:"warnings"`
+	Problems []*PackProblem `json:"problems"`
+}
+
+func NewPackReport() *PackReport {
+	return &PackReport{
+		Valid:    true,
+		Problems: make([]*PackProblem, 0),
+	}
+}
+
+func (r *PackReport) Add(severity string, code string, location string, message string) {
+	r.Problems = append(r.Problems, &PackProblem{
+		Severity: severity,
+		Code:     code,
+		Message:  message,
+		Location: location,
+	})
+
+	if severity == SeverityError {
+		r.Valid = false
+		r.Errors++
+	} else {
+		r.Warnings++
+	}
+}
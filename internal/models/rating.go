@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+type Rating struct {
+	UserID uint64 `json:"user_id" db:"user_id"`
+	Login  string `json:"login"   db:"login"`
+	// The current rating in the global leaderboard, the rating gained in the period otherwise.
+	Rating int `json:"rating"  db:"rating"`
+	Games  int `json:"games"   db:"games"`
+}
+
+type RatingChange struct {
+	GameID       uint64    `json:"game_id"       db:"game_id"`
+	RatingBefore int       `json:"rating_before" db:"rating_before"`
+	RatingAfter  int       `json:"rating_after"  db:"rating_after"`
+	CreatedAt    time.Time `json:"created_at"    db:"created_at"`
+}
+
+// LeaderboardFilter narrows the leaderboard to the games finished since the time or played with the pack.
+type LeaderboardFilter struct {
+	Since    *time.Time
+	PackHash []byte
+	Limit    int
+	Offset   int
+}
@@ -58,7 +58,12 @@ type Question struct {
 	Price    string    `xml:"price,attr"`
 	Scenario *Scenario `xml:"scenario"`
 	Right    *Right    `xml:"right"`
+	Wrong    *Wrong    `xml:"wrong"`
 	Type     *Type     `xml:"type"`
+
+	// Format 5 keeps the type in the attribute and the content in the params.
+	TypeName string          `xml:"type,attr"`
+	Params   *QuestionParams `xml:"params"`
 }
 
 type Scenario struct {
@@ -69,6 +74,8 @@ type Scenario struct {
 type Atom struct {
 	Text string `xml:",chardata"`
 	Type string `xml:"type,attr"`
+	// Seconds the atom is shown for.
+	Time string `xml:"time,attr"`
 }
 
 type Right struct {
@@ -76,6 +83,11 @@ type Right struct {
 	Answer []string `xml:"answer"`
 }
 
+type Wrong struct {
+	Text   string   `xml:",chardata"`
+	Answer []string `xml:"answer"`
+}
+
 type Type struct {
 	Text  string   `xml:",chardata"`
 	Name  string   `xml:"name,attr"`
@@ -86,3 +98,34 @@ type Param struct {
 	Text string `xml:",chardata"`
 	Name string `xml:"name,attr"`
 }
+
+type QuestionParams struct {
+	Text  string           `xml:",chardata"`
+	Param []*QuestionParam `xml:"param"`
+}
+
+// QuestionParam is a param of format 5, its type tells which of the fields holds the value.
+type QuestionParam struct {
+	Text      string           `xml:",chardata"`
+	Name      string           `xml:"name,attr"`
+	Type      string           `xml:"type,attr"`
+	Item      []*Item          `xml:"item"`
+	Param     []*QuestionParam `xml:"param"`
+	NumberSet *NumberSet       `xml:"numberSet"`
+}
+
+// Item is a piece of content of format 5, a reference names a file of the archive.
+type Item struct {
+	Text          string `xml:",chardata"`
+	Type          string `xml:"type,attr"`
+	IsRef         bool   `xml:"isRef,attr"`
+	Placement     string `xml:"placement,attr"`
+	Duration      string `xml:"duration,attr"`
+	WaitForFinish string `xml:"waitForFinish,attr"`
+}
+
+type NumberSet struct {
+	Minimum int `xml:"minimum,attr"`
+	Maximum int `xml:"maximum,attr"`
+	Step    int `xml:"step,attr"`
+}
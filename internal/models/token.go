@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// TokenFamily is a login session: every refresh token issued by rotation belongs to the family
+// of the first one, and access tokens carry the family ID so that a revoked session is rejected.
+type TokenFamily struct {
+	ID        string     `db:"id"`
+	UserID    uint64     `db:"user_id"`
+	Login     string     `db:"login"`
+	CreatedAt time.Time  `db:"created_at"`
+	RevokedAt *time.Time `db:"revoked_at"`
+}
+
+const (
+	TokenPurposeVerifyEmail   = "verify_email"
+	TokenPurposeResetPassword = "reset_password"
+)
+
+// UserToken is a single-use token mailed to the user, only its hash is stored.
+type UserToken struct {
+	UserID  uint64 `db:"user_id"`
+	Purpose string `db:"purpose"`
+	// Address the verification token was sent to.
+	Email     string     `db:"email"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	UsedAt    *time.Time `db:"used_at"`
+	CreatedAt time.Time  `db:"created_at"`
+}
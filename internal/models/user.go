@@ -1,11 +1,30 @@
 package models
 
-import "errors"
+import (
+	"errors"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// Account roles, unlike the roles in a game they are the same in every hub.
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// GuestSuffixSeparator separates the nickname of a guest from its random suffix, registered logins cannot contain it.
+const GuestSuffixSeparator = "#"
 
 type User struct {
 	Login    string `json:"login"    db:"login"`
 	Password string `json:"password" db:"password"`
 	Photo    string `json:"photo"    db:"photo"`
+	Guest    bool   `json:"-"        db:"guest"`
+	// Optional, used to recover the account once verified.
+	Email         string `json:"email" db:"email"`
+	EmailVerified bool   `json:"-"     db:"email_verified"`
 }
 
 func (u *User) Validate() error {
@@ -15,11 +34,41 @@ func (u *User) Validate() error {
 	if len(u.Login) > 32 {
 		return errors.New("логин не может быть больше 32 символов")
 	}
-	if len(u.Password) > 64 {
-		return errors.New("пароль не может быть больше 64 символов")
+	if strings.Contains(u.Login, GuestSuffixSeparator) {
+		return errors.New("логин не может содержать символ " + GuestSuffixSeparator)
+	}
+	if err := ValidateEmail(u.Email); u.Email != "" && err != nil {
+		return err
 	}
-	if len(u.Password) < 8 {
-		return errors.New("пароль не может быть меньше 8 символов")
+
+	return ValidatePassword(u.Password)
+}
+
+// UserSummary is a user as listed to admins.
+type UserSummary struct {
+	ID        uint64     `json:"id"         db:"id"`
+	Login     string     `json:"login"      db:"login"`
+	Email     string     `json:"email"      db:"email"`
+	Role      string     `json:"role"       db:"role"`
+	Guest     bool       `json:"guest"      db:"guest"`
+	BannedAt  *time.Time `json:"banned_at"  db:"banned_at"`
+	BanReason string     `json:"ban_reason" db:"ban_reason"`
+}
+
+type UserFilter struct {
+	// Part of the login.
+	Login  string
+	Banned *bool
+
+	Limit  int
+	Offset int
+}
+
+// ValidateEmail accepts a bare address only, like "user@example.com".
+func ValidateEmail(email string) error {
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email || len(email) > 255 {
+		return errors.New("некорректный email")
 	}
 
 	return nil
@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"mygame/internal/models"
+)
+
+// Game keeps the times in UTC, the columns are timestamps without time zone.
+type Game struct {
+	db *sqlx.DB
+}
+
+func NewGameRepository(db *sqlx.DB) *Game {
+	return &Game{
+		db: db,
+	}
+}
+
+// SaveGame stores the game with its participants and question outcomes in one transaction.
+func (g *Game) SaveGame(ctx context.Context, game *models.GameResult) (uint64, error) {
+	tx, err := g.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	var id uint64
+
+	err = tx.QueryRowContext(ctx, "INSERT INTO games (hub_name, pack_hash, pack_name, leader_id, leader_login, started_at, finished_at, end_reason) "+
+		"VALUES ($1,$2,$3,$4,$5,$6,$7,$8) RETURNING id",
+		game.HubName,
+		game.PackHash,
+		game.PackName,
+		game.LeaderID,
+		game.LeaderLogin,
+		game.StartedAt.UTC(),
+		game.FinishedAt.UTC(),
+		game.EndReason,
+	).Scan(&id)
+	if err != nil {
+		return 0, errors.New("game creation error")
+	}
+
+	for _, participant := range game.Participants {
+		_, err = tx.ExecContext(ctx, "INSERT INTO game_participants (game_id, queue_id, user_id, nickname, score) VALUES ($1,$2,$3,$4,$5)",
+			id,
+			participant.QueueID,
+			participant.UserID,
+			participant.Nickname,
+			participant.Score,
+		)
+		if err != nil {
+			return 0, errors.New("game participant creation error")
+		}
+	}
+
+	for _, question := range game.Questions {
+		_, err = tx.ExecContext(ctx, "INSERT INTO game_questions (game_id, round, theme_id, question_id, queue_id, price, correct, answered_at) "+
+			"VALUES ($1,$2,$3,$4,$5,$6,$7,$8)",
+			id,
+			question.Round,
+			question.ThemeID,
+			question.QuestionID,
+			question.QueueID,
+			question.Price,
+			question.Correct,
+			question.AnsweredAt.UTC(),
+		)
+		if err != nil {
+			return 0, errors.New("game question creation error")
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	game.ID = id
+
+	return id, nil
+}
+
+// GetGamesByUserID returns the games the user has played or led, the latest first, with participants.
+func (g *Game) GetGamesByUserID(ctx context.Context, userID uint64, limit int, offset int) ([]*models.GameResult, error) {
+	games := make([]*models.GameResult, 0)
+
+	err := g.db.SelectContext(ctx, &games, "SELECT * FROM games WHERE leader_id = $1 "+
+		"OR id IN (SELECT game_id FROM game_participants WHERE user_id = $1) "+
+		"ORDER BY finished_at DESC, id DESC LIMIT $2 OFFSET $3", userID, limit, offset)
+	if err != nil {
+		return nil, errors.New("games not found")
+	}
+
+	for _, game := range games {
+		game.Participants, err = g.getParticipants(ctx, game.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return games, nil
+}
+
+func (g *Game) GetGameByID(ctx context.Context, id uint64) (*models.GameResult, error) {
+	var game models.GameResult
+
+	err := g.db.GetContext(ctx, &game, "SELECT * FROM games WHERE id = $1", id)
+	if err != nil {
+		return nil, errors.New("game not found")
+	}
+
+	game.Participants, err = g.getParticipants(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	game.Questions = make([]*models.QuestionOutcome, 0)
+
+	err = g.db.SelectContext(ctx, &game.Questions, "SELECT round, theme_id, question_id, queue_id, price, correct, answered_at "+
+		"FROM game_questions WHERE game_id = $1 ORDER BY answered_at", id)
+	if err != nil {
+		return nil, errors.New("game questions not found")
+	}
+
+	return &game, nil
+}
+
+func (g *Game) getParticipants(ctx context.Context, gameID uint64) ([]*models.GameParticipant, error) {
+	participants := make([]*models.GameParticipant, 0)
+
+	err := g.db.SelectContext(ctx, &participants, "SELECT queue_id, user_id, nickname, score "+
+		"FROM game_participants WHERE game_id = $1 ORDER BY queue_id", gameID)
+	if err != nil {
+		return nil, errors.New("game participants not found")
+	}
+
+	return participants, nil
+}
@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"mygame/internal/models"
+)
+
+var ErrPackNotFound = errors.New("pack not found")
+
+const packColumns = `p.hash, p.file_name, p.name, p.uploader_id, COALESCE(u.login, '') AS uploader_login, p.size, p.uploaded_at,
+	p.title, p.author, p.created, p.difficulty, p.rounds, p.themes, p.questions, p.images, p.audio, p.video`
+
+// Pack keeps the times in UTC, the columns are timestamps without time zone.
+type Pack struct {
+	db *sqlx.DB
+}
+
+func NewPackRepository(db *sqlx.DB) *Pack {
+	return &Pack{
+		db: db,
+	}
+}
+
+// CreatePack adds the pack to the catalog, false if a pack with the same hash is there already.
+func (p *Pack) CreatePack(ctx context.Context, pack *models.Pack) (bool, error) {
+	result, err := p.db.ExecContext(ctx, `INSERT INTO packs (hash, file_name, name, uploader_id, size, uploaded_at,
+		title, author, created, difficulty, rounds, themes, questions, images, audio, video)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16) ON CONFLICT (hash) DO NOTHING`,
+		pack.Hash,
+		pack.FileName,
+		pack.Name,
+		pack.UploaderID,
+		pack.Size,
+		pack.UploadedAt.UTC(),
+		pack.Title,
+		pack.Author,
+		pack.Created,
+		pack.Difficulty,
+		pack.Rounds,
+		pack.Themes,
+		pack.Questions,
+		pack.Images,
+		pack.Audio,
+		pack.Video,
+	)
+	if err != nil {
+		return false, errors.New("pack creation error")
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected != 0, nil
+}
+
+func (p *Pack) GetPack(ctx context.Context, hash models.PackHash) (*models.Pack, error) {
+	var pack models.Pack
+
+	err := p.db.GetContext(ctx, &pack, "SELECT "+packColumns+" FROM packs p LEFT JOIN users u ON u.id = p.uploader_id WHERE p.hash = $1", hash)
+	if err == sql.ErrNoRows {
+		return nil, ErrPackNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &pack, nil
+}
+
+// GetPacks returns the newest packs first, all of them when the limit is zero.
+func (p *Pack) GetPacks(ctx context.Context, limit int, offset int) ([]*models.Pack, error) {
+	packs := make([]*models.Pack, 0)
+
+	err := p.db.SelectContext(ctx, &packs, "SELECT "+packColumns+` FROM packs p LEFT JOIN users u ON u.id = p.uploader_id
+		ORDER BY p.uploaded_at DESC, p.hash LIMIT NULLIF($1, 0) OFFSET $2`, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	return packs, nil
+}
+
+func (p *Pack) CountPacks(ctx context.Context) (int, error) {
+	var count int
+
+	err := p.db.GetContext(ctx, &count, "SELECT count(*) FROM packs")
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (p *Pack) DeletePack(ctx context.Context, hash models.PackHash) error {
+	result, err := p.db.ExecContext(ctx, "DELETE FROM packs WHERE hash = $1", hash)
+	if err != nil {
+		return errors.New("delete pack error")
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrPackNotFound
+	}
+
+	return nil
+}
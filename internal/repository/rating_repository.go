@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"mygame/internal/models"
+	"mygame/tools/rating"
+	"time"
+)
+
+// Rating keeps the times in UTC, the columns are timestamps without time zone.
+type Rating struct {
+	db *sqlx.DB
+}
+
+func NewRatingRepository(db *sqlx.DB) *Rating {
+	return &Rating{
+		db: db,
+	}
+}
+
+// RateGame updates the ratings of the participants of the game in one transaction,
+// rate gets the current ratings and the scores in the order of participants and returns the new ratings.
+func (r *Rating) RateGame(ctx context.Context, gameID uint64, participants []*models.GameParticipant, ratedAt time.Time,
+	rate func(ratings []int, scores []int) []int) error {
+	ratedAt = ratedAt.UTC()
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	userIDs := make([]int64, 0, len(participants))
+	for _, participant := range participants {
+		userIDs = append(userIDs, int64(participant.UserID))
+	}
+
+	var current []struct {
+		UserID uint64 `db:"user_id"`
+		Rating int    `db:"rating"`
+	}
+
+	err = tx.SelectContext(ctx, &current, "SELECT user_id, rating FROM ratings WHERE user_id = ANY($1) FOR UPDATE", pq.Array(userIDs))
+	if err != nil {
+		return errors.New("get ratings error")
+	}
+
+	byUserID := make(map[uint64]int, len(current))
+	for _, c := range current {
+		byUserID[c.UserID] = c.Rating
+	}
+
+	ratings := make([]int, 0, len(participants))
+	scores := make([]int, 0, len(participants))
+	for _, participant := range participants {
+		before, ok := byUserID[participant.UserID]
+		if !ok {
+			before = rating.Initial
+		}
+
+		ratings = append(ratings, before)
+		scores = append(scores, participant.Score)
+	}
+
+	updated := rate(ratings, scores)
+
+	for i, participant := range participants {
+		_, err = tx.ExecContext(ctx, "INSERT INTO ratings (user_id, rating, games, updated_at) VALUES ($1,$2,1,$3) "+
+			"ON CONFLICT (user_id) DO UPDATE SET rating = EXCLUDED.rating, games = ratings.games + 1, updated_at = EXCLUDED.updated_at",
+			participant.UserID,
+			updated[i],
+			ratedAt,
+		)
+		if err != nil {
+			return errors.New("update rating error")
+		}
+
+		_, err = tx.ExecContext(ctx, "INSERT INTO rating_history (user_id, game_id, rating_before, rating_after, created_at) VALUES ($1,$2,$3,$4,$5)",
+			participant.UserID,
+			gameID,
+			ratings[i],
+			updated[i],
+			ratedAt,
+		)
+		if err != nil {
+			return errors.New("rating history creation error")
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetLeaderboard returns the current ratings, or the rating gained in the games matching the filter.
+func (r *Rating) GetLeaderboard(ctx context.Context, filter *models.LeaderboardFilter) ([]*models.Rating, error) {
+	leaderboard := make([]*models.Rating, 0)
+
+	var err error
+	if filter.Since == nil && filter.PackHash == nil {
+		err = r.db.SelectContext(ctx, &leaderboard, "SELECT r.user_id, u.login, r.rating, r.games "+
+			"FROM ratings r JOIN users u ON u.id = r.user_id "+
+			"ORDER BY r.rating DESC, r.user_id LIMIT $1 OFFSET $2", filter.Limit, filter.Offset)
+	} else {
+		var since *time.Time
+		if filter.Since != nil {
+			utc := filter.Since.UTC()
+			since = &utc
+		}
+
+		err = r.db.SelectContext(ctx, &leaderboard, "SELECT h.user_id, u.login, SUM(h.rating_after - h.rating_before) AS rating, COUNT(*) AS games "+
+			"FROM rating_history h JOIN users u ON u.id = h.user_id JOIN games g ON g.id = h.game_id "+
+			"WHERE ($1::timestamp IS NULL OR h.created_at >= $1) AND ($2::bytea IS NULL OR g.pack_hash = $2) "+
+			"GROUP BY h.user_id, u.login ORDER BY rating DESC, h.user_id LIMIT $3 OFFSET $4",
+			since, filter.PackHash, filter.Limit, filter.Offset)
+	}
+
+	if err != nil {
+		return nil, errors.New("get leaderboard error")
+	}
+
+	return leaderboard, nil
+}
+
+func (r *Rating) GetRating(ctx context.Context, userID uint64) (*models.Rating, error) {
+	var userRating models.Rating
+
+	err := r.db.GetContext(ctx, &userRating, "SELECT r.user_id, u.login, r.rating, r.games "+
+		"FROM ratings r JOIN users u ON u.id = r.user_id WHERE r.user_id = $1", userID)
+	if err != nil {
+		return nil, errors.New("rating not found")
+	}
+
+	return &userRating, nil
+}
+
+func (r *Rating) GetRatingHistory(ctx context.Context, userID uint64, limit int, offset int) ([]*models.RatingChange, error) {
+	history := make([]*models.RatingChange, 0)
+
+	err := r.db.SelectContext(ctx, &history, "SELECT game_id, rating_before, rating_after, created_at "+
+		"FROM rating_history WHERE user_id = $1 ORDER BY created_at DESC, game_id DESC LIMIT $2 OFFSET $3", userID, limit, offset)
+	if err != nil {
+		return nil, errors.New("get rating history error")
+	}
+
+	return history, nil
+}
@@ -4,22 +4,78 @@ import (
 	"context"
 	"github.com/jmoiron/sqlx"
 	"mygame/internal/models"
+	"time"
 )
 
 type UserRepository interface {
 	CreateUser(ctx context.Context, user *models.User) (uint64, error)
 	IsExistByLogin(ctx context.Context, login string) bool
-	GetUserByCredentials(ctx context.Context, credentials *models.Credentials) (uint64, error)
+	GetUserPasswordByLogin(ctx context.Context, login string) (uint64, string, error)
+	UpdateUserPassword(ctx context.Context, userID uint64, password string) error
 	GetUserByUserID(ctx context.Context, userID uint64) (*models.User, error)
 	GetUserIDByLogin(ctx context.Context, login string) (uint64, error)
+	CreateGuest(ctx context.Context, login string, createdAt time.Time) (uint64, error)
+	DeleteStaleGuests(ctx context.Context, createdBefore time.Time, now time.Time) (int64, error)
+	ConvertGuest(ctx context.Context, userID uint64, user *models.User) error
+	SetUserEmail(ctx context.Context, userID uint64, email string) error
+	GetUserEmail(ctx context.Context, userID uint64) (string, bool, error)
+	VerifyUserEmail(ctx context.Context, userID uint64, email string) error
+	GetUserIDByVerifiedEmail(ctx context.Context, email string) (uint64, error)
+	UpdateUserPhoto(ctx context.Context, userID uint64, photo string) error
+	GetUserPhoto(ctx context.Context, userID uint64) (string, error)
+	GetUserAccess(ctx context.Context, userID uint64) (string, bool, error)
+	GetUsers(ctx context.Context, filter *models.UserFilter) ([]*models.UserSummary, error)
+	BanUser(ctx context.Context, userID uint64, reason string, bannedAt time.Time) error
+	UnbanUser(ctx context.Context, userID uint64) error
+}
+
+type GameRepository interface {
+	SaveGame(ctx context.Context, game *models.GameResult) (uint64, error)
+	GetGamesByUserID(ctx context.Context, userID uint64, limit int, offset int) ([]*models.GameResult, error)
+	GetGameByID(ctx context.Context, id uint64) (*models.GameResult, error)
+}
+
+type RatingRepository interface {
+	RateGame(ctx context.Context, gameID uint64, participants []*models.GameParticipant, ratedAt time.Time,
+		rate func(ratings []int, scores []int) []int) error
+	GetLeaderboard(ctx context.Context, filter *models.LeaderboardFilter) ([]*models.Rating, error)
+	GetRating(ctx context.Context, userID uint64) (*models.Rating, error)
+	GetRatingHistory(ctx context.Context, userID uint64, limit int, offset int) ([]*models.RatingChange, error)
+}
+
+type TokenRepository interface {
+	CreateTokenFamily(ctx context.Context, family *models.TokenFamily, tokenHash []byte, expiresAt time.Time) error
+	RotateRefreshToken(ctx context.Context, tokenHash []byte, newTokenHash []byte, expiresAt time.Time, now time.Time) (*models.TokenFamily, error)
+	RevokeTokenFamily(ctx context.Context, familyID string, now time.Time) error
+	GetFamilyIDByRefreshToken(ctx context.Context, tokenHash []byte) (string, error)
+	IsTokenFamilyRevoked(ctx context.Context, familyID string) (bool, error)
+	RevokeUserTokenFamilies(ctx context.Context, userID uint64, now time.Time) error
+	CreateUserToken(ctx context.Context, token *models.UserToken, tokenHash []byte) error
+	UseUserToken(ctx context.Context, tokenHash []byte, purpose string, now time.Time) (*models.UserToken, error)
+}
+
+type PackRepository interface {
+	CreatePack(ctx context.Context, pack *models.Pack) (bool, error)
+	GetPack(ctx context.Context, hash models.PackHash) (*models.Pack, error)
+	GetPacks(ctx context.Context, limit int, offset int) ([]*models.Pack, error)
+	CountPacks(ctx context.Context) (int, error)
+	DeletePack(ctx context.Context, hash models.PackHash) error
 }
 
 type Repository struct {
-	UserRepository UserRepository
+	UserRepository   UserRepository
+	GameRepository   GameRepository
+	RatingRepository RatingRepository
+	TokenRepository  TokenRepository
+	PackRepository   PackRepository
 }
 
 func NewRepository(db *sqlx.DB) *Repository {
 	return &Repository{
-		UserRepository: NewUserRepository(db),
+		UserRepository:   NewUserRepository(db),
+		GameRepository:   NewGameRepository(db),
+		RatingRepository: NewRatingRepository(db),
+		TokenRepository:  NewTokenRepository(db),
+		PackRepository:   NewPackRepository(db),
 	}
 }
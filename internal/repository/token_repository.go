@@ -0,0 +1,252 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"mygame/internal/models"
+	"time"
+)
+
+var (
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	ErrRefreshTokenExpired  = errors.New("refresh token expired")
+	ErrRefreshTokenRevoked  = errors.New("refresh token revoked")
+	// The token has already been exchanged, so it has leaked and the whole family is revoked.
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+
+	ErrUserTokenInvalid = errors.New("token is invalid or expired")
+)
+
+// Token keeps the times in UTC, the columns are timestamps without time zone.
+type Token struct {
+	db *sqlx.DB
+}
+
+func NewTokenRepository(db *sqlx.DB) *Token {
+	return &Token{
+		db: db,
+	}
+}
+
+// CreateTokenFamily starts a session with its first refresh token.
+func (t *Token) CreateTokenFamily(ctx context.Context, family *models.TokenFamily, tokenHash []byte, expiresAt time.Time) error {
+	tx, err := t.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO token_families (id, user_id, login, created_at) VALUES ($1,$2,$3,$4)",
+		family.ID,
+		family.UserID,
+		family.Login,
+		family.CreatedAt.UTC(),
+	)
+	if err != nil {
+		return errors.New("token family creation error")
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO refresh_tokens (token_hash, family_id, expires_at, created_at) VALUES ($1,$2,$3,$4)",
+		tokenHash,
+		family.ID,
+		expiresAt.UTC(),
+		family.CreatedAt.UTC(),
+	)
+	if err != nil {
+		return errors.New("refresh token creation error")
+	}
+
+	return tx.Commit()
+}
+
+// RotateRefreshToken exchanges the refresh token for a new one of the same family.
+func (t *Token) RotateRefreshToken(ctx context.Context, tokenHash []byte, newTokenHash []byte, expiresAt time.Time, now time.Time) (*models.TokenFamily, error) {
+	expiresAt, now = expiresAt.UTC(), now.UTC()
+
+	tx, err := t.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	var token struct {
+		FamilyID  string     `db:"family_id"`
+		ExpiresAt time.Time  `db:"expires_at"`
+		UsedAt    *time.Time `db:"used_at"`
+	}
+
+	err = tx.GetContext(ctx, &token, "SELECT family_id, expires_at, used_at FROM refresh_tokens WHERE token_hash = $1 FOR UPDATE", tokenHash)
+	if err == sql.ErrNoRows {
+		return nil, ErrRefreshTokenNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var family models.TokenFamily
+
+	err = tx.GetContext(ctx, &family, "SELECT * FROM token_families WHERE id = $1 FOR UPDATE", token.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkRefreshToken(family.RevokedAt, token.UsedAt, token.ExpiresAt, now)
+	if err == ErrRefreshTokenReused {
+		_, err = tx.ExecContext(ctx, "UPDATE token_families SET revoked_at = $1 WHERE id = $2", now, family.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, ErrRefreshTokenReused
+	} else if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE refresh_tokens SET used_at = $1 WHERE token_hash = $2", now, tokenHash)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO refresh_tokens (token_hash, family_id, expires_at, created_at) VALUES ($1,$2,$3,$4)",
+		newTokenHash,
+		family.ID,
+		expiresAt,
+		now,
+	)
+	if err != nil {
+		return nil, errors.New("refresh token creation error")
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return &family, nil
+}
+
+// checkRefreshToken tells whether the refresh token may be exchanged at now, the family of a reused token
+// is revoked by the caller.
+func checkRefreshToken(revokedAt *time.Time, usedAt *time.Time, expiresAt time.Time, now time.Time) error {
+	if revokedAt != nil {
+		return ErrRefreshTokenRevoked
+	}
+
+	if usedAt != nil {
+		return ErrRefreshTokenReused
+	}
+
+	if !now.Before(expiresAt) {
+		return ErrRefreshTokenExpired
+	}
+
+	return nil
+}
+
+func (t *Token) RevokeTokenFamily(ctx context.Context, familyID string, now time.Time) error {
+	_, err := t.db.ExecContext(ctx, "UPDATE token_families SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL", now.UTC(), familyID)
+	if err != nil {
+		return errors.New("revoke token family error")
+	}
+
+	return nil
+}
+
+func (t *Token) GetFamilyIDByRefreshToken(ctx context.Context, tokenHash []byte) (string, error) {
+	var familyID string
+
+	err := t.db.GetContext(ctx, &familyID, "SELECT family_id FROM refresh_tokens WHERE token_hash = $1", tokenHash)
+	if err != nil {
+		return "", ErrRefreshTokenNotFound
+	}
+
+	return familyID, nil
+}
+
+func (t *Token) IsTokenFamilyRevoked(ctx context.Context, familyID string) (bool, error) {
+	var revoked bool
+
+	err := t.db.GetContext(ctx, &revoked, "SELECT revoked_at IS NOT NULL FROM token_families WHERE id = $1", familyID)
+	if err == sql.ErrNoRows {
+		// a session nobody knows about cannot be trusted
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return revoked, nil
+}
+
+// RevokeUserTokenFamilies ends all sessions of the user.
+func (t *Token) RevokeUserTokenFamilies(ctx context.Context, userID uint64, now time.Time) error {
+	_, err := t.db.ExecContext(ctx, "UPDATE token_families SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL", now.UTC(), userID)
+	if err != nil {
+		return errors.New("revoke token families error")
+	}
+
+	return nil
+}
+
+func (t *Token) CreateUserToken(ctx context.Context, token *models.UserToken, tokenHash []byte) error {
+	_, err := t.db.ExecContext(ctx, `INSERT INTO user_tokens (token_hash, user_id, purpose, email, expires_at, created_at)
+		VALUES ($1,$2,$3,NULLIF($4,''),$5,$6)`,
+		tokenHash,
+		token.UserID,
+		token.Purpose,
+		token.Email,
+		token.ExpiresAt.UTC(),
+		token.CreatedAt.UTC(),
+	)
+	if err != nil {
+		return errors.New("user token creation error")
+	}
+
+	return nil
+}
+
+// UseUserToken consumes the token together with every other unused token of the same purpose issued to the user.
+func (t *Token) UseUserToken(ctx context.Context, tokenHash []byte, purpose string, now time.Time) (*models.UserToken, error) {
+	now = now.UTC()
+
+	tx, err := t.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	var token models.UserToken
+
+	err = tx.GetContext(ctx, &token, `SELECT user_id, purpose, COALESCE(email, '') AS email, expires_at, used_at, created_at
+		FROM user_tokens WHERE token_hash = $1 AND purpose = $2 FOR UPDATE`, tokenHash, purpose)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserTokenInvalid
+	} else if err != nil {
+		return nil, err
+	}
+
+	if token.UsedAt != nil || !now.Before(token.ExpiresAt) {
+		return nil, ErrUserTokenInvalid
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE user_tokens SET used_at = $1 WHERE user_id = $2 AND purpose = $3 AND used_at IS NULL",
+		now, token.UserID, purpose)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckRefreshToken(t *testing.T) {
+	now := time.Date(2021, 12, 1, 12, 0, 0, 0, time.UTC)
+	before := now.Add(-time.Minute)
+
+	tests := []struct {
+		name      string
+		revokedAt *time.Time
+		usedAt    *time.Time
+		expiresAt time.Time
+		// now when zero
+		at   time.Time
+		want error
+	}{
+		{name: "fresh", expiresAt: now.Add(time.Hour)},
+		{name: "expired", expiresAt: now, want: ErrRefreshTokenExpired},
+		{name: "reused", usedAt: &before, expiresAt: now.Add(time.Hour), want: ErrRefreshTokenReused},
+		// a reused token of an ended session is not reported again
+		{name: "revoked", revokedAt: &before, usedAt: &before, expiresAt: now.Add(time.Hour), want: ErrRefreshTokenRevoked},
+		{name: "revoked and expired", revokedAt: &before, expiresAt: before, want: ErrRefreshTokenRevoked},
+		// the column has no time zone, so the time read back is UTC while now may be local
+		{name: "local now", expiresAt: now.Add(time.Minute), at: now.In(time.FixedZone("MSK", 3*60*60))},
+	}
+
+	for _, test := range tests {
+		at := test.at
+		if at.IsZero() {
+			at = now
+		}
+
+		if err := checkRefreshToken(test.revokedAt, test.usedAt, test.expiresAt, at); err != test.want {
+			t.Errorf("%s: error is %v, want %v", test.name, err, test.want)
+		}
+	}
+}
@@ -2,11 +2,29 @@ package repository
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"mygame/internal/models"
+	"time"
 )
 
+const (
+	// Code of the unique violation error of PostgreSQL.
+	uniqueViolation = "23505"
+
+	emailIndex = "users_email_uindex"
+)
+
+var (
+	ErrLoginTaken   = errors.New("login is already taken")
+	ErrEmailTaken   = errors.New("email is already taken")
+	ErrUserNotGuest = errors.New("user is not a guest")
+	ErrUserNotFound = errors.New("user not found")
+)
+
+// User keeps the times in UTC, the columns are timestamps without time zone.
 type User struct {
 	db *sqlx.DB
 }
@@ -32,25 +50,36 @@ func (u *User) IsExistByLogin(ctx context.Context, login string) bool {
 	return true
 }
 
-func (u *User) GetUserByCredentials(ctx context.Context, credentials *models.Credentials) (uint64, error) {
-	var id uint64
+// GetUserPasswordByLogin returns the user ID with the stored password hash, the password is checked by the caller.
+func (u *User) GetUserPasswordByLogin(ctx context.Context, login string) (uint64, string, error) {
+	var user struct {
+		ID       uint64 `db:"id"`
+		Password string `db:"password"`
+	}
 
-	err := u.db.GetContext(ctx, &id, "SELECT id FROM users WHERE login = $1 AND password = $2", credentials.Login, credentials.Password)
+	err := u.db.GetContext(ctx, &user, "SELECT id, password FROM users WHERE login = $1 AND NOT guest", login)
 	if err != nil {
-		return 0, errors.New("login or password incorrect")
+		return 0, "", errors.New("user not found")
 	}
 
-	if id == 0 {
-		return 0, errors.New("user not found")
+	return user.ID, user.Password, nil
+}
+
+func (u *User) UpdateUserPassword(ctx context.Context, userID uint64, password string) error {
+	_, err := u.db.ExecContext(ctx, "UPDATE users SET password = $1 WHERE id = $2", password, userID)
+	if err != nil {
+		return errors.New("update password error")
 	}
 
-	return id, nil
+	return nil
 }
 
 func (u *User) GetUserByUserID(ctx context.Context, userID uint64) (*models.User, error) {
 	var user models.User
 
-	err := u.db.GetContext(ctx, &user, "SELECT * FROM users WHERE id = $1", userID)
+	// the columns of models.User only, the table has more of them
+	err := u.db.GetContext(ctx, &user, `SELECT COALESCE(login, '') AS login, COALESCE(password, '') AS password,
+		COALESCE(photo, '') AS photo, guest, COALESCE(email, '') AS email, email_verified FROM users WHERE id = $1`, userID)
 	if err != nil {
 		return nil, errors.New("user not found")
 	}
@@ -61,12 +90,15 @@ func (u *User) GetUserByUserID(ctx context.Context, userID uint64) (*models.User
 func (u *User) CreateUser(ctx context.Context, user *models.User) (uint64, error) {
 	var id uint64
 
-	err := u.db.QueryRowContext(ctx, "INSERT INTO users (login, password, photo) VALUES ($1,$2,$3) RETURNING id",
+	err := u.db.QueryRowContext(ctx, "INSERT INTO users (login, password, photo, email) VALUES ($1,$2,$3,NULLIF($4,'')) RETURNING id",
 		user.Login,
 		user.Password,
 		user.Photo,
+		user.Email,
 	).Scan(&id)
-	if err != nil {
+	if isUniqueViolation(err) {
+		return 0, uniqueViolationError(err)
+	} else if err != nil {
 		return 0, errors.New("user creation error")
 	}
 
@@ -87,3 +119,231 @@ func (u *User) GetUserIDByLogin(ctx context.Context, login string) (uint64, erro
 
 	return id, nil
 }
+
+// CreateGuest persists a guest identity, the login has to be unique among guests and registered users.
+func (u *User) CreateGuest(ctx context.Context, login string, createdAt time.Time) (uint64, error) {
+	var id uint64
+
+	err := u.db.QueryRowContext(ctx, "INSERT INTO users (login, guest, created_at) VALUES ($1,true,$2) RETURNING id",
+		login, createdAt.UTC()).Scan(&id)
+	if isUniqueViolation(err) {
+		return 0, ErrLoginTaken
+	} else if err != nil {
+		return 0, errors.New("guest creation error")
+	}
+
+	return id, nil
+}
+
+// DeleteStaleGuests deletes the guests created before createdBefore who have played no game and hold
+// no refresh token that is still good at now, so nobody can sign in as them any more. Their token families go too.
+func (u *User) DeleteStaleGuests(ctx context.Context, createdBefore time.Time, now time.Time) (int64, error) {
+	var deleted int64
+
+	err := u.db.GetContext(ctx, &deleted, `WITH stale AS (
+			DELETE FROM users
+			WHERE guest AND created_at < $1
+				AND NOT EXISTS (SELECT 1 FROM game_participants p WHERE p.user_id = users.id)
+				AND NOT EXISTS (SELECT 1 FROM token_families f JOIN refresh_tokens t ON t.family_id = f.id
+					WHERE f.user_id = users.id AND f.revoked_at IS NULL AND t.used_at IS NULL AND t.expires_at > $2)
+			RETURNING id
+		), families AS (
+			DELETE FROM token_families WHERE user_id IN (SELECT id FROM stale)
+		)
+		SELECT count(*) FROM stale`,
+		createdBefore.UTC(), now.UTC())
+	if err != nil {
+		return 0, errors.New("delete stale guests error")
+	}
+
+	return deleted, nil
+}
+
+// ConvertGuest turns the guest into a registered user, the user ID and so the games and ratings stay the same.
+func (u *User) ConvertGuest(ctx context.Context, userID uint64, user *models.User) error {
+	result, err := u.db.ExecContext(ctx, `UPDATE users SET login = $1, password = $2, photo = $3, email = NULLIF($4,''), guest = false
+		WHERE id = $5 AND guest`,
+		user.Login,
+		user.Password,
+		user.Photo,
+		user.Email,
+		userID,
+	)
+	if isUniqueViolation(err) {
+		return uniqueViolationError(err)
+	} else if err != nil {
+		return errors.New("guest conversion error")
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrUserNotGuest
+	}
+
+	return nil
+}
+
+// SetUserEmail replaces the email of the user, a new email has to be verified again.
+func (u *User) SetUserEmail(ctx context.Context, userID uint64, email string) error {
+	_, err := u.db.ExecContext(ctx, `UPDATE users SET email = $1, email_verified = email_verified AND lower(email) = lower($1)
+		WHERE id = $2`, email, userID)
+	if isUniqueViolation(err) {
+		return ErrEmailTaken
+	} else if err != nil {
+		return errors.New("update email error")
+	}
+
+	return nil
+}
+
+func (u *User) GetUserEmail(ctx context.Context, userID uint64) (string, bool, error) {
+	var user struct {
+		Email         string `db:"email"`
+		EmailVerified bool   `db:"email_verified"`
+	}
+
+	err := u.db.GetContext(ctx, &user, "SELECT COALESCE(email, '') AS email, email_verified FROM users WHERE id = $1", userID)
+	if err != nil {
+		return "", false, errors.New("user not found")
+	}
+
+	return user.Email, user.EmailVerified, nil
+}
+
+// VerifyUserEmail marks the email verified unless the user has changed it since the verification was sent.
+func (u *User) VerifyUserEmail(ctx context.Context, userID uint64, email string) error {
+	result, err := u.db.ExecContext(ctx, "UPDATE users SET email_verified = true WHERE id = $1 AND lower(email) = lower($2)", userID, email)
+	if err != nil {
+		return errors.New("verify email error")
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return errors.New("email has changed")
+	}
+
+	return nil
+}
+
+func (u *User) GetUserIDByVerifiedEmail(ctx context.Context, email string) (uint64, error) {
+	var id uint64
+
+	err := u.db.GetContext(ctx, &id, "SELECT id FROM users WHERE lower(email) = lower($1) AND email_verified", email)
+	if err != nil {
+		return 0, errors.New("user not found")
+	}
+
+	return id, nil
+}
+
+func (u *User) UpdateUserPhoto(ctx context.Context, userID uint64, photo string) error {
+	_, err := u.db.ExecContext(ctx, "UPDATE users SET photo = $1 WHERE id = $2", photo, userID)
+	if err != nil {
+		return errors.New("update photo error")
+	}
+
+	return nil
+}
+
+// GetUserPhoto returns the avatar UID of the user, empty if there is none.
+func (u *User) GetUserPhoto(ctx context.Context, userID uint64) (string, error) {
+	var photo string
+
+	err := u.db.GetContext(ctx, &photo, "SELECT COALESCE(photo, '') FROM users WHERE id = $1", userID)
+	if err != nil {
+		return "", errors.New("user not found")
+	}
+
+	return photo, nil
+}
+
+// GetUserAccess returns the role of the user and whether the user is banned.
+func (u *User) GetUserAccess(ctx context.Context, userID uint64) (string, bool, error) {
+	var user struct {
+		Role   string `db:"role"`
+		Banned bool   `db:"banned"`
+	}
+
+	err := u.db.GetContext(ctx, &user, "SELECT role, banned_at IS NOT NULL AS banned FROM users WHERE id = $1", userID)
+	if err != nil {
+		return "", false, errors.New("user not found")
+	}
+
+	return user.Role, user.Banned, nil
+}
+
+func (u *User) GetUsers(ctx context.Context, filter *models.UserFilter) ([]*models.UserSummary, error) {
+	users := make([]*models.UserSummary, 0)
+
+	err := u.db.SelectContext(ctx, &users, `SELECT id, login, COALESCE(email, '') AS email, role, guest, banned_at,
+		COALESCE(ban_reason, '') AS ban_reason
+		FROM users
+		WHERE ($1 = '' OR strpos(lower(login), lower($1)) > 0)
+			AND ($2::boolean IS NULL OR (banned_at IS NOT NULL) = $2)
+		ORDER BY id
+		LIMIT $3 OFFSET $4`,
+		filter.Login,
+		filter.Banned,
+		filter.Limit,
+		filter.Offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+func (u *User) BanUser(ctx context.Context, userID uint64, reason string, bannedAt time.Time) error {
+	result, err := u.db.ExecContext(ctx, "UPDATE users SET banned_at = $1, ban_reason = $2 WHERE id = $3", bannedAt.UTC(), reason, userID)
+	if err != nil {
+		return errors.New("ban user error")
+	}
+
+	return expectAffected(result)
+}
+
+func (u *User) UnbanUser(ctx context.Context, userID uint64) error {
+	result, err := u.db.ExecContext(ctx, "UPDATE users SET banned_at = NULL, ban_reason = NULL WHERE id = $1", userID)
+	if err != nil {
+		return errors.New("unban user error")
+	}
+
+	return expectAffected(result)
+}
+
+func expectAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+func isUniqueViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+
+	return ok && pqErr.Code == uniqueViolation
+}
+
+// uniqueViolationError tells which of the unique columns is taken.
+func uniqueViolationError(err error) error {
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Constraint == emailIndex {
+		return ErrEmailTaken
+	}
+
+	return ErrLoginTaken
+}
@@ -5,41 +5,71 @@ import "sync"
 var packTemporarySingleton *PackTemporarySingleton
 
 type PackTemporarySingleton struct {
-	packs map[[32]byte]int
-	sync.RWMutex
+	packs map[[32]byte]*temporaryPack
+	sync.Mutex
+}
+
+// temporaryPack counts the hubs playing the unpacked copy of a pack, its lock is held
+// while the copy is unpacked or removed so that no hub sees it half done.
+// The entries are kept for the packs played since the start, there are as many as packs in the catalog at most.
+type temporaryPack struct {
+	count int
+	sync.Mutex
 }
 
 func initPackTemporarySingleton() {
 	packTemporarySingleton = &PackTemporarySingleton{
-		packs: make(map[[32]byte]int),
+		packs: make(map[[32]byte]*temporaryPack),
 	}
 }
 
-func IncTemporaryPack(packHash [32]byte) {
+func temporaryPackOf(packHash [32]byte) *temporaryPack {
 	packTemporarySingleton.Lock()
-	packTemporarySingleton.packs[packHash]++
-	packTemporarySingleton.Unlock()
+	defer packTemporarySingleton.Unlock()
+
+	pack, ok := packTemporarySingleton.packs[packHash]
+	if !ok {
+		pack = &temporaryPack{}
+		packTemporarySingleton.packs[packHash] = pack
+	}
+
+	return pack
 }
 
-func DegTemporaryPack(packHash [32]byte) {
-	packTemporarySingleton.Lock()
-	packTemporarySingleton.packs[packHash]--
+// AcquireTemporaryPack counts one more hub playing the pack, the first one unpacks it.
+// The hub is not counted when unpacking fails.
+func AcquireTemporaryPack(packHash [32]byte, unpack func() error) error {
+	pack := temporaryPackOf(packHash)
 
-	if packTemporarySingleton.packs[packHash] == 0 {
-		delete(packTemporarySingleton.packs, packHash)
+	pack.Lock()
+	defer pack.Unlock()
+
+	if pack.count == 0 {
+		if err := unpack(); err != nil {
+			return err
+		}
 	}
 
-	packTemporarySingleton.Unlock()
+	pack.count++
+
+	return nil
 }
 
-func IsExistemporaryPack(packHash [32]byte) bool {
-	packTemporarySingleton.RLock()
-	defer packTemporarySingleton.RUnlock()
+// ReleaseTemporaryPack counts one hub less playing the pack, the last one removes it.
+func ReleaseTemporaryPack(packHash [32]byte, remove func() error) error {
+	pack := temporaryPackOf(packHash)
+
+	pack.Lock()
+	defer pack.Unlock()
+
+	if pack.count == 0 {
+		return nil
+	}
 
-	count, ok := packTemporarySingleton.packs[packHash]
-	if !ok || count == 0 {
-		return false
+	pack.count--
+	if pack.count > 0 {
+		return nil
 	}
 
-	return true
+	return remove()
 }
@@ -0,0 +1,103 @@
+package singleton
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestTemporaryPackUnpacksOnceAndRemovesOnLastRelease(t *testing.T) {
+	initPackTemporarySingleton()
+
+	hash := [32]byte{1}
+
+	var mutex sync.Mutex
+	unpacked, removed := 0, 0
+
+	unpack := func() error {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if unpacked != removed {
+			t.Error("pack is unpacked over a copy in use")
+		}
+
+		unpacked++
+
+		return nil
+	}
+	remove := func() error {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		removed++
+
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if err := AcquireTemporaryPack(hash, unpack); err != nil {
+				t.Error(err)
+
+				return
+			}
+
+			if err := ReleaseTemporaryPack(hash, remove); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if unpacked == 0 || unpacked != removed {
+		t.Fatalf("pack is unpacked %d times and removed %d times", unpacked, removed)
+	}
+
+	if err := AcquireTemporaryPack(hash, unpack); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := AcquireTemporaryPack(hash, unpack); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ReleaseTemporaryPack(hash, remove); err != nil {
+		t.Fatal(err)
+	}
+
+	if unpacked != removed+1 {
+		t.Fatal("pack is removed while a hub still plays it")
+	}
+}
+
+func TestTemporaryPackIsNotCountedWhenUnpackFails(t *testing.T) {
+	initPackTemporarySingleton()
+
+	hash := [32]byte{2}
+	errUnzip := errors.New("unzip error")
+
+	err := AcquireTemporaryPack(hash, func() error {
+		return errUnzip
+	})
+	if err != errUnzip {
+		t.Fatalf("error is %v, want %v", err, errUnzip)
+	}
+
+	unpacked := false
+
+	err = AcquireTemporaryPack(hash, func() error {
+		unpacked = true
+
+		return nil
+	})
+	if err != nil || !unpacked {
+		t.Fatal("next hub does not unpack the pack again")
+	}
+}
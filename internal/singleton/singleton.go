@@ -1,6 +1,5 @@
 package singleton
 
 func InitSingleton() {
-	initPackSingleton()
 	initPackTemporarySingleton()
 }
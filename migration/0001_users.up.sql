@@ -8,3 +8,5 @@ create table users
     photo text
 );
 
+create unique index users_login_uindex
+    on users (login);
@@ -0,0 +1,5 @@
+drop table game_questions;
+
+drop table game_participants;
+
+drop table games;
@@ -0,0 +1,49 @@
+create table games
+(
+    id serial not null
+        constraint games_pk
+            primary key,
+    hub_name varchar(64),
+    pack_hash bytea,
+    pack_name text,
+    leader_id integer not null default 0,
+    leader_login varchar(32),
+    started_at timestamp not null,
+    finished_at timestamp not null,
+    end_reason varchar(16) not null
+);
+
+create table game_participants
+(
+    game_id integer not null
+        constraint game_participants_games_id_fk
+            references games
+                on delete cascade,
+    queue_id integer not null,
+    user_id integer not null default 0,
+    nickname varchar(32),
+    score integer not null,
+    constraint game_participants_pk
+        primary key (game_id, queue_id)
+);
+
+create index game_participants_user_id_index
+    on game_participants (user_id);
+
+create table game_questions
+(
+    game_id integer not null
+        constraint game_questions_games_id_fk
+            references games
+                on delete cascade,
+    round integer not null,
+    theme_id integer not null,
+    question_id integer not null,
+    queue_id integer not null,
+    price integer not null,
+    correct boolean not null,
+    answered_at timestamp not null
+);
+
+create index game_questions_game_id_index
+    on game_questions (game_id);
@@ -0,0 +1,3 @@
+drop table rating_history;
+
+drop table ratings;
@@ -0,0 +1,35 @@
+create table ratings
+(
+    user_id integer not null
+        constraint ratings_pk
+            primary key
+        constraint ratings_users_id_fk
+            references users
+                on delete cascade,
+    rating integer not null,
+    games integer not null default 0,
+    updated_at timestamp not null
+);
+
+create index ratings_rating_index
+    on ratings (rating desc);
+
+create table rating_history
+(
+    user_id integer not null
+        constraint rating_history_users_id_fk
+            references users
+                on delete cascade,
+    game_id integer not null
+        constraint rating_history_games_id_fk
+            references games
+                on delete cascade,
+    rating_before integer not null,
+    rating_after integer not null,
+    created_at timestamp not null,
+    constraint rating_history_pk
+        primary key (user_id, game_id)
+);
+
+create index rating_history_created_at_index
+    on rating_history (created_at);
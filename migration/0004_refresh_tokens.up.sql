@@ -0,0 +1,27 @@
+create table token_families
+(
+    id varchar(32) not null
+        constraint token_families_pk
+            primary key,
+    user_id integer not null default 0,
+    login varchar(32) not null,
+    created_at timestamp not null,
+    revoked_at timestamp
+);
+
+create table refresh_tokens
+(
+    token_hash bytea not null
+        constraint refresh_tokens_pk
+            primary key,
+    family_id varchar(32) not null
+        constraint refresh_tokens_token_families_id_fk
+            references token_families
+                on delete cascade,
+    expires_at timestamp not null,
+    used_at timestamp,
+    created_at timestamp not null
+);
+
+create index refresh_tokens_family_id_index
+    on refresh_tokens (family_id);
@@ -0,0 +1,5 @@
+delete from users
+    where guest;
+
+alter table users
+    drop column guest;
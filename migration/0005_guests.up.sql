@@ -0,0 +1,2 @@
+alter table users
+    add guest boolean not null default false;
@@ -0,0 +1,9 @@
+drop table user_tokens;
+
+drop index users_email_uindex;
+
+alter table users
+    drop column email_verified;
+
+alter table users
+    drop column email;
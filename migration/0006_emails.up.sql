@@ -0,0 +1,27 @@
+alter table users
+    add email varchar(255);
+
+alter table users
+    add email_verified boolean not null default false;
+
+create unique index users_email_uindex
+    on users (lower(email));
+
+create table user_tokens
+(
+    token_hash bytea not null
+        constraint user_tokens_pk
+            primary key,
+    user_id integer not null
+        constraint user_tokens_users_id_fk
+            references users
+                on delete cascade,
+    purpose varchar(16) not null,
+    email varchar(255),
+    expires_at timestamp not null,
+    used_at timestamp,
+    created_at timestamp not null
+);
+
+create index user_tokens_user_id_index
+    on user_tokens (user_id);
@@ -0,0 +1,8 @@
+alter table users
+    drop column ban_reason;
+
+alter table users
+    drop column banned_at;
+
+alter table users
+    drop column role;
@@ -0,0 +1,8 @@
+alter table users
+    add role varchar(16) not null default 'user';
+
+alter table users
+    add banned_at timestamp;
+
+alter table users
+    add ban_reason text;
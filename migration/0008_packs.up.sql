@@ -0,0 +1,24 @@
+create table packs
+(
+    hash bytea not null
+        constraint packs_pk
+            primary key,
+    file_name text not null,
+    name text not null,
+    uploader_id integer not null default 0,
+    size bigint not null,
+    uploaded_at timestamp not null,
+    title text not null default '',
+    author text not null default '',
+    created text not null default '',
+    difficulty integer not null default 0,
+    rounds integer not null default 0,
+    themes integer not null default 0,
+    questions integer not null default 0,
+    images integer not null default 0,
+    audio integer not null default 0,
+    video integer not null default 0
+);
+
+create index packs_uploaded_at_index
+    on packs (uploaded_at desc);
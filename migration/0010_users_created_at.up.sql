@@ -0,0 +1,2 @@
+alter table users
+    add created_at timestamp not null default (now() at time zone 'utc');
@@ -0,0 +1,10 @@
+// Package migration embeds the SQL migrations of the database.
+//
+// Every migration is a pair of files named {version}_{name}.up.sql and {version}_{name}.down.sql,
+// versions are applied in ascending order.
+package migration
+
+import "embed"
+
+//go:embed *.sql
+var Files embed.FS
@@ -0,0 +1,109 @@
+package avatar
+
+import (
+	"bytes"
+	"errors"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+	"image"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+)
+
+const (
+	MB = 1 << 20
+
+	MaxSize = 5 * MB
+
+	// Limits of the uploaded image, checked before it is decoded.
+	MaxDimension = 4096
+	MinDimension = 32
+)
+
+// Sizes of the stored square thumbnails, the first one is the default.
+var Sizes = []int{256, 64}
+
+var (
+	ErrUnsupportedFormat = errors.New("avatar must be a png, jpeg or webp image")
+	ErrTooLarge          = errors.New("avatar is too large")
+	ErrTooSmall          = errors.New("avatar is too small")
+)
+
+var formats = map[string]bool{
+	"png":  true,
+	"jpeg": true,
+	"webp": true,
+}
+
+// Thumbnails decodes the image and re-encodes it as PNG square thumbnails of every size,
+// so that nothing but pixels of the upload is ever served.
+func Thumbnails(data []byte) (map[int][]byte, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || !formats[format] {
+		return nil, ErrUnsupportedFormat
+	}
+
+	if config.Width > MaxDimension || config.Height > MaxDimension {
+		return nil, ErrTooLarge
+	}
+
+	if config.Width < MinDimension || config.Height < MinDimension {
+		return nil, ErrTooSmall
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+
+	square := centerSquare(img.Bounds())
+
+	thumbnails := make(map[int][]byte, len(Sizes))
+	for _, size := range Sizes {
+		thumbnail := image.NewNRGBA(image.Rect(0, 0, size, size))
+
+		draw.CatmullRom.Scale(thumbnail, thumbnail.Bounds(), img, square, draw.Src, nil)
+
+		var buf bytes.Buffer
+
+		err = png.Encode(&buf, thumbnail)
+		if err != nil {
+			return nil, err
+		}
+
+		thumbnails[size] = buf.Bytes()
+	}
+
+	return thumbnails, nil
+}
+
+// centerSquare crops the bounds to the largest square in the middle.
+func centerSquare(bounds image.Rectangle) image.Rectangle {
+	side := bounds.Dx()
+	if bounds.Dy() < side {
+		side = bounds.Dy()
+	}
+
+	min := image.Point{
+		X: bounds.Min.X + (bounds.Dx()-side)/2,
+		Y: bounds.Min.Y + (bounds.Dy()-side)/2,
+	}
+
+	return image.Rectangle{Min: min, Max: min.Add(image.Point{X: side, Y: side})}
+}
+
+// Read reads the upload, failing with ErrTooLarge past MaxSize.
+func Read(r io.Reader) ([]byte, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, MaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > MaxSize {
+		return nil, ErrTooLarge
+	}
+
+	return data, nil
+}
@@ -0,0 +1,98 @@
+package avatar
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+var ErrNotFound = errors.New("avatar not found")
+
+// Store keeps thumbnails under the hash of the largest one, so the same picture is stored once
+// and a stored file never changes.
+type Store struct {
+	dir string
+}
+
+func NewStore(dir string) *Store {
+	return &Store{
+		dir: dir,
+	}
+}
+
+// Save stores the thumbnails and returns their UID.
+func (s *Store) Save(thumbnails map[int][]byte) (string, error) {
+	hash := sha256.Sum256(thumbnails[Sizes[0]])
+	uid := hex.EncodeToString(hash[:])
+
+	dir := filepath.Join(s.dir, uid[:2])
+
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	for size, data := range thumbnails {
+		path := s.path(uid, size)
+
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+
+		// written aside and renamed so that a half written file is never served
+		tmp, err := ioutil.TempFile(dir, uid+"-*.tmp")
+		if err != nil {
+			return "", err
+		}
+
+		_, err = tmp.Write(data)
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+
+		if err == nil {
+			err = os.Rename(tmp.Name(), path)
+		}
+
+		if err != nil {
+			os.Remove(tmp.Name())
+
+			return "", err
+		}
+	}
+
+	return uid, nil
+}
+
+// Open opens the thumbnail of the size.
+func (s *Store) Open(uid string, size int) (*os.File, error) {
+	if !ValidUID(uid) {
+		return nil, ErrNotFound
+	}
+
+	file, err := os.Open(s.path(uid, size))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+
+	return file, err
+}
+
+func (s *Store) path(uid string, size int) string {
+	return filepath.Join(s.dir, uid[:2], uid+"-"+strconv.Itoa(size)+".png")
+}
+
+// ValidUID reports whether the UID is a hex SHA-256 digest, anything else never reaches the file system.
+func ValidUID(uid string) bool {
+	if len(uid) != sha256.Size*2 {
+		return false
+	}
+
+	digest, err := hex.DecodeString(uid)
+
+	return err == nil && hex.EncodeToString(digest) == uid
+}
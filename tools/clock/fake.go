@@ -0,0 +1,150 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Fake is a virtual clock, time only moves when Advance is called.
+type Fake struct {
+	sync.Mutex
+	now time.Time
+	// Timers waiting to fire, stopped and fired ones are dropped.
+	timers map[*fakeTimer]bool
+	// Fired timers, kept until their values are received.
+	fired map[*fakeTimer]bool
+}
+
+func NewFake(now time.Time) *Fake {
+	return &Fake{
+		now:    now,
+		timers: make(map[*fakeTimer]bool),
+		fired:  make(map[*fakeTimer]bool),
+	}
+}
+
+func (f *Fake) Now() time.Time {
+	f.Lock()
+	defer f.Unlock()
+
+	return f.now
+}
+
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	f.Lock()
+	defer f.Unlock()
+
+	timer := &fakeTimer{
+		clock:    f,
+		c:        make(chan time.Time, 1),
+		deadline: f.now.Add(d),
+		active:   true,
+	}
+
+	f.timers[timer] = true
+
+	timer.fireIfDue()
+
+	return timer
+}
+
+// Advance moves the clock forward and fires the timers that are due.
+func (f *Fake) Advance(d time.Duration) {
+	f.Lock()
+	defer f.Unlock()
+
+	f.now = f.now.Add(d)
+
+	for timer := range f.timers {
+		timer.fireIfDue()
+	}
+}
+
+// Fired reports whether a timer has fired and its value is not received yet,
+// tests wait for it to turn false to know that the fired timers are taken care of.
+func (f *Fake) Fired() bool {
+	f.Lock()
+	defer f.Unlock()
+
+	for timer := range f.fired {
+		if len(timer.c) == 0 {
+			delete(f.fired, timer)
+		}
+	}
+
+	return len(f.fired) != 0
+}
+
+// Timers returns the number of timers waiting to fire.
+func (f *Fake) Timers() int {
+	f.Lock()
+	defer f.Unlock()
+
+	return len(f.timers)
+}
+
+// AdvanceTo moves the clock forward to the given time, the clock never goes back.
+func (f *Fake) AdvanceTo(t time.Time) {
+	d := t.Sub(f.Now())
+	if d < 0 {
+		d = 0
+	}
+
+	f.Advance(d)
+}
+
+type fakeTimer struct {
+	clock    *Fake
+	c        chan time.Time
+	deadline time.Time
+	active   bool
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.Lock()
+	defer t.clock.Unlock()
+
+	active := t.active
+	t.active = false
+
+	delete(t.clock.timers, t)
+	delete(t.clock.fired, t)
+
+	return active
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.Lock()
+	defer t.clock.Unlock()
+
+	active := t.active
+	t.active = true
+	t.deadline = t.clock.now.Add(d)
+
+	t.clock.timers[t] = true
+
+	t.fireIfDue()
+
+	return active
+}
+
+// fireIfDue must be called with the clock locked.
+func (t *fakeTimer) fireIfDue() {
+	if !t.active || t.deadline.After(t.clock.now) {
+		return
+	}
+
+	t.active = false
+
+	delete(t.clock.timers, t)
+
+	select {
+	case t.c <- t.clock.now:
+		t.clock.fired[t] = true
+	default:
+	}
+}
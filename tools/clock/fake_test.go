@@ -0,0 +1,76 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeFiresDueTimers(t *testing.T) {
+	fake := NewFake(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	timer := fake.NewTimer(time.Minute)
+
+	fake.Advance(59 * time.Second)
+
+	select {
+	case <-timer.C():
+		t.Fatal("timer fired before its deadline")
+	default:
+	}
+
+	fake.Advance(time.Second)
+
+	if !fake.Fired() {
+		t.Fatal("fired timer is not reported")
+	}
+
+	select {
+	case now := <-timer.C():
+		if !now.Equal(fake.Now()) {
+			t.Fatalf("timer fired at %v, want %v", now, fake.Now())
+		}
+	default:
+		t.Fatal("timer has not fired at its deadline")
+	}
+
+	if fake.Fired() {
+		t.Fatal("received timer is still reported as fired")
+	}
+}
+
+func TestFakeDropsStoppedAndFiredTimers(t *testing.T) {
+	fake := NewFake(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	for i := 0; i < 100; i++ {
+		timer := fake.NewTimer(time.Minute)
+		timer.Stop()
+	}
+
+	if n := fake.Timers(); n != 0 {
+		t.Fatalf("%d stopped timers are kept", n)
+	}
+
+	timer := fake.NewTimer(time.Second)
+	fake.Advance(time.Second)
+	<-timer.C()
+
+	if n := fake.Timers(); n != 0 {
+		t.Fatalf("%d fired timers are kept", n)
+	}
+
+	if timer.Reset(time.Second) {
+		t.Fatal("reset of a fired timer reports it active")
+	}
+
+	if n := fake.Timers(); n != 1 {
+		t.Fatalf("reset timer is not waiting, %d timers", n)
+	}
+
+	if !timer.Stop() {
+		t.Fatal("stop of a waiting timer reports it inactive")
+	}
+
+	if n := fake.Timers(); n != 0 {
+		t.Fatalf("%d stopped timers are kept", n)
+	}
+}
@@ -0,0 +1,37 @@
+package helpers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"math/big"
+)
+
+// Letters and digits that cannot be confused with each other when read aloud or typed.
+var codeRunes = []rune("ABCDEFGHJKLMNPQRSTUVWXYZ23456789")
+
+// GenerateCode returns a random code of n characters from a cryptographically secure source.
+func GenerateCode(n int) (string, error) {
+	b := make([]rune, n)
+	for i := range b {
+		index, err := rand.Int(rand.Reader, big.NewInt(int64(len(codeRunes))))
+		if err != nil {
+			return "", err
+		}
+
+		b[i] = codeRunes[index.Int64()]
+	}
+
+	return string(b), nil
+}
+
+// GenerateToken returns n random bytes from a cryptographically secure source encoded for use in URLs.
+func GenerateToken(n int) (string, error) {
+	b := make([]byte, n)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
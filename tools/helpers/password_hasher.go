@@ -0,0 +1,98 @@
+package helpers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"strings"
+)
+
+// Parameters of argon2id for new hashes, hashes with other parameters are upgraded on login.
+const (
+	argonTime    = 1
+	argonMemory  = 64 * 1024
+	argonThreads = 4
+	argonKeyLen  = 32
+	argonSaltLen = 16
+)
+
+var errIncorrectHash = errors.New("incorrect password hash")
+
+// HashPassword returns the argon2id hash of the password with its parameters encoded:
+// $argon2id$v=19$m=65536,t=1,p=4$<salt>$<key>
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, argonSaltLen)
+
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", errors.New("salt generation error")
+	}
+
+	key := argon2.IDKey([]byte(password), salt, argonTime, argonMemory, argonThreads, argonKeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		argonMemory,
+		argonTime,
+		argonThreads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// VerifyPassword checks the password against the stored hash, needsUpgrade reports that the hash
+// is a legacy MD5 one or has outdated parameters and should be replaced with HashPassword.
+func VerifyPassword(hash string, password string) (ok bool, needsUpgrade bool, err error) {
+	if !strings.HasPrefix(hash, "$") {
+		legacy, err := NewMD5Hash(password)
+		if err != nil {
+			return false, false, err
+		}
+
+		ok := subtle.ConstantTimeCompare([]byte(legacy), []byte(hash)) == 1
+
+		return ok, ok, nil
+	}
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false, false, errIncorrectHash
+	}
+
+	var version int
+	var memory, time uint32
+	var threads uint8
+
+	_, err = fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return false, false, errIncorrectHash
+	}
+
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads)
+	if err != nil {
+		return false, false, errIncorrectHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false, errIncorrectHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, false, errIncorrectHash
+	}
+
+	actual := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(key)))
+
+	if subtle.ConstantTimeCompare(actual, key) != 1 {
+		return false, false, nil
+	}
+
+	needsUpgrade = memory != argonMemory || time != argonTime || threads != argonThreads || len(key) != argonKeyLen
+
+	return true, needsUpgrade, nil
+}
@@ -0,0 +1,86 @@
+package helpers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"strings"
+	"testing"
+)
+
+func TestHashPassword(t *testing.T) {
+	hash, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=65536,t=1,p=4$") {
+		t.Fatalf("hash is %q", hash)
+	}
+
+	other, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hash == other {
+		t.Fatal("hashes of the same password are the same, the salt is not random")
+	}
+
+	ok, needsUpgrade, err := VerifyPassword(hash, "correct horse")
+	if err != nil || !ok || needsUpgrade {
+		t.Fatalf("verify is %t, upgrade is %t, error is %v", ok, needsUpgrade, err)
+	}
+
+	ok, needsUpgrade, err = VerifyPassword(hash, "battery staple")
+	if err != nil || ok || needsUpgrade {
+		t.Fatalf("wrong password: verify is %t, upgrade is %t, error is %v", ok, needsUpgrade, err)
+	}
+}
+
+func TestVerifyPasswordUpgradesMD5(t *testing.T) {
+	legacy, err := NewMD5Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok, needsUpgrade, err := VerifyPassword(legacy, "correct horse")
+	if err != nil || !ok || !needsUpgrade {
+		t.Fatalf("verify is %t, upgrade is %t, error is %v", ok, needsUpgrade, err)
+	}
+
+	// a wrong password must not trigger the upgrade
+	ok, needsUpgrade, err = VerifyPassword(legacy, "battery staple")
+	if err != nil || ok || needsUpgrade {
+		t.Fatalf("wrong password: verify is %t, upgrade is %t, error is %v", ok, needsUpgrade, err)
+	}
+}
+
+func TestVerifyPasswordUpgradesOutdatedParameters(t *testing.T) {
+	salt := []byte("0123456789abcdef")
+	key := argon2.IDKey([]byte("correct horse"), salt, 2, 32*1024, 2, argonKeyLen)
+
+	hash := fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, 32*1024, 2, 2,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+
+	ok, needsUpgrade, err := VerifyPassword(hash, "correct horse")
+	if err != nil || !ok || !needsUpgrade {
+		t.Fatalf("verify is %t, upgrade is %t, error is %v", ok, needsUpgrade, err)
+	}
+}
+
+func TestVerifyPasswordRejectsIncorrectHashes(t *testing.T) {
+	for _, hash := range []string{
+		"$argon2i$v=19$m=65536,t=1,p=4$c2FsdA$a2V5",
+		"$argon2id$v=16$m=65536,t=1,p=4$c2FsdA$a2V5",
+		"$argon2id$v=19$m=x,t=1,p=4$c2FsdA$a2V5",
+		"$argon2id$v=19$m=65536,t=1,p=4$!!!$a2V5",
+		"$argon2id$v=19$m=65536,t=1,p=4$c2FsdA$!!!",
+		"$argon2id$v=19$m=65536,t=1,p=4$c2FsdA",
+	} {
+		ok, _, err := VerifyPassword(hash, "correct horse")
+		if err != errIncorrectHash || ok {
+			t.Errorf("%q: verify is %t, error is %v", hash, ok, err)
+		}
+	}
+}
@@ -36,17 +36,18 @@ func Unzip(src, dest string) error {
 			}
 		}()
 
-		path := filepath.Join(dest, f.Name)
+		// the names are escaped in SIGame archives, so the path is checked once unescaped
+		name, err := url.PathUnescape(f.Name)
+		if err != nil {
+			return err
+		}
+
+		path := filepath.Join(dest, name)
 
 		if !strings.HasPrefix(path, filepath.Clean(dest)+string(os.PathSeparator)) {
 			return fmt.Errorf("illegal file path: %s", path)
 		}
 
-		path, err = url.PathUnescape(path)
-		if err != nil {
-			return err
-		}
-
 		if f.FileInfo().IsDir() {
 			os.MkdirAll(path, f.Mode())
 		} else {
@@ -0,0 +1,69 @@
+package helpers
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeZip(t *testing.T, path string, names ...string) {
+	t.Helper()
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	archive := zip.NewWriter(f)
+
+	for _, name := range names {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := w.Write([]byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnzipUnescapesNames(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "pack.siq")
+	dest := filepath.Join(dir, "pack")
+
+	writeZip(t, src, "content.xml", "Images/big%20cat.jpg")
+
+	if err := Unzip(src, dest); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dest, "Images", "big cat.jpg")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnzipRejectsPathsOutsideOfDest(t *testing.T) {
+	for _, name := range []string{"../evil", "Images/../../evil", "%2e%2e/evil", "Images%2F..%2F..%2Fevil"} {
+		dir := t.TempDir()
+		src := filepath.Join(dir, "pack.siq")
+
+		writeZip(t, src, name)
+
+		if err := Unzip(src, filepath.Join(dir, "pack")); err == nil {
+			t.Errorf("%s: archive is unpacked", name)
+		}
+
+		if _, err := os.Stat(filepath.Join(dir, "evil")); !os.IsNotExist(err) {
+			t.Errorf("%s: file is written outside of the destination", name)
+		}
+	}
+}
@@ -1,23 +1,29 @@
 package jwt
 
 import (
+	"errors"
 	"github.com/dgrijalva/jwt-go"
 )
 
-var (
-	signingMethod = jwt.SigningMethodHS256
-)
+// accessSubject tells access tokens from the other tokens signed with the same keys.
+const accessSubject = "access"
+
+var ErrNotAccessToken = errors.New("not an access token")
 
 type Claims struct {
 	ID    uint64
 	Login string
+	// Account role of the user, see models.
+	Role string
+	// ID of the token family the token is issued for, empty for tokens that cannot be revoked.
+	SessionID string
 	jwt.StandardClaims
 }
 
-func CreateJWT(secretKey []byte, claims *Claims) (string, error) {
-	token := jwt.NewWithClaims(signingMethod, claims)
+func CreateJWT(keys *KeySet, claims *Claims) (string, error) {
+	claims.Subject = accessSubject
 
-	tokenStr, err := token.SignedString(secretKey)
+	tokenStr, err := keys.sign(claims)
 	if err != nil {
 		return "", err
 	}
@@ -25,15 +31,18 @@ func CreateJWT(secretKey []byte, claims *Claims) (string, error) {
 	return tokenStr, nil
 }
 
-func ParseJWT(secretKey []byte, tokenByte string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenByte, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return secretKey, nil
-	})
+func ParseJWT(keys *KeySet, tokenByte string) (*Claims, error) {
+	token, err := keys.parse(tokenByte, &Claims{})
 	if err != nil {
 		return nil, err
 	}
 
 	claims := token.Claims.(*Claims)
 
+	// invites and media tokens are signed with the same keys, they must never pass as a user
+	if claims.Subject != accessSubject {
+		return nil, ErrNotAccessToken
+	}
+
 	return claims, nil
 }
@@ -0,0 +1,101 @@
+package jwt
+
+import (
+	"github.com/dgrijalva/jwt-go"
+	"mygame/tools/clock"
+	"testing"
+	"time"
+)
+
+var testNow = time.Date(2021, 12, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestKeySet(t *testing.T) *KeySet {
+	t.Helper()
+
+	keys, err := NewKeySet("", WithSecretKey("", nil, "secret", time.Time{}), clock.NewFake(testNow))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return keys
+}
+
+func TestParseJWT(t *testing.T) {
+	keys := newTestKeySet(t)
+
+	token, err := CreateJWT(keys, &Claims{
+		ID:    1,
+		Login: "cat",
+		Role:  "user",
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: testNow.Add(time.Minute).Unix(),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := ParseJWT(keys, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims.ID != 1 || claims.Login != "cat" || claims.Role != "user" {
+		t.Fatalf("claims are %+v", claims)
+	}
+}
+
+func TestParseJWTRejectsOtherTokens(t *testing.T) {
+	keys := newTestKeySet(t)
+
+	invite, err := CreateInviteJWT(keys, 7, testNow.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	media, err := CreateMediaJWT(keys, 7, 1, "cat", testNow.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a token signed with the right key and a subject of its own
+	other, err := keys.sign(&Claims{
+		ID:    1,
+		Login: "cat",
+		StandardClaims: jwt.StandardClaims{
+			Subject:   "refresh",
+			ExpiresAt: testNow.Add(time.Hour).Unix(),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, token := range map[string]string{
+		"invite": invite,
+		"media":  media,
+		"other":  other,
+	} {
+		if _, err := ParseJWT(keys, token); err != ErrNotAccessToken {
+			t.Errorf("%s token is parsed as an access token, error is %v", name, err)
+		}
+	}
+}
+
+func TestParseJWTRejectsExpiredTokens(t *testing.T) {
+	keys := newTestKeySet(t)
+
+	token, err := CreateJWT(keys, &Claims{
+		ID: 1,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: testNow.Add(-time.Second).Unix(),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ParseJWT(keys, token); err != ErrTokenExpired {
+		t.Fatalf("error is %v, want %v", err, ErrTokenExpired)
+	}
+}
@@ -7,10 +7,12 @@ import (
 	"time"
 )
 
-func GenerateTokens(ctx context.Context, userID uint64, login string, jwtSecretKey string, expirationTime time.Duration) (string, error) {
-	accessToken, err := CreateJWT([]byte(jwtSecretKey), &Claims{
-		ID:    userID,
-		Login: login,
+func GenerateTokens(ctx context.Context, userID uint64, login string, role string, sessionID string, keys *KeySet, expirationTime time.Duration) (string, error) {
+	accessToken, err := CreateJWT(keys, &Claims{
+		ID:        userID,
+		Login:     login,
+		Role:      role,
+		SessionID: sessionID,
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: time.Now().Add(expirationTime).Unix(),
 		},
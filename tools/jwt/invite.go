@@ -0,0 +1,39 @@
+package jwt
+
+import (
+	"errors"
+	"github.com/dgrijalva/jwt-go"
+	"time"
+)
+
+const inviteSubject = "invite"
+
+type InviteClaims struct {
+	HubID int
+	jwt.StandardClaims
+}
+
+func CreateInviteJWT(keys *KeySet, hubID int, expiresAt time.Time) (string, error) {
+	return keys.sign(&InviteClaims{
+		HubID: hubID,
+		StandardClaims: jwt.StandardClaims{
+			Subject:   inviteSubject,
+			ExpiresAt: expiresAt.Unix(),
+		},
+	})
+}
+
+// ParseInviteJWT checks the signature and the expiration time of the invite.
+func ParseInviteJWT(keys *KeySet, tokenStr string) (*InviteClaims, error) {
+	token, err := keys.parse(tokenStr, &InviteClaims{})
+	if err != nil {
+		return nil, err
+	}
+
+	claims := token.Claims.(*InviteClaims)
+	if claims.Subject != inviteSubject {
+		return nil, errors.New("not an invite")
+	}
+
+	return claims, nil
+}
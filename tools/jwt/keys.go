@@ -0,0 +1,322 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"github.com/dgrijalva/jwt-go"
+	"io/ioutil"
+	"math/big"
+	"mygame/tools/clock"
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// LegacyKeyID is the ID of the key built from the secret key, tokens without a key ID are verified with it.
+const LegacyKeyID = "legacy"
+
+var (
+	ErrUnknownKey       = errors.New("unknown signing key")
+	ErrUnexpectedMethod = errors.New("unexpected signing method")
+	ErrNoSigningKey     = errors.New("no signing key")
+	ErrTokenExpired     = errors.New("token is expired")
+)
+
+// KeyConfig describes a signing key in the configuration.
+type KeyConfig struct {
+	ID        string `yaml:"id"`
+	Algorithm string `yaml:"algorithm"`
+	// PEM file with the private key of RS256 and EdDSA keys.
+	PrivateKeyFile string `yaml:"private_key_file"`
+	// Environment variable with the secret of HS256 keys.
+	SecretEnv string `yaml:"secret_env"`
+	// Tokens signed with a retired key are accepted until this time, zero means forever.
+	VerifyUntil time.Time `yaml:"verify_until"`
+
+	// Secret of the HS256 key given other than by the environment.
+	secret []byte
+}
+
+// WithSecretKey adds the key of the secret key to the configured ones. The secret key signs tokens while no other
+// key is configured or it is chosen as the active one. Otherwise it only verifies tokens until verifyUntil
+// and is left out when verifyUntil is not set, so an old secret never verifies tokens forever.
+func WithSecretKey(activeKeyID string, configs []KeyConfig, secret string, verifyUntil time.Time) []KeyConfig {
+	if secret == "" {
+		return configs
+	}
+
+	legacy := KeyConfig{
+		ID:        LegacyKeyID,
+		Algorithm: AlgorithmHS256,
+		secret:    []byte(secret),
+	}
+
+	if len(configs) != 0 && activeKeyID != LegacyKeyID {
+		if verifyUntil.IsZero() {
+			return configs
+		}
+
+		legacy.VerifyUntil = verifyUntil
+	}
+
+	return append([]KeyConfig{legacy}, configs...)
+}
+
+type key struct {
+	id          string
+	method      jwt.SigningMethod
+	signKey     interface{}
+	verifyKey   interface{}
+	verifyUntil time.Time
+}
+
+// KeySet signs tokens with its active key and verifies them with any key still within its verification window.
+type KeySet struct {
+	active *key
+	keys   map[string]*key
+
+	clock clock.Clock
+}
+
+// NewKeySet loads the configured keys, the only key is the active one when none is chosen.
+func NewKeySet(activeKeyID string, configs []KeyConfig, clock clock.Clock) (*KeySet, error) {
+	set := &KeySet{
+		keys:  make(map[string]*key),
+		clock: clock,
+	}
+
+	for _, config := range configs {
+		if config.ID == "" {
+			return nil, errors.New("jwt key without id")
+		}
+
+		if _, ok := set.keys[config.ID]; ok {
+			return nil, errors.New("duplicate jwt key " + config.ID)
+		}
+
+		k, err := loadKey(config)
+		if err != nil {
+			return nil, err
+		}
+
+		set.keys[k.id] = k
+	}
+
+	if activeKeyID == "" && len(configs) == 1 {
+		activeKeyID = configs[0].ID
+	}
+
+	active, ok := set.keys[activeKeyID]
+	if !ok {
+		return nil, ErrNoSigningKey
+	}
+
+	if !active.verifyUntil.IsZero() {
+		return nil, errors.New("active jwt key " + active.id + " cannot be retired")
+	}
+
+	set.active = active
+
+	return set, nil
+}
+
+func loadKey(config KeyConfig) (*key, error) {
+	k := &key{
+		id:          config.ID,
+		verifyUntil: config.VerifyUntil,
+	}
+
+	switch config.Algorithm {
+	case AlgorithmHS256:
+		secret := config.secret
+		if secret == nil && config.SecretEnv != "" {
+			secret = []byte(os.Getenv(config.SecretEnv))
+		}
+
+		if len(secret) == 0 {
+			return nil, errors.New("jwt key " + config.ID + " has an empty secret")
+		}
+
+		k.method = jwt.SigningMethodHS256
+		k.signKey = secret
+		k.verifyKey = secret
+	case AlgorithmRS256:
+		privateKey, err := readPrivateKey(config.PrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		rsaKey, ok := privateKey.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("jwt key " + config.ID + " is not an RSA key")
+		}
+
+		k.method = jwt.SigningMethodRS256
+		k.signKey = rsaKey
+		k.verifyKey = &rsaKey.PublicKey
+	case AlgorithmEdDSA:
+		privateKey, err := readPrivateKey(config.PrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		edKey, ok := privateKey.(ed25519.PrivateKey)
+		if !ok {
+			return nil, errors.New("jwt key " + config.ID + " is not an Ed25519 key")
+		}
+
+		k.method = SigningMethodEdDSA
+		k.signKey = edKey
+		k.verifyKey = edKey.Public()
+	default:
+		return nil, errors.New("jwt key " + config.ID + " has unsupported algorithm " + config.Algorithm)
+	}
+
+	return k, nil
+}
+
+// readPrivateKey reads a PKCS #8 or, for RSA, a PKCS #1 private key from the PEM file.
+func readPrivateKey(path string) (interface{}, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no pem data in " + path)
+	}
+
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+
+	return x509.ParsePKCS8PrivateKey(block.Bytes)
+}
+
+func (s *KeySet) sign(claims jwt.Claims) (string, error) {
+	if s == nil || s.active == nil {
+		return "", ErrNoSigningKey
+	}
+
+	token := jwt.NewWithClaims(s.active.method, claims)
+	token.Header["kid"] = s.active.id
+
+	return token.SignedString(s.active.signKey)
+}
+
+func (s *KeySet) parse(tokenStr string, claims jwt.Claims) (*jwt.Token, error) {
+	if s == nil {
+		return nil, ErrUnknownKey
+	}
+
+	// the claims are checked against the clock of the set rather than the wall clock
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+
+	token, err := parser.ParseWithClaims(tokenStr, claims, s.keyFunc)
+	if err != nil {
+		return nil, err
+	}
+
+	if expiring, ok := claims.(interface {
+		VerifyExpiresAt(now int64, required bool) bool
+	}); ok && !expiring.VerifyExpiresAt(s.clock.Now().Unix(), false) {
+		return nil, ErrTokenExpired
+	}
+
+	return token, nil
+}
+
+// keyFunc finds the key by the ID in the header and refuses any algorithm but the one of the key.
+// Tokens without a key ID were signed with the secret key, they are refused once it is retired.
+func (s *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, ok := token.Header["kid"].(string)
+	if !ok {
+		kid = LegacyKeyID
+	}
+
+	k, ok := s.keys[kid]
+	if !ok || !k.verifies(s.clock.Now()) {
+		return nil, ErrUnknownKey
+	}
+
+	if token.Method.Alg() != k.method.Alg() {
+		return nil, ErrUnexpectedMethod
+	}
+
+	return k.verifyKey, nil
+}
+
+func (k *key) verifies(now time.Time) bool {
+	return k.verifyUntil.IsZero() || !now.After(k.verifyUntil)
+}
+
+// JWK is the public part of a key as published in a JSON Web Key Set.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+
+	// RSA keys.
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// Ed25519 keys.
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// PublicKeys returns the asymmetric keys tokens may currently be verified with, HS256 secrets are never published.
+func (s *KeySet) PublicKeys() []*JWK {
+	if s == nil {
+		return []*JWK{}
+	}
+
+	jwks := make([]*JWK, 0, len(s.keys))
+
+	now := s.clock.Now()
+
+	for _, k := range s.keys {
+		if !k.verifies(now) {
+			continue
+		}
+
+		switch verifyKey := k.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwks = append(jwks, &JWK{
+				KeyType:   "RSA",
+				KeyID:     k.id,
+				Algorithm: k.method.Alg(),
+				Use:       "sig",
+				N:         base64.RawURLEncoding.EncodeToString(verifyKey.N.Bytes()),
+				E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(verifyKey.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			jwks = append(jwks, &JWK{
+				KeyType:   "OKP",
+				KeyID:     k.id,
+				Algorithm: k.method.Alg(),
+				Use:       "sig",
+				Curve:     "Ed25519",
+				X:         base64.RawURLEncoding.EncodeToString(verifyKey),
+			})
+		}
+	}
+
+	sort.Slice(jwks, func(i, j int) bool {
+		return jwks[i].KeyID < jwks[j].KeyID
+	})
+
+	return jwks
+}
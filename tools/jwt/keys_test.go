@@ -0,0 +1,310 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"github.com/dgrijalva/jwt-go"
+	"math/big"
+	"mygame/tools/clock"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// keyFixture writes an RSA and an Ed25519 key and keeps the HS256 secret in the environment.
+type keyFixture struct {
+	rsaKey *rsa.PrivateKey
+	edKey  ed25519.PrivateKey
+
+	configs []KeyConfig
+}
+
+func newKeyFixture(t *testing.T) *keyFixture {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edDER, err := x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsaFile := filepath.Join(dir, "rsa.pem")
+	edFile := filepath.Join(dir, "ed.pem")
+
+	writePEM(t, rsaFile, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+	writePEM(t, edFile, "PRIVATE KEY", edDER)
+
+	t.Setenv("JWT_TEST_SECRET", "shared secret")
+
+	return &keyFixture{
+		rsaKey: rsaKey,
+		edKey:  edKey,
+		configs: []KeyConfig{
+			{ID: "ed", Algorithm: AlgorithmEdDSA, PrivateKeyFile: edFile},
+			{ID: "rsa", Algorithm: AlgorithmRS256, PrivateKeyFile: rsaFile},
+			{ID: "hs", Algorithm: AlgorithmHS256, SecretEnv: "JWT_TEST_SECRET"},
+		},
+	}
+}
+
+func writePEM(t *testing.T, path string, blockType string, der []byte) {
+	t.Helper()
+
+	err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func accessClaims() *Claims {
+	return &Claims{
+		ID:    1,
+		Login: "cat",
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: testNow.Add(time.Hour).Unix(),
+		},
+	}
+}
+
+func TestKeySetSelectsKeyByID(t *testing.T) {
+	f := newKeyFixture(t)
+	fake := clock.NewFake(testNow)
+
+	verifier, err := NewKeySet("ed", f.configs, fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		kid string
+		alg string
+	}{
+		{kid: "ed", alg: "EdDSA"},
+		{kid: "rsa", alg: "RS256"},
+		{kid: "hs", alg: "HS256"},
+	} {
+		signer, err := NewKeySet(test.kid, f.configs, fake)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tokenStr, err := CreateJWT(signer, accessClaims())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		token, _, err := new(jwt.Parser).ParseUnverified(tokenStr, &Claims{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if token.Header["kid"] != test.kid || token.Header["alg"] != test.alg {
+			t.Errorf("token of %s has the header %v", test.kid, token.Header)
+		}
+
+		claims, err := ParseJWT(verifier, tokenStr)
+		if err != nil {
+			t.Errorf("token of %s: %v", test.kid, err)
+		} else if claims.Login != "cat" {
+			t.Errorf("token of %s has the claims %+v", test.kid, claims)
+		}
+	}
+}
+
+func TestKeySetRejectsTokens(t *testing.T) {
+	f := newKeyFixture(t)
+	fake := clock.NewFake(testNow)
+
+	keys, err := NewKeySet("ed", f.configs, fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sign := func(method jwt.SigningMethod, kid interface{}, key interface{}) string {
+		token := jwt.NewWithClaims(method, accessClaims())
+		if kid != nil {
+			token.Header["kid"] = kid
+		}
+
+		tokenStr, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return tokenStr
+	}
+
+	otherRSA, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{name: "unknown kid", token: sign(jwt.SigningMethodHS256, "gone", []byte("shared secret")), want: ErrUnknownKey},
+		{name: "no kid without secret key", token: sign(jwt.SigningMethodHS256, nil, []byte("shared secret")), want: ErrUnknownKey},
+		// the public RSA key must never pass for an HMAC secret
+		{name: "algorithm of another key", token: sign(jwt.SigningMethodHS256, "rsa", []byte("shared secret")), want: ErrUnexpectedMethod},
+		{name: "none", token: sign(jwt.SigningMethodNone, "hs", jwt.UnsafeAllowNoneSignatureType), want: ErrUnexpectedMethod},
+		{name: "wrong key", token: sign(jwt.SigningMethodRS256, "rsa", otherRSA), want: rsa.ErrVerification},
+	} {
+		_, err := ParseJWT(keys, test.token)
+
+		validationErr, ok := err.(*jwt.ValidationError)
+		if !ok || validationErr.Inner != test.want {
+			t.Errorf("%s: error is %v, want %v", test.name, err, test.want)
+		}
+	}
+}
+
+func TestKeySetRetiresKeys(t *testing.T) {
+	f := newKeyFixture(t)
+	fake := clock.NewFake(testNow)
+
+	rsaSigner, err := NewKeySet("rsa", f.configs, fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsaToken, err := CreateJWT(rsaSigner, accessClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	legacySigner, err := NewKeySet("", WithSecretKey("", nil, "old secret", time.Time{}), fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	legacyToken, err := CreateJWT(legacySigner, accessClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configs := append([]KeyConfig(nil), f.configs...)
+	configs[1].VerifyUntil = testNow.Add(time.Minute)
+
+	keys, err := NewKeySet("ed", WithSecretKey("ed", configs, "old secret", testNow.Add(time.Minute)), fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, token := range map[string]string{"rsa": rsaToken, "legacy": legacyToken} {
+		if _, err := ParseJWT(keys, token); err != nil {
+			t.Errorf("%s token is rejected before the key is retired: %v", name, err)
+		}
+	}
+
+	if len(keys.PublicKeys()) != 2 {
+		t.Fatal("retiring key is not published")
+	}
+
+	fake.Advance(time.Minute + time.Second)
+
+	for name, token := range map[string]string{"rsa": rsaToken, "legacy": legacyToken} {
+		if _, err := ParseJWT(keys, token); err == nil {
+			t.Errorf("%s token is accepted after the key is retired", name)
+		}
+	}
+
+	if jwks := keys.PublicKeys(); len(jwks) != 1 || jwks[0].KeyID != "ed" {
+		t.Fatalf("published keys are %+v, want only ed", jwks)
+	}
+
+	// without the time, the secret key does not verify tokens at all once keys are configured
+	keys, err = NewKeySet("ed", WithSecretKey("ed", f.configs, "old secret", time.Time{}), fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ParseJWT(keys, legacyToken); err == nil {
+		t.Error("legacy token is accepted without secret_key_verify_until")
+	}
+}
+
+func TestKeySetPublicKeys(t *testing.T) {
+	f := newKeyFixture(t)
+
+	keys, err := NewKeySet("ed", f.configs, clock.NewFake(testNow))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwks := keys.PublicKeys()
+	if len(jwks) != 2 {
+		t.Fatalf("published keys are %+v, want ed and rsa without the HS256 secret", jwks)
+	}
+
+	ed, rsaJWK := jwks[0], jwks[1]
+
+	x, err := base64.RawURLEncoding.DecodeString(ed.X)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ed.KeyID != "ed" || ed.KeyType != "OKP" || ed.Curve != "Ed25519" || ed.Algorithm != "EdDSA" || ed.Use != "sig" ||
+		!f.edKey.Public().(ed25519.PublicKey).Equal(ed25519.PublicKey(x)) {
+		t.Errorf("ed key is %+v", ed)
+	}
+
+	n, err := base64.RawURLEncoding.DecodeString(rsaJWK.N)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := base64.RawURLEncoding.DecodeString(rsaJWK.E)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rsaJWK.KeyID != "rsa" || rsaJWK.KeyType != "RSA" || rsaJWK.Algorithm != "RS256" || rsaJWK.Use != "sig" ||
+		new(big.Int).SetBytes(n).Cmp(f.rsaKey.N) != 0 || new(big.Int).SetBytes(e).Int64() != int64(f.rsaKey.E) {
+		t.Errorf("rsa key is %+v", rsaJWK)
+	}
+}
+
+func TestNewKeySetRejectsConfigs(t *testing.T) {
+	f := newKeyFixture(t)
+	fake := clock.NewFake(testNow)
+
+	retired := append([]KeyConfig(nil), f.configs...)
+	retired[0].VerifyUntil = testNow
+
+	for _, test := range []struct {
+		name    string
+		active  string
+		configs []KeyConfig
+	}{
+		{name: "no active key", configs: f.configs},
+		{name: "unknown active key", active: "gone", configs: f.configs},
+		{name: "retired active key", active: "ed", configs: retired},
+		{name: "duplicate id", active: "ed", configs: append(f.configs, f.configs[0])},
+		{name: "no id", configs: []KeyConfig{{Algorithm: AlgorithmHS256, SecretEnv: "JWT_TEST_SECRET"}}},
+		{name: "unknown algorithm", configs: []KeyConfig{{ID: "es", Algorithm: "ES256"}}},
+		{name: "empty secret", configs: []KeyConfig{{ID: "hs", Algorithm: AlgorithmHS256, SecretEnv: "JWT_TEST_NO_SECRET"}}},
+		{name: "not an RSA key", configs: []KeyConfig{{ID: "rsa", Algorithm: AlgorithmRS256, PrivateKeyFile: f.configs[0].PrivateKeyFile}}},
+	} {
+		if _, err := NewKeySet(test.active, test.configs, fake); err == nil {
+			t.Errorf("%s: key set is created", test.name)
+		}
+	}
+}
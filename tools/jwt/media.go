@@ -0,0 +1,44 @@
+package jwt
+
+import (
+	"errors"
+	"github.com/dgrijalva/jwt-go"
+	"time"
+)
+
+const mediaSubject = "media"
+
+// MediaClaims let the user fetch the media of a single hub, media elements of browsers cannot send headers.
+type MediaClaims struct {
+	HubID int
+	ID    uint64
+	Login string
+	jwt.StandardClaims
+}
+
+func CreateMediaJWT(keys *KeySet, hubID int, id uint64, login string, expiresAt time.Time) (string, error) {
+	return keys.sign(&MediaClaims{
+		HubID: hubID,
+		ID:    id,
+		Login: login,
+		StandardClaims: jwt.StandardClaims{
+			Subject:   mediaSubject,
+			ExpiresAt: expiresAt.Unix(),
+		},
+	})
+}
+
+// ParseMediaJWT checks the signature and the expiration time of the media token.
+func ParseMediaJWT(keys *KeySet, tokenStr string) (*MediaClaims, error) {
+	token, err := keys.parse(tokenStr, &MediaClaims{})
+	if err != nil {
+		return nil, err
+	}
+
+	claims := token.Claims.(*MediaClaims)
+	if claims.Subject != mediaSubject {
+		return nil, errors.New("not a media token")
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,55 @@
+package rating
+
+import "math"
+
+const (
+	// Rating of a player without rated games.
+	Initial = 1500
+
+	// Largest change of rating in a game between two players.
+	k = 32
+)
+
+// Update returns new ratings after a game with many players, every pair of players is rated
+// as a separate match won by the one with the higher score.
+func Update(ratings []int, scores []int) []int {
+	updated := make([]int, len(ratings))
+	copy(updated, ratings)
+
+	if len(ratings) < 2 {
+		return updated
+	}
+
+	// the total change stays within k however many players there are
+	pairK := float64(k) / float64(len(ratings)-1)
+
+	for i := range ratings {
+		var delta float64
+		for j := range ratings {
+			if i == j {
+				continue
+			}
+
+			delta += pairK * (actual(scores[i], scores[j]) - expected(ratings[i], ratings[j]))
+		}
+
+		updated[i] = ratings[i] + int(math.Round(delta))
+	}
+
+	return updated
+}
+
+func expected(rating, opponent int) float64 {
+	return 1 / (1 + math.Pow(10, float64(opponent-rating)/400))
+}
+
+func actual(score, opponent int) float64 {
+	switch {
+	case score > opponent:
+		return 1
+	case score < opponent:
+		return 0
+	}
+
+	return 0.5
+}